@@ -0,0 +1,381 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAdminCacheTTL is a default lifetime of the cached bot member and administrators of the chat
+	DefaultAdminCacheTTL = 5 * time.Minute
+	// KickUnbanAttempts is a number of attempts to unban the user, kicked with the Kick
+	KickUnbanAttempts = 3
+)
+
+// kickRetryDelay is a delay between the unban attempts of the Kick
+var kickRetryDelay = 100 * time.Millisecond
+
+// PermissionError is returned, when the bot lacks the permission for the action in the chat
+type PermissionError struct {
+	ChatId     int
+	Permission Permission
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("missing permission %s in chat %d", e.Permission, e.ChatId)
+}
+
+// KickError is returned by the Kick, when the user is banned, but all unban attempts have failed:
+// the user can't join the chat again until the Unban succeeds
+type KickError struct {
+	ChatId int
+	UserId int
+	// Err is the error of the last unban attempt
+	Err error
+}
+
+func (e *KickError) Error() string {
+	return fmt.Sprintf("user %d is banned in chat %d, unban failed: %s", e.UserId, e.ChatId, e.Err)
+}
+
+// Unwrap returns the error of the unban
+func (e *KickError) Unwrap() error {
+	return e.Err
+}
+
+// Can checks if the member has the administrator permission, the creator has all permissions
+func (m *ChatMember) Can(permission Permission) bool {
+	if m.IsCreator() {
+		return true
+	}
+	if m == nil || ChatMemberStatus(m.Status) != ChatMemberStatusAdministrator {
+		return false
+	}
+	switch permission {
+	case PermissionChangeInfo:
+		return m.CanChangeInfo
+	case PermissionPostMessages:
+		return m.CanPostMessages
+	case PermissionEditMessages:
+		return m.CanEditMessages
+	case PermissionDeleteMessages:
+		return m.CanDeleteMessages
+	case PermissionInviteUsers:
+		return m.CanInviteUsers
+	case PermissionRestrictMembers:
+		return m.CanRestrictMembers
+	case PermissionPinMessages:
+		return m.CanPinMessages
+	case PermissionPromoteMembers:
+		return m.CanPromoteMembers
+	}
+	return false
+}
+
+// Admin performs administrative actions in chats: permissions of the bot are checked before each action,
+// so PermissionError is returned instead of the API error. Bot member and chat administrators are cached for the TTL,
+// the cache of the chat is dropped if the action fails because of rights.
+type Admin struct {
+	Bot *Bot
+	// TTL of the cached members, DefaultAdminCacheTTL is used if empty
+	TTL time.Duration
+
+	mu     sync.Mutex
+	me     *User
+	chats  map[int]*adminChat
+	admins map[int]*adminChat
+	// loads are in-flight loads of the chats, so concurrent misses of the chat load it once
+	loads map[adminLoadKey]*adminLoad
+}
+
+type adminChat struct {
+	members []*ChatMember
+	expires time.Time
+}
+
+type adminLoadKey struct {
+	chatId int
+	admins bool
+}
+
+type adminLoad struct {
+	done    chan struct{}
+	members []*ChatMember
+	err     error
+}
+
+// NewAdmin creates the admin helper
+func NewAdmin(bot *Bot) *Admin {
+	return &Admin{
+		Bot: bot,
+		TTL: DefaultAdminCacheTTL,
+	}
+}
+
+// Member returns the cached member of the bot in the chat
+func (a *Admin) Member(ctx context.Context, chatId int) (*ChatMember, error) {
+	members, err := a.cached(ctx, chatId, false, func(ctx context.Context) ([]*ChatMember, error) {
+		me, err := a.getMe(ctx)
+		if err != nil {
+			return nil, err
+		}
+		member, err := a.Bot.GetChatMember(ctx, &GetChatMemberRequest{ChatId: chatId, UserId: me.Id})
+		if err != nil {
+			return nil, err
+		}
+		return []*ChatMember{member}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members[0], nil
+}
+
+// Administrators returns the cached administrators of the chat
+func (a *Admin) Administrators(ctx context.Context, chatId int) ([]*ChatMember, error) {
+	return a.cached(ctx, chatId, true, func(ctx context.Context) ([]*ChatMember, error) {
+		return a.Bot.GetChatAdministrators(ctx, &GetChatAdministratorsRequest{ChatId: chatId})
+	})
+}
+
+// IsAdmin checks if the user is an administrator of the chat
+func (a *Admin) IsAdmin(ctx context.Context, chatId, userId int) (bool, error) {
+	admins, err := a.Administrators(ctx, chatId)
+	if err != nil {
+		return false, err
+	}
+	for _, admin := range admins {
+		if admin.User != nil && admin.User.Id == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Check returns PermissionError for the first permission, that the bot lacks in the chat
+func (a *Admin) Check(ctx context.Context, chatId int, permissions ...Permission) error {
+	member, err := a.Member(ctx, chatId)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if !member.Can(permission) {
+			return &PermissionError{ChatId: chatId, Permission: permission}
+		}
+	}
+	return nil
+}
+
+// Invalidate drops the cached members of the chat, e.g. when the bot is promoted
+func (a *Admin) Invalidate(chatId int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.chats, chatId)
+	delete(a.admins, chatId)
+	delete(a.loads, adminLoadKey{chatId: chatId})
+	delete(a.loads, adminLoadKey{chatId: chatId, admins: true})
+}
+
+// Mute restricts the user from sending messages for the duration, shorter than 30 seconds or longer than 366 days
+// duration is forever
+func (a *Admin) Mute(ctx context.Context, chatId, userId int, duration time.Duration) error {
+	return a.Restrict(ctx, &RestrictChatMemberRequest{ChatId: chatId, UserId: userId, UntilDate: UntilPeriod(duration)})
+}
+
+// Unmute lifts restrictions of the user
+func (a *Admin) Unmute(ctx context.Context, chatId, userId int) error {
+	return a.Restrict(ctx, &RestrictChatMemberRequest{
+		ChatId:                chatId,
+		UserId:                userId,
+		CanSendMessages:       true,
+		CanSendMediaMessages:  true,
+		CanSendOtherMessages:  true,
+		CanAddWebPagePreviews: true,
+	})
+}
+
+// Restrict restricts the user with the request
+func (a *Admin) Restrict(ctx context.Context, request *RestrictChatMemberRequest) error {
+	return a.do(ctx, request.ChatId, PermissionRestrictMembers, func() error {
+		_, err := a.Bot.RestrictChatMember(ctx, request)
+		return err
+	})
+}
+
+// Ban kicks the user from the chat for the duration, shorter than 30 seconds or longer than 366 days duration is forever
+func (a *Admin) Ban(ctx context.Context, chatId, userId int, duration time.Duration) error {
+	return a.do(ctx, chatId, PermissionRestrictMembers, func() error {
+		_, err := a.Bot.KickChatMember(ctx, &KickChatMemberRequest{ChatId: chatId, UserId: userId, UntilDate: UntilPeriod(duration)})
+		return err
+	})
+}
+
+// Unban allows the kicked user to join the chat again
+func (a *Admin) Unban(ctx context.Context, chatId, userId int) error {
+	return a.do(ctx, chatId, PermissionRestrictMembers, func() error {
+		_, err := a.Bot.UnbanChatMember(ctx, &UnbanChatMemberRequest{ChatId: chatId, UserId: userId})
+		return err
+	})
+}
+
+// Kick removes the user from the chat, user can join it again: the user is banned and unbanned.
+// Unban is retried KickUnbanAttempts times, KickError is returned if the user stays banned.
+func (a *Admin) Kick(ctx context.Context, chatId, userId int) error {
+	if err := a.Ban(ctx, chatId, userId, 0); err != nil {
+		return err
+	}
+	var err error
+	for attempt := 1; attempt <= KickUnbanAttempts; attempt++ {
+		if err = a.Unban(ctx, chatId, userId); err == nil {
+			return nil
+		}
+		if attempt == KickUnbanAttempts {
+			break
+		}
+		select {
+		case <-time.After(kickRetryDelay):
+		case <-ctx.Done():
+			return &KickError{ChatId: chatId, UserId: userId, Err: ctx.Err()}
+		}
+	}
+	return &KickError{ChatId: chatId, UserId: userId, Err: err}
+}
+
+// Promote changes administrator rights of the user
+func (a *Admin) Promote(ctx context.Context, request *PromoteChatMemberRequest) error {
+	return a.do(ctx, request.ChatId, PermissionPromoteMembers, func() error {
+		_, err := a.Bot.PromoteChatMember(ctx, request)
+		return err
+	})
+}
+
+// Pin pins the message in the chat
+func (a *Admin) Pin(ctx context.Context, request *PinChatMessageRequest) error {
+	return a.do(ctx, request.ChatId, PermissionPinMessages, func() error {
+		_, err := a.Bot.PinChatMessage(ctx, request)
+		return err
+	})
+}
+
+// Unpin unpins the pinned message of the chat
+func (a *Admin) Unpin(ctx context.Context, chatId int) error {
+	return a.do(ctx, chatId, PermissionPinMessages, func() error {
+		_, err := a.Bot.UnpinChatMessage(ctx, &UnpinChatMessageRequest{ChatId: chatId})
+		return err
+	})
+}
+
+// SetTitle changes the title of the chat
+func (a *Admin) SetTitle(ctx context.Context, chatId int, title string) error {
+	return a.do(ctx, chatId, PermissionChangeInfo, func() error {
+		_, err := a.Bot.SetChatTitle(ctx, &SetChatTitleRequest{ChatId: chatId, Title: title})
+		return err
+	})
+}
+
+// SetDescription changes the description of the chat
+func (a *Admin) SetDescription(ctx context.Context, chatId int, description string) error {
+	return a.do(ctx, chatId, PermissionChangeInfo, func() error {
+		_, err := a.Bot.SetChatDescription(ctx, &SetChatDescriptionRequest{ChatId: chatId, Description: description})
+		return err
+	})
+}
+
+// DeleteMessage deletes the message of the other user
+func (a *Admin) DeleteMessage(ctx context.Context, chatId, messageId int) error {
+	return a.do(ctx, chatId, PermissionDeleteMessages, func() error {
+		_, err := a.Bot.DeleteMessage(ctx, &DeleteMessageRequest{ChatId: chatId, MessageId: messageId})
+		return err
+	})
+}
+
+// InviteLink generates the new invite link of the chat
+func (a *Admin) InviteLink(ctx context.Context, chatId int) (link string, err error) {
+	err = a.do(ctx, chatId, PermissionInviteUsers, func() (err error) {
+		link, err = a.Bot.ExportChatInviteLink(ctx, &ExportChatInviteLinkRequest{ChatId: chatId})
+		return err
+	})
+	return link, err
+}
+
+// do checks the permission and calls the action, the cache of the chat is dropped if the bot rights have changed
+func (a *Admin) do(ctx context.Context, chatId int, permission Permission, action func() error) error {
+	if err := a.Check(ctx, chatId, permission); err != nil {
+		return err
+	}
+	err := action()
+	if response := ErrorResponse(err); response != nil &&
+		(strings.Contains(response.Description, "not enough rights") || strings.Contains(response.Description, "CHAT_ADMIN_REQUIRED")) {
+		a.Invalidate(chatId)
+	}
+	return err
+}
+
+// cached returns members of the chat from the cache, or loads them: concurrent calls for the chat wait for one load
+func (a *Admin) cached(ctx context.Context, chatId int, admins bool, load func(ctx context.Context) ([]*ChatMember, error)) ([]*ChatMember, error) {
+	a.mu.Lock()
+	cache := &a.chats
+	if admins {
+		cache = &a.admins
+	}
+	if *cache == nil {
+		*cache = make(map[int]*adminChat)
+	}
+	if item, ok := (*cache)[chatId]; ok && now().Before(item.expires) {
+		a.mu.Unlock()
+		return item.members, nil
+	}
+	key := adminLoadKey{chatId: chatId, admins: admins}
+	if call, ok := a.loads[key]; ok {
+		a.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.members, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if a.loads == nil {
+		a.loads = make(map[adminLoadKey]*adminLoad)
+	}
+	call := &adminLoad{done: make(chan struct{})}
+	a.loads[key] = call
+	a.mu.Unlock()
+
+	call.members, call.err = load(ctx)
+	ttl := a.TTL
+	if ttl <= 0 {
+		ttl = DefaultAdminCacheTTL
+	}
+	a.mu.Lock()
+	// the load, dropped by the Invalidate, is not cached
+	if a.loads[key] == call {
+		delete(a.loads, key)
+		if call.err == nil {
+			(*cache)[chatId] = &adminChat{members: call.members, expires: now().Add(ttl)}
+		}
+	}
+	a.mu.Unlock()
+	close(call.done)
+	return call.members, call.err
+}
+
+func (a *Admin) getMe(ctx context.Context) (*User, error) {
+	a.mu.Lock()
+	me := a.me
+	a.mu.Unlock()
+	if me != nil {
+		return me, nil
+	}
+	me, err := a.Bot.GetMe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.me = me
+	a.mu.Unlock()
+	return me, nil
+}
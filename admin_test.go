@@ -0,0 +1,149 @@
+package tg_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestChatMember_Can(t *testing.T) {
+	tests := []struct {
+		member     *tg.ChatMember
+		permission tg.Permission
+		want       bool
+	}{
+		{member: &tg.ChatMember{Status: "creator"}, permission: tg.PermissionPromoteMembers, want: true},
+		{member: &tg.ChatMember{Status: "administrator", CanPinMessages: true}, permission: tg.PermissionPinMessages, want: true},
+		{member: &tg.ChatMember{Status: "administrator", CanPinMessages: true}, permission: tg.PermissionChangeInfo, want: false},
+		{member: &tg.ChatMember{Status: "member", CanSendMessages: true}, permission: tg.PermissionRestrictMembers, want: false},
+		{member: &tg.ChatMember{Status: "administrator", CanInviteUsers: true}, permission: tg.Permission("can_fly"), want: false},
+		{member: nil, permission: tg.PermissionPinMessages, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.member.Can(tt.permission); got != tt.want {
+			t.Errorf("Can(%v, %v) = %v, want %v", tt.member, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestAdmin_ConcurrentLoad(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true})
+	admin := tg.NewAdmin(server.Bot())
+	if _, err := admin.Member(context.Background(), -1); err != nil {
+		t.Fatalf("Member() error = %v", err)
+	}
+	server.Reset()
+	admin.Invalidate(-1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := admin.Check(context.Background(), -1, tg.PermissionRestrictMembers); err != nil {
+				t.Errorf("Check() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := server.CallsTo("getChatMember"); len(calls) != 1 {
+		t.Errorf("getChatMember calls = %d, want 1", len(calls))
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true})
+	server.AddMember(-1, &tg.ChatMember{User: &tg.User{Id: 5}, Status: "member"})
+	admin := tg.NewAdmin(server.Bot())
+
+	if err := admin.Mute(ctx, -1, 5, time.Hour); err != nil {
+		t.Fatalf("Mute() error = %v", err)
+	}
+	if member := server.Member(-1, 5); !member.IsRestricted() || member.CanSendMessages || member.UntilDate == 0 {
+		t.Errorf("muted member = %+v", member)
+	}
+	if err := admin.Unmute(ctx, -1, 5); err != nil {
+		t.Fatalf("Unmute() error = %v", err)
+	}
+	if member := server.Member(-1, 5); member.IsRestricted() {
+		t.Errorf("unmuted member = %+v", member)
+	}
+
+	err := admin.Pin(ctx, &tg.PinChatMessageRequest{ChatId: -1, MessageId: 1})
+	if permission, ok := err.(*tg.PermissionError); !ok || permission.Permission != tg.PermissionPinMessages || permission.ChatId != -1 {
+		t.Errorf("Pin() error = %v", err)
+	}
+	if err.Error() != "missing permission can_pin_messages in chat -1" {
+		t.Errorf("Error() = %v", err)
+	}
+	if calls := server.CallsTo("pinChatMessage"); len(calls) != 0 {
+		t.Errorf("pinChatMessage was called without the permission")
+	}
+
+	if err = admin.Kick(ctx, -1, 5); err != nil {
+		t.Fatalf("Kick() error = %v", err)
+	}
+	if member := server.Member(-1, 5); member.IsKicked() || member.IsChatMember() {
+		t.Errorf("kicked member = %+v", member)
+	}
+	// the failed unban is retried
+	server.Fail("unbanChatMember", tgtest.BadRequest("temporary failure"))
+	if err = admin.Kick(ctx, -1, 5); err != nil {
+		t.Fatalf("Kick() with the failed unban error = %v", err)
+	}
+	if member := server.Member(-1, 5); member.IsKicked() {
+		t.Errorf("kicked member = %+v", member)
+	}
+	for i := 0; i < tg.KickUnbanAttempts; i++ {
+		server.Fail("unbanChatMember", tgtest.BadRequest("temporary failure"))
+	}
+	err = admin.Kick(ctx, -1, 5)
+	if kick, ok := err.(*tg.KickError); !ok || kick.ChatId != -1 || kick.UserId != 5 || tg.ErrorResponse(kick.Err) == nil {
+		t.Errorf("Kick() error = %v", err)
+	}
+	if member := server.Member(-1, 5); !member.IsKicked() {
+		t.Errorf("member after the failed unban = %+v", member)
+	}
+	if err = admin.Unban(ctx, -1, 5); err != nil {
+		t.Fatalf("Unban() error = %v", err)
+	}
+	if err = admin.Ban(ctx, -1, 5, 0); err != nil {
+		t.Fatalf("Ban() error = %v", err)
+	}
+	if member := server.Member(-1, 5); !member.IsKicked() {
+		t.Errorf("banned member = %+v", member)
+	}
+	if calls := server.CallsTo("getChatMember"); len(calls) != 1 {
+		t.Errorf("bot member is not cached: %d calls", len(calls))
+	}
+
+	// the bot is promoted, the cache is dropped
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanChangeInfo: true})
+	if err = admin.SetTitle(ctx, -1, "New title"); err == nil {
+		t.Errorf("SetTitle() with the cached member error = nil")
+	}
+	admin.Invalidate(-1)
+	if err = admin.SetTitle(ctx, -1, "New title"); err != nil {
+		t.Fatalf("SetTitle() error = %v", err)
+	}
+	if chat := server.Chat(-1); chat.Title != "New title" {
+		t.Errorf("Title = %v", chat.Title)
+	}
+	if ok, err := admin.IsAdmin(ctx, -1, server.Me().Id); err != nil || !ok {
+		t.Errorf("IsAdmin() = %v, %v", ok, err)
+	}
+	if ok, err := admin.IsAdmin(ctx, -1, 5); err != nil || ok {
+		t.Errorf("IsAdmin() = %v, %v", ok, err)
+	}
+}
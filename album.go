@@ -0,0 +1,170 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxAlbumSize is a maximal number of items in the media group
+	MaxAlbumSize = 10
+	// DefaultAlbumDelay is a default quiet period, after which the album is considered complete
+	DefaultAlbumDelay = time.Second
+)
+
+// Album is a media group: messages with the same MediaGroupId, ordered by the MessageId
+type Album struct {
+	ChatId       int
+	MediaGroupId string
+	Messages     []*Message
+}
+
+// AlbumHandler handles the complete album
+type AlbumHandler func(ctx context.Context, album *Album) error
+
+// Albums aggregates messages of the media groups into albums.
+// Album is emitted after the quiet period without the new items, or immediately when MaxAlbumSize items are received.
+// Messages are buffered per chat, so Albums is safe for concurrent workers and webhook requests.
+//
+// Buffered messages are acknowledged immediately, album is emitted from the separate goroutine
+// if it is completed by the quiet period.
+type Albums struct {
+	// Handler of the complete albums
+	Handler AlbumHandler
+	// Delay is a quiet period, DefaultAlbumDelay is used if empty
+	Delay time.Duration
+	// OnError is called when the Handler returns an error for the album, emitted after the quiet period
+	OnError func(album *Album, err error)
+
+	mu     sync.Mutex
+	groups map[string]*albumGroup
+	wg     sync.WaitGroup
+}
+
+type albumGroup struct {
+	album *Album
+	timer *time.Timer
+}
+
+// NewAlbums creates the aggregator with the default quiet period
+func NewAlbums(handler AlbumHandler) *Albums {
+	return &Albums{
+		Handler: handler,
+		Delay:   DefaultAlbumDelay,
+	}
+}
+
+// Middleware returns the Middleware, that buffers messages and channel posts with the MediaGroupId,
+// other updates are passed to the next handler
+func (a *Albums) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			message := update.Message
+			if message == nil {
+				message = update.ChannelPost
+			}
+			if message == nil || message.MediaGroupId == "" {
+				return next.Handle(ctx, update)
+			}
+			return a.Add(ctx, message)
+		})
+	}
+}
+
+// Add buffers the message of the media group, if it completes the album, Handler is called with the ctx
+func (a *Albums) Add(ctx context.Context, message *Message) error {
+	if album := a.add(message); album != nil {
+		return a.Handler(ctx, album)
+	}
+	return nil
+}
+
+// Flush emits all buffered albums and waits for albums, emitted after the quiet period
+func (a *Albums) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	groups := a.groups
+	a.groups = nil
+	a.mu.Unlock()
+
+	var result error
+	for _, group := range groups {
+		if group.timer.Stop() {
+			a.wg.Done()
+			if err := a.Handler(ctx, group.album); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	a.wg.Wait()
+	return result
+}
+
+func (a *Albums) add(message *Message) *Album {
+	key := fmt.Sprintf("%d:%s", message.ChatId(), message.MediaGroupId)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.groups == nil {
+		a.groups = make(map[string]*albumGroup)
+	}
+	group, ok := a.groups[key]
+	if ok && !group.timer.Stop() {
+		// timer has already fired and the album is being emitted, so the message starts the new one
+		ok = false
+	}
+	if !ok {
+		group = &albumGroup{
+			album: &Album{
+				ChatId:       message.ChatId(),
+				MediaGroupId: message.MediaGroupId,
+			},
+		}
+		a.groups[key] = group
+		a.wg.Add(1)
+	}
+
+	for _, item := range group.album.Messages {
+		if item.MessageId == message.MessageId {
+			a.start(key, group)
+			return nil
+		}
+	}
+	group.album.Messages = append(group.album.Messages, message)
+	sort.Slice(group.album.Messages, func(i, j int) bool {
+		return group.album.Messages[i].MessageId < group.album.Messages[j].MessageId
+	})
+	if len(group.album.Messages) < MaxAlbumSize {
+		a.start(key, group)
+		return nil
+	}
+	delete(a.groups, key)
+	a.wg.Done()
+	return group.album
+}
+
+func (a *Albums) start(key string, group *albumGroup) {
+	group.timer = time.AfterFunc(a.delay(), func() {
+		a.expire(key, group)
+	})
+}
+
+func (a *Albums) expire(key string, group *albumGroup) {
+	defer a.wg.Done()
+	a.mu.Lock()
+	if a.groups[key] == group {
+		delete(a.groups, key)
+	}
+	a.mu.Unlock()
+	if err := a.Handler(context.Background(), group.album); err != nil && a.OnError != nil {
+		a.OnError(group.album, err)
+	}
+}
+
+func (a *Albums) delay() time.Duration {
+	if a.Delay > 0 {
+		return a.Delay
+	}
+	return DefaultAlbumDelay
+}
@@ -0,0 +1,89 @@
+package tg
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func albumUpdate(chatId, messageId int, group string) *Update {
+	return &Update{Message: &Message{MessageId: messageId, Chat: &Chat{Id: chatId}, MediaGroupId: group}}
+}
+
+func TestAlbums_Delay(t *testing.T) {
+	var mu sync.Mutex
+	var albums []*Album
+	aggregator := NewAlbums(func(ctx context.Context, album *Album) error {
+		mu.Lock()
+		defer mu.Unlock()
+		albums = append(albums, album)
+		return nil
+	})
+	aggregator.Delay = 20 * time.Millisecond
+	passed := 0
+	handler := aggregator.Middleware()(HandlerFunc(func(ctx context.Context, update *Update) error {
+		passed++
+		return nil
+	}))
+
+	ctx := context.Background()
+	for _, update := range []*Update{
+		albumUpdate(1, 3, "a"),
+		albumUpdate(1, 2, "a"),
+		albumUpdate(2, 2, "a"),
+		albumUpdate(1, 4, ""),
+		albumUpdate(1, 2, "a"),
+	} {
+		if err := handler.Handle(ctx, update); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+	if err := aggregator.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if passed != 1 {
+		t.Errorf("Handle() passed = %d, want 1", passed)
+	}
+	if len(albums) != 2 {
+		t.Fatalf("albums = %d, want 2", len(albums))
+	}
+	for _, album := range albums {
+		if album.ChatId == 1 && (len(album.Messages) != 2 || album.Messages[0].MessageId != 2) {
+			t.Errorf("album = %+v", album)
+		}
+	}
+
+	albums = nil
+	_ = handler.Handle(ctx, albumUpdate(1, 5, "b"))
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if len(albums) != 1 || albums[0].MediaGroupId != "b" {
+		t.Errorf("albums after delay = %+v", albums)
+	}
+	mu.Unlock()
+}
+
+func TestAlbums_MaxSize(t *testing.T) {
+	var albums []*Album
+	aggregator := NewAlbums(func(ctx context.Context, album *Album) error {
+		albums = append(albums, album)
+		return nil
+	})
+	aggregator.Delay = time.Hour
+	ctx := context.Background()
+	for id := MaxAlbumSize; id > 0; id-- {
+		if err := aggregator.Add(ctx, albumUpdate(1, id, "a").Message); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if len(albums) != 1 || len(albums[0].Messages) != MaxAlbumSize || albums[0].Messages[0].MessageId != 1 {
+		t.Fatalf("albums = %+v", albums)
+	}
+	if err := aggregator.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if len(albums) != 1 {
+		t.Errorf("albums after Flush() = %d", len(albums))
+	}
+}
@@ -0,0 +1,164 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var AskTimeout = errors.New("no reply before timeout")
+
+// Asker sends questions and waits for replies of the users.
+// Replies are intercepted and routed to the waiting Ask calls instead of the handlers.
+// With the Dispatcher, Asker should be added to its Interceptors, so the reply is taken before it is queued.
+// Ask releases the Dispatcher worker while waiting, see Release: the update of the question is considered processed,
+// and other updates of the worker are handled.
+//
+//	asker := tg.NewAsker(bot)
+//	dispatcher := tg.NewDispatcher(handler)
+//	dispatcher.Interceptors = append(dispatcher.Interceptors, asker)
+type Asker struct {
+	Bot *Bot
+
+	mu      sync.Mutex
+	waiters map[askKey][]*askWaiter
+}
+
+type askKey struct {
+	chatId int
+	userId int
+}
+
+type askWaiter struct {
+	messageId int
+	reply     chan *Message
+}
+
+// NewAsker creates the asker
+func NewAsker(bot *Bot) *Asker {
+	return &Asker{
+		Bot:     bot,
+		waiters: make(map[askKey][]*askWaiter),
+	}
+}
+
+// Intercept implements the Interceptor
+func (a *Asker) Intercept(update *Update) bool {
+	return a.deliver(update.Message)
+}
+
+// Middleware returns the Middleware, that intercepts awaited replies, e.g. for the Webhook without the Dispatcher
+func (a *Asker) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			if a.deliver(update.Message) {
+				return nil
+			}
+			return next.Handle(ctx, update)
+		})
+	}
+}
+
+// Ask sends the question with the ForceReply to the chat and user of the update and waits for the reply.
+// Reply is the message, that replies to the question, or the next message of the user in the chat.
+// AskTimeout is returned if there is no reply before the timeout.
+func (a *Asker) Ask(ctx context.Context, update *Update, question string, timeout time.Duration) (*Message, error) {
+	return a.AskRequest(ctx, update.UserId(), &SendMessageRequest{
+		ChatId:      update.ChatId(),
+		Text:        question,
+		ReplyMarkup: &ForceReply{ForceReply: true, Selective: true},
+	}, timeout)
+}
+
+// AskRequest sends the question request and waits for the reply of the user in the chat of the request
+func (a *Asker) AskRequest(ctx context.Context, userId int, request *SendMessageRequest, timeout time.Duration) (*Message, error) {
+	key := askKey{chatId: request.ChatId, userId: userId}
+	// waiter is registered before the question is sent, so the fast reply is not missed
+	waiter := &askWaiter{reply: make(chan *Message, 1)}
+	a.mu.Lock()
+	if a.waiters == nil {
+		a.waiters = make(map[askKey][]*askWaiter)
+	}
+	a.waiters[key] = append(a.waiters[key], waiter)
+	a.mu.Unlock()
+	defer a.remove(key, waiter)
+
+	question, err := a.Bot.SendMessage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	waiter.messageId = question.MessageId
+	a.mu.Unlock()
+	Release(ctx)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-waiter.reply:
+		return reply, nil
+	case <-timer.C:
+		return nil, AskTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Waiting returns the number of the Ask calls, waiting for replies
+func (a *Asker) Waiting() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	count := 0
+	for _, waiters := range a.waiters {
+		count += len(waiters)
+	}
+	return count
+}
+
+// deliver passes the message to the waiter of its chat and user: the waiter of the replied question,
+// or the oldest one
+func (a *Asker) deliver(message *Message) bool {
+	if message == nil || message.Chat == nil || message.From == nil {
+		return false
+	}
+	key := askKey{chatId: message.Chat.Id, userId: message.From.Id}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	waiters := a.waiters[key]
+	if len(waiters) == 0 {
+		return false
+	}
+	index := 0
+	if message.ReplyToMessage != nil {
+		for i, waiter := range waiters {
+			if waiter.messageId == message.ReplyToMessage.MessageId {
+				index = i
+				break
+			}
+		}
+	}
+	waiters[index].reply <- message
+	a.removeAt(key, index)
+	return true
+}
+
+func (a *Asker) remove(key askKey, waiter *askWaiter) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, item := range a.waiters[key] {
+		if item == waiter {
+			a.removeAt(key, i)
+			return
+		}
+	}
+}
+
+func (a *Asker) removeAt(key askKey, index int) {
+	waiters := append(a.waiters[key][:index:index], a.waiters[key][index+1:]...)
+	if len(waiters) == 0 {
+		delete(a.waiters, key)
+	} else {
+		a.waiters[key] = waiters
+	}
+}
@@ -0,0 +1,176 @@
+package tg_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestAsker_Ask(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	asker := tg.NewAsker(bot)
+	ctx := context.Background()
+
+	replies := make(chan *tg.Message, 1)
+	dispatcher := tg.NewDispatcher(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		if update.Message.Text != "/name" {
+			return nil
+		}
+		reply, err := asker.Ask(ctx, update, "What is your name?", time.Second)
+		if err != nil {
+			return err
+		}
+		replies <- reply
+		return nil
+	}))
+	dispatcher.Interceptors = []tg.Interceptor{asker}
+	defer dispatcher.Stop(ctx)
+
+	poller := tg.NewPoller(bot, dispatcher, nil)
+	poller.Timeout = -1
+	poller.RetryDelay = 10 * time.Millisecond
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = poller.Run(runCtx)
+	}()
+
+	user := &tg.User{Id: 2}
+	chat := &tg.Chat{Id: 1}
+	server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: chat, From: user, Text: "/name"}})
+	for asker.Waiting() == 0 || server.LastCall("sendMessage") == nil {
+		time.Sleep(time.Millisecond)
+	}
+	// message of the other user is not a reply
+	server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: chat, From: &tg.User{Id: 3}, Text: "Bob"}})
+	server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: chat, From: user, Text: "Alice"}})
+	select {
+	case reply := <-replies:
+		if reply.Text != "Alice" {
+			t.Errorf("Ask() = %v", reply.Text)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Ask() has not returned")
+	}
+	if asker.Waiting() != 0 {
+		t.Errorf("Waiting() = %d", asker.Waiting())
+	}
+}
+
+func TestAsker_Workers(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	asker := tg.NewAsker(bot)
+	ctx := context.Background()
+
+	// more waiting handlers than workers
+	const waiters = 6
+	replies := make(chan string, waiters)
+	dispatcher := tg.NewDispatcher(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		reply, err := asker.Ask(ctx, update, "What is your name?", 5*time.Second)
+		if err != nil {
+			replies <- err.Error()
+			return err
+		}
+		replies <- reply.Text
+		return nil
+	}))
+	dispatcher.Workers = 2
+	dispatcher.Interceptors = []tg.Interceptor{asker}
+	defer dispatcher.Stop(ctx)
+
+	for i := 1; i <= waiters; i++ {
+		update := &tg.Update{UpdateId: i, Message: &tg.Message{Chat: &tg.Chat{Id: i}, From: &tg.User{Id: i}, Text: "/name"}}
+		if err := dispatcher.Handle(ctx, update); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+	if asker.Waiting() != waiters {
+		t.Fatalf("Waiting() = %d, want %d", asker.Waiting(), waiters)
+	}
+	for i := 1; i <= waiters; i++ {
+		update := &tg.Update{UpdateId: waiters + i, Message: &tg.Message{Chat: &tg.Chat{Id: i}, From: &tg.User{Id: i}, Text: "Alice"}}
+		if err := dispatcher.Dispatch(ctx, update); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+	for i := 0; i < waiters; i++ {
+		select {
+		case reply := <-replies:
+			if reply != "Alice" {
+				t.Errorf("Ask() = %v", reply)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Ask() has not returned")
+		}
+	}
+}
+
+func TestAsker_Timeout(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	asker := tg.NewAsker(server.Bot())
+	update := &tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: 1}, From: &tg.User{Id: 2}}}
+	if _, err := asker.Ask(context.Background(), update, "question", 10*time.Millisecond); err != tg.AskTimeout {
+		t.Errorf("Ask() error = %v, want AskTimeout", err)
+	}
+	if asker.Waiting() != 0 {
+		t.Errorf("Waiting() = %d", asker.Waiting())
+	}
+}
+
+func TestAsker_ReplyTo(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	asker := tg.NewAsker(server.Bot())
+	ctx := context.Background()
+	update := &tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: 1}, From: &tg.User{Id: 2}}}
+
+	results := make(map[string]chan string)
+	for _, question := range []string{"first", "second"} {
+		result := make(chan string, 1)
+		results[question] = result
+		go func(question string) {
+			reply, err := asker.Ask(ctx, update, question, time.Second)
+			if err != nil {
+				result <- err.Error()
+				return
+			}
+			result <- reply.Text
+		}(question)
+		for len(server.CallsTo("sendMessage")) != len(results) || asker.Waiting() != len(results) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// question identifiers are assigned after the SendMessage call returns
+	time.Sleep(20 * time.Millisecond)
+	second := server.LastCall("sendMessage")
+	messages := server.Messages(1)
+	var target *tg.Message
+	for _, message := range messages {
+		if message.Text == "second" {
+			target = message
+		}
+	}
+	if second == nil || target == nil {
+		t.Fatalf("question is not sent")
+	}
+	handler := asker.Middleware()(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		t.Errorf("reply should be intercepted")
+		return nil
+	}))
+	_ = handler.Handle(ctx, &tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: 1}, From: &tg.User{Id: 2}, Text: "to second", ReplyToMessage: target}})
+	_ = handler.Handle(ctx, &tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: 1}, From: &tg.User{Id: 2}, Text: "to first"}})
+	if got := <-results["second"]; got != "to second" {
+		t.Errorf("Ask(second) = %v", got)
+	}
+	if got := <-results["first"]; got != "to first" {
+		t.Errorf("Ask(first) = %v", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -21,16 +22,23 @@ type Bot struct {
 	Host  string
 	Log   Logger
 	Debug bool
-	token string
+	// Client is used for the API requests, default client is used if empty
+	Client *http.Client
+	// OnMigrate is called, when the group is upgraded to the supergroup, see MigrationMiddleware
+	OnMigrate func(ctx context.Context, from, to int)
+	token     string
 }
 
 // Response for default message
 type Response struct {
-	OK     bool            `json:"ok"`
-	Result json.RawMessage `json:"result"`
+	OK          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
 }
 
-// Error wrapper
+// Error wrapper of the failed API call, the Basic error is checked with errors.Is, e.g. InvalidStatusCode
 type Error struct {
 	Response *Response
 	Basic    error
@@ -57,6 +65,8 @@ func New(token string) *Bot {
 	}
 }
 
+// Request calls the API method.
+// Request is sent as is: the call for the group, upgraded to the supergroup, is not repeated, see MigrateToChatId.
 func (b *Bot) Request(ctx context.Context, action string, body interface{}) (result []byte, err error) {
 	defer func(start time.Time) {
 		b.debug("[STOP ] POST request: %s [%0.5fs]", action, float64(time.Since(start))/float64(time.Second))
@@ -93,6 +103,54 @@ func (b *Bot) post(ctx context.Context, action string, body interface{}) (*http.
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	return b.send(ctx, req)
+}
+
+// postFile calls the API method with the multipart form, data is sent as the file in the field
+func (b *Bot) postFile(ctx context.Context, action string, fields map[string]string, field, name string, data []byte, result interface{}) error {
+	defer func(start time.Time) {
+		b.debug("[STOP ] POST file: %s [%0.5fs]", action, float64(time.Since(start))/float64(time.Second))
+	}(time.Now())
+	b.debug("[START] POST file: %s", action)
+	target, err := url.Parse(fmt.Sprintf("%s/bot%s/%s", b.Host, b.token, action))
+	if err != nil {
+		return err
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	writer := multipart.NewWriter(buffer)
+	for key, value := range fields {
+		if err = writer.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	part, err := writer.CreateFormFile(field, name)
+	if err != nil {
+		return err
+	}
+	if _, err = part.Write(data); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target.String(), buffer)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	response, err := b.send(ctx, req)
+	if response != nil {
+		defer b.closer(response.Body, "response body")
+	}
+	if err != nil {
+		return err
+	}
+	return b.parse(response, &result)
+}
+
+func (b *Bot) send(ctx context.Context, req *http.Request) (*http.Response, error) {
 	req = req.WithContext(ctx)
 	if b.Debug {
 		dump, err := httputil.DumpRequest(req, true)
@@ -101,7 +159,14 @@ func (b *Bot) post(ctx context.Context, action string, body interface{}) (*http.
 		}
 		b.Log("DUMP\n%s", string(dump))
 	}
-	return new(http.Client).Do(req)
+	return b.client().Do(req)
+}
+
+func (b *Bot) client() *http.Client {
+	if b.Client == nil {
+		return new(http.Client)
+	}
+	return b.Client
 }
 
 func (b *Bot) closer(closer io.Closer, scope string) {
@@ -112,7 +177,19 @@ func (b *Bot) closer(closer io.Closer, scope string) {
 	}
 }
 
+// postResult calls the API method, call for the group, upgraded to the supergroup, is repeated once for the new chat
 func (b *Bot) postResult(ctx context.Context, action string, body interface{}, result interface{}) error {
+	err := b.postOnce(ctx, action, body, result)
+	if to := MigrateToChatId(err); to != 0 {
+		if migrated, from, ok := migrateRequest(body, to); ok {
+			b.migrate(ctx, from, to)
+			return b.postOnce(ctx, action, migrated, result)
+		}
+	}
+	return err
+}
+
+func (b *Bot) postOnce(ctx context.Context, action string, body interface{}, result interface{}) error {
 	defer func(start time.Time) {
 		b.debug("[STOP ] POST request: %s [%0.5fs]", action, float64(time.Since(start))/float64(time.Second))
 	}(time.Now())
@@ -134,7 +211,14 @@ func (b *Bot) parse(response *http.Response, object interface{}) error {
 	}
 	if response.StatusCode != http.StatusOK {
 		b.Log("invalid status code: %d // %s", response.StatusCode, string(data))
-		return InvalidStatusCode
+		result := new(Response)
+		if json.Unmarshal(data, result) != nil {
+			result = &Response{ErrorCode: response.StatusCode}
+		}
+		return &Error{
+			Basic:    InvalidStatusCode,
+			Response: result,
+		}
 	}
 	b.debug("response: %s", data)
 	result := new(Response)
@@ -162,5 +246,13 @@ func (b *Bot) debug(format string, v ...interface{}) {
 }
 
 func (e Error) Error() string {
+	if e.Response != nil && e.Response.Description != "" {
+		return fmt.Sprintf("%s: %d %s", e.Basic, e.Response.ErrorCode, e.Response.Description)
+	}
 	return e.Basic.Error()
 }
+
+// Unwrap returns the basic error, e.g. InvalidStatusCode or WrongResponse
+func (e Error) Unwrap() error {
+	return e.Basic
+}
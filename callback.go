@@ -0,0 +1,201 @@
+package tg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// MaxCallbackDataLength is a maximal length of the callback data of the inline keyboard button
+	MaxCallbackDataLength = 64
+	// callbackSignatureLength is a length of the truncated HMAC signature in the callback data
+	callbackSignatureLength = 6
+)
+
+var (
+	InvalidCallbackData      = errors.New("invalid callback data")
+	InvalidCallbackSignature = errors.New("invalid callback data signature")
+	CallbackDataTooLong      = errors.New("callback data is too long")
+)
+
+type callbackContextKey struct{}
+
+// callbackState is shared between the CallbackMiddleware and the answer calls of the handler
+type callbackState struct {
+	answered int32
+}
+
+// CallbackMiddleware returns the Middleware, that answers the callback query with the empty acknowledgement,
+// if the handler has not answered it. Successful Answer, Toast and Alert calls with the handler context count as the answer.
+func (b *Bot) CallbackMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) (err error) {
+			if update.CallbackQuery == nil {
+				return next.Handle(ctx, update)
+			}
+			state := new(callbackState)
+			defer func() {
+				if atomic.LoadInt32(&state.answered) != 0 {
+					return
+				}
+				_, aerr := b.AnswerCallbackQuery(ctx, &AnswerCallbackQueryRequest{CallbackQueryId: update.CallbackQuery.Id})
+				if err == nil {
+					err = aerr
+				}
+			}()
+			return next.Handle(context.WithValue(ctx, callbackContextKey{}, state), update)
+		})
+	}
+}
+
+// Answer answers the callback query, the query of the CallbackMiddleware is marked as answered on success
+func (b *Bot) Answer(ctx context.Context, request *AnswerCallbackQueryRequest) error {
+	if _, err := b.AnswerCallbackQuery(ctx, request); err != nil {
+		return err
+	}
+	if state, ok := ctx.Value(callbackContextKey{}).(*callbackState); ok {
+		atomic.StoreInt32(&state.answered, 1)
+	}
+	return nil
+}
+
+// Toast answers the callback query with the notification at the top of the chat screen
+func (b *Bot) Toast(ctx context.Context, query *CallbackQuery, text string) error {
+	return b.Answer(ctx, &AnswerCallbackQueryRequest{CallbackQueryId: query.Id, Text: text})
+}
+
+// Alert answers the callback query with the alert, that user should close
+func (b *Bot) Alert(ctx context.Context, query *CallbackQuery, text string) error {
+	return b.Answer(ctx, &AnswerCallbackQueryRequest{CallbackQueryId: query.Id, Text: text, ShowAlert: true})
+}
+
+// EditCallbackText edits the text of the message, that originated the callback query.
+// Chat, message and inline message identifiers of the request are filled from the query.
+func (b *Bot) EditCallbackText(ctx context.Context, query *CallbackQuery, request *EditMessageTextRequest) error {
+	request.ChatId, request.MessageId, request.InlineMessageId = query.target()
+	// result is the Message or True for the inline messages
+	var result json.RawMessage
+	return b.postResult(ctx, "editMessageText", request, &result)
+}
+
+// EditCallbackKeyboard replaces the inline keyboard of the message, that originated the callback query
+func (b *Bot) EditCallbackKeyboard(ctx context.Context, query *CallbackQuery, markup *InlineKeyboardMarkup) error {
+	request := &EditMessageReplyMarkupRequest{ReplyMarkup: markup}
+	request.ChatId, request.MessageId, request.InlineMessageId = query.target()
+	var result json.RawMessage
+	return b.postResult(ctx, "editMessageReplyMarkup", request, &result)
+}
+
+// RemoveCallbackKeyboard removes the inline keyboard of the message, that originated the callback query
+func (b *Bot) RemoveCallbackKeyboard(ctx context.Context, query *CallbackQuery) error {
+	return b.EditCallbackKeyboard(ctx, query, nil)
+}
+
+// target returns identifiers of the message, that originated the query
+func (q *CallbackQuery) target() (chatId, messageId int, inlineMessageId string) {
+	if q.InlineMessageId != "" {
+		return 0, 0, q.InlineMessageId
+	}
+	if q.Message != nil {
+		return q.Message.ChatId(), q.Message.MessageId, ""
+	}
+	return 0, 0, ""
+}
+
+// CallbackCodec encodes typed payloads into the callback data in the format "<name>:<version>:<signature>:<json>".
+// Name routes the payload to its handler, version allows to change the payload structure
+// while old keyboards are still in chats.
+type CallbackCodec struct {
+	// Secret signs the callback data, data is not signed if empty
+	Secret []byte
+	// Version of the encoded payloads
+	Version int
+}
+
+// CallbackData is a decoded callback data
+type CallbackData struct {
+	Name    string
+	Version int
+	Payload json.RawMessage
+}
+
+// NewCallbackCodec creates the codec with the given secret and payload version
+func NewCallbackCodec(secret []byte, version int) *CallbackCodec {
+	return &CallbackCodec{
+		Secret:  secret,
+		Version: version,
+	}
+}
+
+// Encode encodes the payload v with the name, CallbackDataTooLong is returned if data exceeds MaxCallbackDataLength
+func (c *CallbackCodec) Encode(name string, v interface{}) (string, error) {
+	if name == "" || strings.Contains(name, ":") {
+		return "", InvalidCallbackData
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	prefix := name + ":" + strconv.Itoa(c.Version)
+	data := prefix + ":" + c.sign(prefix, payload) + ":" + string(payload)
+	if len(data) > MaxCallbackDataLength {
+		return "", CallbackDataTooLong
+	}
+	return data, nil
+}
+
+// Button returns the inline keyboard button with the encoded callback data
+func (c *CallbackCodec) Button(text, name string, v interface{}) (*InlineKeyboardButton, error) {
+	data, err := c.Encode(name, v)
+	if err != nil {
+		return nil, err
+	}
+	return &InlineKeyboardButton{Text: text, CallbackData: data}, nil
+}
+
+// Parse parses and verifies the callback data, payload is decoded with CallbackData.Decode
+func (c *CallbackCodec) Parse(data string) (*CallbackData, error) {
+	parts := strings.SplitN(data, ":", 4)
+	if len(parts) != 4 {
+		return nil, InvalidCallbackData
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, InvalidCallbackData
+	}
+	payload := []byte(parts[3])
+	if !hmac.Equal([]byte(parts[2]), []byte(c.sign(parts[0]+":"+parts[1], payload))) {
+		return nil, InvalidCallbackSignature
+	}
+	return &CallbackData{
+		Name:    parts[0],
+		Version: version,
+		Payload: payload,
+	}, nil
+}
+
+// Decode decodes the payload into the v
+func (d *CallbackData) Decode(v interface{}) error {
+	if err := json.Unmarshal(d.Payload, v); err != nil {
+		return InvalidCallbackData
+	}
+	return nil
+}
+
+func (c *CallbackCodec) sign(prefix string, payload []byte) string {
+	if len(c.Secret) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte(prefix))
+	mac.Write([]byte{':'})
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSignatureLength])
+}
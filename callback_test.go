@@ -0,0 +1,154 @@
+package tg_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestBot_CallbackMiddleware(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		handler tg.HandlerFunc
+		text    string
+		wantErr bool
+	}{
+		{
+			name:    "forgotten",
+			handler: func(ctx context.Context, update *tg.Update) error { return nil },
+		},
+		{
+			name: "toast",
+			handler: func(ctx context.Context, update *tg.Update) error {
+				return bot.Toast(ctx, update.CallbackQuery, "done")
+			},
+			text: "done",
+		},
+		{
+			name:    "failed",
+			handler: func(ctx context.Context, update *tg.Update) error { return errors.New("failed") },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.Reset()
+			update := &tg.Update{CallbackQuery: &tg.CallbackQuery{Id: "query", From: &tg.User{Id: 1}}}
+			err := bot.CallbackMiddleware()(tt.handler).Handle(ctx, update)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			calls := server.CallsTo("answerCallbackQuery")
+			if len(calls) != 1 {
+				t.Fatalf("answerCallbackQuery calls = %d, want 1", len(calls))
+			}
+			request := new(tg.AnswerCallbackQueryRequest)
+			if err = calls[0].Decode(request); err != nil || request.CallbackQueryId != "query" || request.Text != tt.text {
+				t.Errorf("answerCallbackQuery request = %+v, %v", request, err)
+			}
+		})
+	}
+}
+
+func TestBot_CallbackMiddleware_FailedAnswer(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	// the failed answer doesn't count, so the query is acknowledged by the middleware
+	server.Fail("answerCallbackQuery", tgtest.BadRequest("query is too old"))
+	handler := bot.CallbackMiddleware()(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		_ = bot.Toast(ctx, update.CallbackQuery, "done")
+		return nil
+	}))
+	if err := handler.Handle(ctx, &tg.Update{CallbackQuery: &tg.CallbackQuery{Id: "query"}}); err != nil {
+		t.Errorf("Handle() error = %v", err)
+	}
+	if calls := server.CallsTo("answerCallbackQuery"); len(calls) != 2 {
+		t.Errorf("answerCallbackQuery calls = %d, want 2", len(calls))
+	}
+}
+
+func TestBot_EditCallback(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+	codec := tg.NewCallbackCodec(nil, 1)
+	button, _ := codec.Button("OK", "ok", nil)
+	message, err := bot.SendMessage(ctx, &tg.SendMessageRequest{
+		ChatId:      1,
+		Text:        "question",
+		ReplyMarkup: &tg.InlineKeyboardMarkup{InlineKeyboard: [][]*tg.InlineKeyboardButton{{button}}},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	query := &tg.CallbackQuery{Id: "query", Message: message}
+	if err = bot.RemoveCallbackKeyboard(ctx, query); err != nil {
+		t.Errorf("RemoveCallbackKeyboard() error = %v", err)
+	}
+	if err = bot.EditCallbackText(ctx, query, &tg.EditMessageTextRequest{Text: "answer"}); err != nil {
+		t.Errorf("EditCallbackText() error = %v", err)
+	}
+	if edited := server.Message(1, message.MessageId); edited.Text != "answer" || edited.ReplyMarkup != nil {
+		t.Errorf("edited message = %+v", edited)
+	}
+	inline := &tg.CallbackQuery{Id: "query", InlineMessageId: "inline"}
+	if err = bot.EditCallbackText(ctx, inline, &tg.EditMessageTextRequest{Text: "answer"}); err != nil {
+		t.Errorf("EditCallbackText() of inline message error = %v", err)
+	}
+}
+
+type vote struct {
+	Poll   int `json:"p"`
+	Option int `json:"o"`
+}
+
+func TestCallbackCodec(t *testing.T) {
+	codec := tg.NewCallbackCodec([]byte("secret"), 2)
+	data, err := codec.Encode("vote", &vote{Poll: 12345, Option: 3})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if len(data) > tg.MaxCallbackDataLength || !strings.HasPrefix(data, "vote:2:") {
+		t.Errorf("Encode() = %v", data)
+	}
+	parsed, err := codec.Parse(data)
+	if err != nil || parsed.Name != "vote" || parsed.Version != 2 {
+		t.Fatalf("Parse() = %+v, %v", parsed, err)
+	}
+	got := new(vote)
+	if err = parsed.Decode(got); err != nil || *got != (vote{Poll: 12345, Option: 3}) {
+		t.Errorf("Decode() = %+v, %v", got, err)
+	}
+
+	tampered := strings.Replace(data, `"o":3`, `"o":4`, 1)
+	if _, err = codec.Parse(tampered); err != tg.InvalidCallbackSignature {
+		t.Errorf("Parse() of tampered data error = %v", err)
+	}
+	if _, err = tg.NewCallbackCodec([]byte("other"), 2).Parse(data); err != tg.InvalidCallbackSignature {
+		t.Errorf("Parse() with other secret error = %v", err)
+	}
+	for _, data := range []string{"", "vote", "vote:x:sig:{}"} {
+		if _, err = codec.Parse(data); err != tg.InvalidCallbackData {
+			t.Errorf("Parse(%q) error = %v", data, err)
+		}
+	}
+	if _, err = codec.Encode("long", strings.Repeat("x", tg.MaxCallbackDataLength)); err != tg.CallbackDataTooLong {
+		t.Errorf("Encode() of long payload error = %v", err)
+	}
+	if _, err = codec.Encode("a:b", nil); err != tg.InvalidCallbackData {
+		t.Errorf("Encode() with invalid name error = %v", err)
+	}
+}
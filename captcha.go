@@ -0,0 +1,560 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCaptchaTimeout is a default time for the newcomer to solve the challenge
+	DefaultCaptchaTimeout = 2 * time.Minute
+	// DefaultCaptchaAttempts is a default number of attempts to solve the challenge
+	DefaultCaptchaAttempts = 3
+	// DefaultCaptchaKey is a default key of the pending challenges index in the Storage
+	DefaultCaptchaKey = "captcha"
+	// DefaultCaptchaRetryDelay is a default delay before the failed unmute or kick of the newcomer is retried
+	DefaultCaptchaRetryDelay = 10 * time.Second
+	// MaxOrderChallengeSize is a maximal number of buttons of the OrderChallenge
+	MaxOrderChallengeSize = 8
+	// captchaPrefix is a prefix of the callback data of the challenge buttons
+	captchaPrefix = "captcha:"
+)
+
+var InvalidChallenge = errors.New("challenge question has no answer or the answer is not in the options")
+
+// Challenge generates questions for newcomers, e.g. MathChallenge or OrderChallenge
+type Challenge interface {
+	Question(user *User) *ChallengeQuestion
+}
+
+// ChallengeQuestion is a question with options as the inline keyboard
+type ChallengeQuestion struct {
+	// Text of the question
+	Text string
+	// Options are rows of the keyboard buttons
+	Options [][]string
+	// Answer is a sequence of options, that should be pressed
+	Answer []string
+}
+
+// validate checks that the answer is not empty and every answer is one of the options
+func (q *ChallengeQuestion) validate() error {
+	if q == nil || len(q.Answer) == 0 {
+		return InvalidChallenge
+	}
+	options := make(map[string]bool)
+	for _, row := range q.Options {
+		for _, option := range row {
+			options[option] = true
+		}
+	}
+	for _, answer := range q.Answer {
+		if !options[answer] {
+			return InvalidChallenge
+		}
+	}
+	return nil
+}
+
+// MathChallenge asks to solve the sum of two numbers
+type MathChallenge struct{}
+
+// Question implements the Challenge
+func (MathChallenge) Question(*User) *ChallengeQuestion {
+	a, b := 1+rand.Intn(9), 1+rand.Intn(9)
+	answer := a + b
+	// distractors are on both sides of the answer, so the answer is not always the minimum
+	var deltas []int
+	for delta := -4; delta <= 4; delta++ {
+		if delta != 0 && answer+delta > 0 {
+			deltas = append(deltas, delta)
+		}
+	}
+	options := []string{strconv.Itoa(answer)}
+	for _, i := range rand.Perm(len(deltas))[:3] {
+		options = append(options, strconv.Itoa(answer+deltas[i]))
+	}
+	rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+	return &ChallengeQuestion{
+		Text:    fmt.Sprintf("How much is %d + %d?", a, b),
+		Options: [][]string{options},
+		Answer:  []string{strconv.Itoa(answer)},
+	}
+}
+
+// OrderChallenge asks to press the buttons with numbers in the ascending order
+type OrderChallenge struct {
+	// Size is a number of buttons, 4 is used if empty, MaxOrderChallengeSize is used if greater
+	Size int
+}
+
+// Question implements the Challenge
+func (c OrderChallenge) Question(*User) *ChallengeQuestion {
+	size := c.Size
+	if size <= 0 {
+		size = 4
+	} else if size > MaxOrderChallengeSize {
+		size = MaxOrderChallengeSize
+	}
+	answer := make([]string, 0, size)
+	for _, i := range rand.Perm(90)[:size] {
+		answer = append(answer, strconv.Itoa(i+10))
+	}
+	options := append([]string{}, answer...)
+	sort.Slice(answer, func(i, j int) bool { return answer[i] < answer[j] })
+	return &ChallengeQuestion{
+		Text:    "Press the buttons in the ascending order",
+		Options: [][]string{options},
+		Answer:  answer,
+	}
+}
+
+// CaptchaState is a pending challenge of the newcomer
+type CaptchaState struct {
+	ChatId    int      `json:"chat_id"`
+	UserId    int      `json:"user_id"`
+	JoinId    int      `json:"join_id,omitempty"`
+	MessageId int      `json:"message_id"`
+	Options   []string `json:"options"`
+	Answer    []string `json:"answer"`
+	Progress  int      `json:"progress"`
+	Attempts  int      `json:"attempts"`
+	// Solved or Rejected is set, when the challenge is finished, but the newcomer is not unmuted or kicked yet
+	Solved   bool `json:"solved,omitempty"`
+	Rejected bool `json:"rejected,omitempty"`
+	// Expires is a unix time in nanoseconds, when the challenge is rejected, or the finished challenge is retried
+	Expires int64 `json:"expires"`
+}
+
+// Captcha verifies new members of groups: the newcomer is restricted and the challenge is posted.
+// On success the restriction is lifted, on timeout or after failed attempts the newcomer is kicked,
+// and challenge messages are deleted. Pending challenges are kept in the Storage, so Restore continues them after the restart.
+// The challenge is removed only after the newcomer is unmuted or kicked, the failed call is retried after the RetryDelay.
+type Captcha struct {
+	Admin *Admin
+	// Storage of pending challenges
+	Storage Storage
+	// Challenge generates questions, MathChallenge is used if empty
+	Challenge Challenge
+	// Timeout to solve the challenge, DefaultCaptchaTimeout is used if empty
+	Timeout time.Duration
+	// Attempts to solve the challenge, DefaultCaptchaAttempts is used if empty
+	Attempts int
+	// Key of the pending challenges index, DefaultCaptchaKey is used if empty
+	Key string
+	// RetryDelay is a delay before the failed unmute or kick is retried, DefaultCaptchaRetryDelay is used if empty
+	RetryDelay time.Duration
+	// OnSolved is called when the newcomer solves the challenge
+	OnSolved func(ctx context.Context, state *CaptchaState) error
+	// OnRejected is called when the newcomer is kicked
+	OnRejected func(ctx context.Context, state *CaptchaState) error
+	// OnError is called when the Start of the newcomer in the Middleware, the background rejection or cleanup fails
+	OnError func(err error)
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// NewCaptcha creates the captcha with the MathChallenge
+func NewCaptcha(bot *Bot, storage Storage) *Captcha {
+	return &Captcha{
+		Admin:     NewAdmin(bot),
+		Storage:   storage,
+		Challenge: MathChallenge{},
+		Timeout:   DefaultCaptchaTimeout,
+		Attempts:  DefaultCaptchaAttempts,
+		Key:       DefaultCaptchaKey,
+	}
+}
+
+// Middleware returns the Middleware, that challenges new members and handles answers,
+// new members messages and other updates are passed to the next handler.
+// Every new member is challenged, Start errors are passed to the OnError.
+func (c *Captcha) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			if query := update.CallbackQuery; query != nil && strings.HasPrefix(query.Data, captchaPrefix) {
+				return c.Answer(ctx, query)
+			}
+			if message := update.Message; message != nil && len(message.NewChatMembers) != 0 {
+				for _, user := range message.NewChatMembers {
+					if user.IsBot {
+						continue
+					}
+					if err := c.Start(ctx, message.Chat.Id, user, message.MessageId); err != nil {
+						c.error(err)
+					}
+				}
+			}
+			return next.Handle(ctx, update)
+		})
+	}
+}
+
+// Start restricts the user and posts the challenge in reply to the join message.
+// InvalidChallenge is returned for the question without the answer or with the answer out of the options.
+// If the challenge can't be started, the restriction is lifted and the posted challenge is deleted.
+func (c *Captcha) Start(ctx context.Context, chatId int, user *User, joinId int) error {
+	question := c.challenge().Question(user)
+	if err := question.validate(); err != nil {
+		return err
+	}
+	if err := c.Admin.Mute(ctx, chatId, user.Id, 0); err != nil {
+		return err
+	}
+	keyboard := &InlineKeyboardMarkup{}
+	state := &CaptchaState{
+		ChatId:  chatId,
+		UserId:  user.Id,
+		JoinId:  joinId,
+		Answer:  question.Answer,
+		Expires: now().Add(c.timeout()).UnixNano(),
+	}
+	for _, row := range question.Options {
+		buttons := make([]*InlineKeyboardButton, 0, len(row))
+		for _, option := range row {
+			buttons = append(buttons, &InlineKeyboardButton{
+				Text:         option,
+				CallbackData: fmt.Sprintf("%s%d:%d", captchaPrefix, user.Id, len(state.Options)),
+			})
+			state.Options = append(state.Options, option)
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, buttons)
+	}
+	message, err := c.Admin.Bot.SendMessage(ctx, &SendMessageRequest{
+		ChatId:           chatId,
+		Text:             user.FirstName + ", " + question.Text,
+		ReplyToMessageId: joinId,
+		ReplyMarkup:      keyboard,
+	})
+	if err != nil {
+		return c.abort(ctx, state, err)
+	}
+	state.MessageId = message.MessageId
+
+	c.mu.Lock()
+	if err = c.save(state); err == nil {
+		err = c.index(captchaKey(chatId, user.Id), true)
+	}
+	if err != nil {
+		_ = c.Storage.Delete(c.prefix() + captchaKey(chatId, user.Id))
+		c.mu.Unlock()
+		return c.abort(ctx, state, err)
+	}
+	c.schedule(state)
+	c.mu.Unlock()
+	return nil
+}
+
+// abort lifts the restriction of the newcomer and deletes the posted challenge, when Start fails; err is returned.
+// Both rollback steps are done, their errors are passed to the OnError.
+func (c *Captcha) abort(ctx context.Context, state *CaptchaState, err error) error {
+	if failed := c.Admin.Unmute(ctx, state.ChatId, state.UserId); failed != nil {
+		c.error(failed)
+	}
+	if state.MessageId != 0 {
+		if _, failed := c.Admin.Bot.DeleteMessage(ctx, &DeleteMessageRequest{ChatId: state.ChatId, MessageId: state.MessageId}); failed != nil {
+			c.error(failed)
+		}
+	}
+	return err
+}
+
+// Answer handles the pressed button of the challenge, presses on the other messages are expired
+func (c *Captcha) Answer(ctx context.Context, query *CallbackQuery) error {
+	parts := strings.Split(strings.TrimPrefix(query.Data, captchaPrefix), ":")
+	if len(parts) != 2 || query.Message == nil || query.From == nil {
+		return InvalidCallbackData
+	}
+	userId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return InvalidCallbackData
+	}
+	option, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return InvalidCallbackData
+	}
+	if userId != query.From.Id {
+		return c.Admin.Bot.Toast(ctx, query, "This challenge is for the other user")
+	}
+
+	c.mu.Lock()
+	state, err := c.load(captchaKey(query.Message.ChatId(), userId))
+	if err == KeyNotFound || err == nil && (state.Solved || state.Rejected || state.MessageId != query.Message.MessageId) {
+		c.mu.Unlock()
+		return c.Admin.Bot.Toast(ctx, query, "Challenge is expired")
+	} else if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if option >= 0 && option < len(state.Options) && state.Progress < len(state.Answer) &&
+		state.Options[option] == state.Answer[state.Progress] {
+		state.Progress++
+		state.Solved = state.Progress == len(state.Answer)
+	} else {
+		state.Progress = 0
+		state.Attempts++
+		state.Rejected = state.Attempts >= c.attempts()
+	}
+	if state.Solved || state.Rejected {
+		// the timer is stopped, the failed completion schedules the retry
+		c.stop(captchaKey(state.ChatId, state.UserId))
+	}
+	err = c.save(state)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case state.Solved:
+		if err = c.complete(ctx, state); err != nil {
+			return err
+		}
+		return c.Admin.Bot.Toast(ctx, query, "Welcome!")
+	case state.Rejected:
+		if err = c.complete(ctx, state); err != nil {
+			return err
+		}
+		return c.Admin.Bot.Toast(ctx, query, "Wrong answer")
+	case state.Progress == 0:
+		return c.Admin.Bot.Toast(ctx, query, fmt.Sprintf("Wrong answer, %d attempts left", c.attempts()-state.Attempts))
+	}
+	return c.Admin.Bot.Toast(ctx, query, "✓")
+}
+
+// Restore schedules timeouts of the pending challenges, e.g. after the restart.
+// Expired challenges are rejected immediately.
+func (c *Captcha) Restore() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys, err := c.keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		state, err := c.load(key)
+		if err == KeyNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		c.schedule(state)
+	}
+	return nil
+}
+
+// Close cancels scheduled timeouts, challenges are left pending
+func (c *Captcha) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, timer := range c.timers {
+		timer.Stop()
+		delete(c.timers, key)
+	}
+}
+
+// complete unmutes the solved newcomer or kicks the rejected one, the challenge is removed only on success,
+// otherwise it is kept pending and retried after the RetryDelay
+func (c *Captcha) complete(ctx context.Context, state *CaptchaState) error {
+	var err error
+	if state.Solved {
+		err = c.Admin.Unmute(ctx, state.ChatId, state.UserId)
+	} else {
+		err = c.Admin.Kick(ctx, state.ChatId, state.UserId)
+	}
+	c.mu.Lock()
+	if err != nil {
+		state.Expires = now().Add(c.retryDelay()).UnixNano()
+		if serr := c.save(state); serr != nil && c.OnError != nil {
+			c.OnError(serr)
+		}
+		c.schedule(state)
+		c.mu.Unlock()
+		return err
+	}
+	err = c.finish(state)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	c.cleanup(ctx, state, state.Rejected)
+	if state.Solved && c.OnSolved != nil {
+		return c.OnSolved(ctx, state)
+	}
+	if state.Rejected && c.OnRejected != nil {
+		return c.OnRejected(ctx, state)
+	}
+	return nil
+}
+
+// cleanup deletes the challenge, and the join message of the rejected newcomer
+func (c *Captcha) cleanup(ctx context.Context, state *CaptchaState, rejected bool) {
+	_, err := c.Admin.Bot.DeleteMessage(ctx, &DeleteMessageRequest{ChatId: state.ChatId, MessageId: state.MessageId})
+	if err == nil && rejected && state.JoinId != 0 {
+		err = c.Admin.DeleteMessage(ctx, state.ChatId, state.JoinId)
+	}
+	if err != nil && c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+// finish removes the pending challenge, should be called under the lock
+func (c *Captcha) finish(state *CaptchaState) error {
+	key := captchaKey(state.ChatId, state.UserId)
+	c.stop(key)
+	if err := c.Storage.Delete(c.prefix() + key); err != nil {
+		return err
+	}
+	return c.index(key, false)
+}
+
+// stop cancels the timer of the challenge, should be called under the lock
+func (c *Captcha) stop(key string) {
+	if timer, ok := c.timers[key]; ok {
+		timer.Stop()
+		delete(c.timers, key)
+	}
+}
+
+// schedule starts the timer of the challenge timeout or of the retry of the finished challenge,
+// should be called under the lock
+func (c *Captcha) schedule(state *CaptchaState) {
+	if c.timers == nil {
+		c.timers = make(map[string]*time.Timer)
+	}
+	key := captchaKey(state.ChatId, state.UserId)
+	c.stop(key)
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Unix(0, state.Expires).Sub(now()), func() {
+		c.mu.Lock()
+		// the timer, stopped after it has fired, is ignored
+		if c.timers[key] != timer {
+			c.mu.Unlock()
+			return
+		}
+		delete(c.timers, key)
+		state, err := c.load(key)
+		if err == nil && !state.Solved {
+			state.Rejected = true
+			err = c.save(state)
+		}
+		c.mu.Unlock()
+		if err == nil {
+			err = c.complete(context.Background(), state)
+		}
+		if err != nil && err != KeyNotFound && c.OnError != nil {
+			c.OnError(err)
+		}
+	})
+	c.timers[key] = timer
+}
+
+// index adds the challenge to the index of pending challenges or removes it, should be called under the lock
+func (c *Captcha) index(key string, pending bool) error {
+	keys, err := c.keys()
+	if err != nil {
+		return err
+	}
+	result := make([]string, 0, len(keys)+1)
+	for _, item := range keys {
+		if item != key {
+			result = append(result, item)
+		}
+	}
+	if pending {
+		result = append(result, key)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.Storage.Set(c.indexKey(), data)
+}
+
+func (c *Captcha) keys() ([]string, error) {
+	var keys []string
+	data, err := c.Storage.Get(c.indexKey())
+	if err == KeyNotFound {
+		return keys, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return keys, json.Unmarshal(data, &keys)
+}
+
+func (c *Captcha) load(key string) (*CaptchaState, error) {
+	data, err := c.Storage.Get(c.prefix() + key)
+	if err != nil {
+		return nil, err
+	}
+	state := new(CaptchaState)
+	return state, json.Unmarshal(data, state)
+}
+
+func (c *Captcha) save(state *CaptchaState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return c.Storage.Set(c.prefix()+captchaKey(state.ChatId, state.UserId), data)
+}
+
+func (c *Captcha) indexKey() string {
+	if c.Key != "" {
+		return c.Key
+	}
+	return DefaultCaptchaKey
+}
+
+func (c *Captcha) prefix() string {
+	return c.indexKey() + ":"
+}
+
+func (c *Captcha) challenge() Challenge {
+	if c.Challenge != nil {
+		return c.Challenge
+	}
+	return MathChallenge{}
+}
+
+func (c *Captcha) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultCaptchaTimeout
+}
+
+func (c *Captcha) error(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	} else if c.Admin != nil && c.Admin.Bot != nil {
+		c.Admin.Bot.Log("captcha error: %s", err)
+	}
+}
+
+func (c *Captcha) retryDelay() time.Duration {
+	if c.RetryDelay > 0 {
+		return c.RetryDelay
+	}
+	return DefaultCaptchaRetryDelay
+}
+
+func (c *Captcha) attempts() int {
+	if c.Attempts > 0 {
+		return c.Attempts
+	}
+	return DefaultCaptchaAttempts
+}
+
+func captchaKey(chatId, userId int) string {
+	return fmt.Sprintf("%d:%d", chatId, userId)
+}
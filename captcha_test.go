@@ -0,0 +1,475 @@
+package tg_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+type fixedChallenge struct{}
+
+func (fixedChallenge) Question(*tg.User) *tg.ChallengeQuestion {
+	return &tg.ChallengeQuestion{
+		Text:    "Press B, then C",
+		Options: [][]string{{"A", "B"}, {"C"}},
+		Answer:  []string{"B", "C"},
+	}
+}
+
+func TestCaptcha(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+
+	captcha := tg.NewCaptcha(server.Bot(), tg.NewMemoryStorage())
+	captcha.Challenge = fixedChallenge{}
+	captcha.Attempts = 2
+	defer captcha.Close()
+	var mu sync.Mutex
+	solved := make([]int, 0)
+	rejected := make(chan int, 4)
+	captcha.OnSolved = func(ctx context.Context, state *tg.CaptchaState) error {
+		mu.Lock()
+		defer mu.Unlock()
+		solved = append(solved, state.UserId)
+		return nil
+	}
+	captcha.OnRejected = func(ctx context.Context, state *tg.CaptchaState) error {
+		rejected <- state.UserId
+		return nil
+	}
+	captcha.OnError = func(err error) {
+		t.Errorf("OnError() error = %v", err)
+	}
+	handler := tg.Chain(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error { return nil }), captcha.Middleware())
+
+	join := func(user *tg.User) *tg.Message {
+		message := server.AddMessage(&tg.Message{Chat: server.Chat(-1), From: user, NewChatMembers: []*tg.User{user}})
+		if err := handler.Handle(ctx, &tg.Update{Message: message}); err != nil {
+			t.Fatalf("Handle() join error = %v", err)
+		}
+		if member := server.Member(-1, user.Id); !member.IsRestricted() || member.CanSendMessages {
+			t.Fatalf("newcomer is not restricted: %+v", member)
+		}
+		messages := server.Messages(-1)
+		return messages[len(messages)-1]
+	}
+	press := func(challenge *tg.Message, userId, row, column int) string {
+		server.Reset()
+		button := challenge.ReplyMarkup.InlineKeyboard[row][column]
+		query := &tg.CallbackQuery{Id: "q", From: &tg.User{Id: userId}, Message: challenge, Data: button.CallbackData}
+		if err := handler.Handle(ctx, &tg.Update{CallbackQuery: query}); err != nil {
+			t.Fatalf("Handle() answer error = %v", err)
+		}
+		answer := new(tg.AnswerCallbackQueryRequest)
+		if call := server.LastCall("answerCallbackQuery"); call == nil || call.Decode(answer) != nil {
+			t.Fatalf("callback query is not answered")
+		}
+		return answer.Text
+	}
+
+	// solved in the second attempt
+	challenge := join(&tg.User{Id: 5, FirstName: "Ann"})
+	if challenge.Text != "Ann, Press B, then C" || challenge.ReplyToMessage == nil {
+		t.Errorf("challenge = %+v", challenge)
+	}
+	if text := press(challenge, 6, 0, 1); text != "This challenge is for the other user" {
+		t.Errorf("other user answer = %v", text)
+	}
+	if text := press(challenge, 5, 0, 0); text != "Wrong answer, 1 attempts left" {
+		t.Errorf("wrong answer = %v", text)
+	}
+	if text := press(challenge, 5, 0, 1); text != "✓" {
+		t.Errorf("progress answer = %v", text)
+	}
+	if text := press(challenge, 5, 1, 0); text != "Welcome!" {
+		t.Errorf("solved answer = %v", text)
+	}
+	if member := server.Member(-1, 5); member.IsRestricted() || !member.IsChatMember() {
+		t.Errorf("solved member = %+v", member)
+	}
+	if server.Message(-1, challenge.MessageId) != nil {
+		t.Errorf("challenge is not deleted")
+	}
+	if len(solved) != 1 || solved[0] != 5 {
+		t.Errorf("OnSolved calls = %v", solved)
+	}
+
+	// rejected after failed attempts
+	challenge = join(&tg.User{Id: 7, FirstName: "Bob"})
+	press(challenge, 7, 1, 0)
+	if text := press(challenge, 7, 0, 0); text != "Wrong answer" {
+		t.Errorf("rejected answer = %v", text)
+	}
+	if member := server.Member(-1, 7); member.IsChatMember() || member.IsKicked() {
+		t.Errorf("rejected member = %+v", member)
+	}
+	if server.Message(-1, challenge.MessageId) != nil || server.Message(-1, challenge.ReplyToMessage.MessageId) != nil {
+		t.Errorf("challenge messages are not deleted")
+	}
+	if userId := <-rejected; userId != 7 {
+		t.Errorf("OnRejected() user = %v", userId)
+	}
+	if text := press(challenge, 7, 0, 1); text != "Challenge is expired" {
+		t.Errorf("expired answer = %v", text)
+	}
+
+	// rejected on timeout
+	captcha.Timeout = 50 * time.Millisecond
+	challenge = join(&tg.User{Id: 8, FirstName: "Eve"})
+	select {
+	case userId := <-rejected:
+		if userId != 8 {
+			t.Errorf("OnRejected() user = %v", userId)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("newcomer is not rejected on timeout")
+	}
+	if server.Message(-1, challenge.MessageId) != nil {
+		t.Errorf("challenge is not deleted on timeout")
+	}
+}
+
+func TestCaptcha_Restore(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+	storage := tg.NewMemoryStorage()
+
+	captcha := tg.NewCaptcha(server.Bot(), storage)
+	if err := captcha.Start(ctx, -1, &tg.User{Id: 5, FirstName: "Ann"}, 0); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	captcha.Close()
+
+	// the challenge has expired while the bot was stopped
+	data, err := storage.Get(tg.DefaultCaptchaKey + ":-1:5")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	state := new(tg.CaptchaState)
+	if err = json.Unmarshal(data, state); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	state.Expires = time.Now().Add(-time.Second).UnixNano()
+	data, _ = json.Marshal(state)
+	if err = storage.Set(tg.DefaultCaptchaKey+":-1:5", data); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	restarted := tg.NewCaptcha(server.Bot(), storage)
+	rejected := make(chan int, 1)
+	restarted.OnRejected = func(ctx context.Context, state *tg.CaptchaState) error {
+		rejected <- state.UserId
+		return nil
+	}
+	defer restarted.Close()
+	if err = restarted.Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	select {
+	case userId := <-rejected:
+		if userId != 5 {
+			t.Errorf("OnRejected() user = %v", userId)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("restored challenge is not rejected")
+	}
+	if _, err = storage.Get(tg.DefaultCaptchaKey + ":-1:5"); err != tg.KeyNotFound {
+		t.Errorf("challenge is not removed: %v", err)
+	}
+}
+
+func TestCaptcha_Retry(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+	storage := tg.NewMemoryStorage()
+	captcha := tg.NewCaptcha(server.Bot(), storage)
+	captcha.Challenge = fixedChallenge{}
+	captcha.RetryDelay = 20 * time.Millisecond
+	solved := make(chan int, 1)
+	captcha.OnSolved = func(ctx context.Context, state *tg.CaptchaState) error {
+		solved <- state.UserId
+		return nil
+	}
+	rejected := make(chan int, 1)
+	captcha.OnRejected = func(ctx context.Context, state *tg.CaptchaState) error {
+		rejected <- state.UserId
+		return nil
+	}
+	defer captcha.Close()
+
+	if err := captcha.Start(ctx, -1, &tg.User{Id: 5, FirstName: "Ann"}, 0); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	messages := server.Messages(-1)
+	challenge := messages[len(messages)-1]
+	press := func(row, column int) error {
+		button := challenge.ReplyMarkup.InlineKeyboard[row][column]
+		return captcha.Answer(ctx, &tg.CallbackQuery{Id: "q", From: &tg.User{Id: 5}, Message: challenge, Data: button.CallbackData})
+	}
+	if err := press(0, 1); err != nil {
+		t.Fatalf("Answer() error = %v", err)
+	}
+	// the unmute fails, the solved challenge is kept and retried
+	server.Fail("restrictChatMember", tgtest.BadRequest("temporary failure"))
+	if err := press(1, 0); err == nil {
+		t.Fatalf("Answer() with the failed unmute should fail")
+	}
+	if _, err := storage.Get(tg.DefaultCaptchaKey + ":-1:5"); err != nil {
+		t.Errorf("solved challenge is removed before the unmute: %v", err)
+	}
+	select {
+	case userId := <-solved:
+		if userId != 5 {
+			t.Errorf("OnSolved() user = %v", userId)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("unmute is not retried")
+	}
+	if member := server.Member(-1, 5); member.IsRestricted() {
+		t.Errorf("solved member = %+v", member)
+	}
+
+	// the kick on timeout fails and is retried
+	captcha.Timeout = 20 * time.Millisecond
+	server.Fail("kickChatMember", tgtest.BadRequest("temporary failure"))
+	if err := captcha.Start(ctx, -1, &tg.User{Id: 7, FirstName: "Bob"}, 0); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	select {
+	case userId := <-rejected:
+		if userId != 7 {
+			t.Errorf("OnRejected() user = %v", userId)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("kick is not retried")
+	}
+	if calls := server.CallsTo("kickChatMember"); len(calls) != 2 {
+		t.Errorf("kickChatMember calls = %d, want 2", len(calls))
+	}
+	if _, err := storage.Get(tg.DefaultCaptchaKey + ":-1:7"); err != tg.KeyNotFound {
+		t.Errorf("rejected challenge is not removed: %v", err)
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	for _, challenge := range []tg.Challenge{tg.MathChallenge{}, tg.OrderChallenge{Size: 5}, tg.OrderChallenge{Size: 100}} {
+		question := challenge.Question(&tg.User{Id: 1})
+		if order, ok := challenge.(tg.OrderChallenge); ok && order.Size > tg.MaxOrderChallengeSize && len(question.Answer) != tg.MaxOrderChallengeSize {
+			t.Errorf("OrderChallenge size = %d, want %d", len(question.Answer), tg.MaxOrderChallengeSize)
+		}
+		options := make(map[string]bool)
+		for _, row := range question.Options {
+			for _, option := range row {
+				if options[option] {
+					t.Errorf("duplicated option %v in %+v", option, question)
+				}
+				options[option] = true
+			}
+		}
+		for _, answer := range question.Answer {
+			if !options[answer] {
+				t.Errorf("answer %v is not in options %+v", answer, question)
+			}
+		}
+	}
+}
+
+func TestMathChallenge(t *testing.T) {
+	minimal := 0
+	for i := 0; i < 100; i++ {
+		question := tg.MathChallenge{}.Question(&tg.User{Id: 1})
+		answer, _ := strconv.Atoi(question.Answer[0])
+		lowest := answer
+		for _, option := range question.Options[0] {
+			value, err := strconv.Atoi(option)
+			if err != nil || value <= 0 || value < answer-4 || value > answer+4 {
+				t.Fatalf("option %v of %+v", option, question)
+			}
+			if value < lowest {
+				lowest = value
+			}
+		}
+		if lowest == answer {
+			minimal++
+		}
+	}
+	if minimal == 100 {
+		t.Errorf("answer is always the minimal option")
+	}
+}
+
+type brokenChallenge struct {
+	answer []string
+}
+
+func (c brokenChallenge) Question(*tg.User) *tg.ChallengeQuestion {
+	return &tg.ChallengeQuestion{Text: "Press A", Options: [][]string{{"A"}}, Answer: c.answer}
+}
+
+func TestCaptcha_InvalidChallenge(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+	captcha := tg.NewCaptcha(server.Bot(), tg.NewMemoryStorage())
+	defer captcha.Close()
+	for _, answer := range [][]string{nil, {"B"}, {"A", "B"}} {
+		captcha.Challenge = brokenChallenge{answer: answer}
+		if err := captcha.Start(context.Background(), -1, &tg.User{Id: 5}, 0); err != tg.InvalidChallenge {
+			t.Errorf("Start() with the answer %v error = %v", answer, err)
+		}
+	}
+	if calls := server.CallsTo("restrictChatMember"); len(calls) != 0 {
+		t.Errorf("newcomer is restricted with the invalid challenge")
+	}
+}
+
+func TestCaptcha_MiddlewareStartFailure(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+	captcha := tg.NewCaptcha(server.Bot(), tg.NewMemoryStorage())
+	defer captcha.Close()
+	var failures []error
+	captcha.OnError = func(err error) {
+		failures = append(failures, err)
+	}
+	passed := false
+	handler := captcha.Middleware()(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		passed = true
+		return nil
+	}))
+
+	// the challenge of the first newcomer fails, the second one is challenged anyway
+	server.Fail("sendMessage", tgtest.BadRequest("temporary failure"))
+	users := []*tg.User{{Id: 5, FirstName: "Ann"}, {Id: 7, FirstName: "Bob"}}
+	message := server.AddMessage(&tg.Message{Chat: server.Chat(-1), From: users[0], NewChatMembers: users})
+	if err := handler.Handle(context.Background(), &tg.Update{Message: message}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if len(failures) != 1 || tg.ErrorResponse(failures[0]) == nil {
+		t.Errorf("reported errors = %v", failures)
+	}
+	if member := server.Member(-1, 7); !member.IsRestricted() || member.CanSendMessages {
+		t.Errorf("second newcomer is not challenged: %+v", member)
+	}
+	if !passed {
+		t.Errorf("join message is not passed to the next handler")
+	}
+}
+
+func TestCaptcha_StartFailure(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+	storage := tg.NewMemoryStorage()
+	captcha := tg.NewCaptcha(server.Bot(), storage)
+	defer captcha.Close()
+
+	// the newcomer is not left restricted without the challenge
+	server.Fail("sendMessage", tgtest.BadRequest("chat not found"))
+	if err := captcha.Start(ctx, -1, &tg.User{Id: 5, FirstName: "Ann"}, 0); err == nil {
+		t.Fatalf("Start() should fail")
+	}
+	if member := server.Member(-1, 5); member.IsRestricted() && !member.CanSendMessages {
+		t.Errorf("newcomer is left restricted: %+v", member)
+	}
+	if _, err := storage.Get(tg.DefaultCaptchaKey + ":-1:5"); err != tg.KeyNotFound {
+		t.Errorf("failed challenge is saved: %v", err)
+	}
+}
+
+func TestCaptcha_AbortFailure(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+	storage := tg.NewMemoryStorage()
+	captcha := tg.NewCaptcha(server.Bot(), storage)
+	defer captcha.Close()
+	var failures []error
+	captcha.OnError = func(err error) {
+		failures = append(failures, err)
+	}
+
+	// the state can't be saved, the unmute fails, the challenge is deleted anyway
+	saveFailure := errors.New("storage is down")
+	captcha.Storage = failingStorage{Storage: storage, err: saveFailure}
+	server.Fail("restrictChatMember", nil) // the mute passes
+	server.Fail("restrictChatMember", tgtest.BadRequest("temporary failure"))
+	if err := captcha.Start(ctx, -1, &tg.User{Id: 5, FirstName: "Ann"}, 0); err != saveFailure {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if len(failures) != 1 || tg.ErrorResponse(failures[0]) == nil {
+		t.Errorf("reported errors = %v", failures)
+	}
+	if calls := server.CallsTo("deleteMessage"); len(calls) != 1 {
+		t.Errorf("challenge is not deleted after the failed unmute")
+	}
+}
+
+type failingStorage struct {
+	tg.Storage
+	err error
+}
+
+func (s failingStorage) Set(key string, value []byte) error {
+	return s.err
+}
+
+func TestCaptcha_OtherMessage(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup", Title: "Group"})
+	server.AddMember(-1, &tg.ChatMember{User: server.Me(), Status: "administrator", CanRestrictMembers: true, CanDeleteMessages: true})
+	captcha := tg.NewCaptcha(server.Bot(), tg.NewMemoryStorage())
+	captcha.Challenge = fixedChallenge{}
+	defer captcha.Close()
+
+	if err := captcha.Start(ctx, -1, &tg.User{Id: 5, FirstName: "Ann"}, 0); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	messages := server.Messages(-1)
+	challenge := messages[len(messages)-1]
+	// the button of the old challenge is pressed
+	stale := *challenge
+	stale.MessageId = challenge.MessageId - 1
+	button := challenge.ReplyMarkup.InlineKeyboard[0][1]
+	if err := captcha.Answer(ctx, &tg.CallbackQuery{Id: "q", From: &tg.User{Id: 5}, Message: &stale, Data: button.CallbackData}); err != nil {
+		t.Fatalf("Answer() error = %v", err)
+	}
+	answer := new(tg.AnswerCallbackQueryRequest)
+	if call := server.LastCall("answerCallbackQuery"); call == nil || call.Decode(answer) != nil || answer.Text != "Challenge is expired" {
+		t.Errorf("press on the other message is answered with %q", answer.Text)
+	}
+	// the progress is not changed: B, then C solves the challenge
+	for _, button := range []*tg.InlineKeyboardButton{challenge.ReplyMarkup.InlineKeyboard[0][1], challenge.ReplyMarkup.InlineKeyboard[1][0]} {
+		if err := captcha.Answer(ctx, &tg.CallbackQuery{Id: "q", From: &tg.User{Id: 5}, Message: challenge, Data: button.CallbackData}); err != nil {
+			t.Fatalf("Answer() error = %v", err)
+		}
+	}
+	if member := server.Member(-1, 5); member.IsRestricted() || !member.IsChatMember() {
+		t.Errorf("newcomer is not unmuted: %+v", member)
+	}
+}
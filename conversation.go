@@ -0,0 +1,232 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ConversationHandler handles the update in the state of the dialog
+type ConversationHandler func(ctx context.Context, dialog *Dialog, update *Update) error
+
+// Conversation is a Handler of the multi-step dialogs, i.e. finite-state machine.
+// Dialog is started with the entry command, each update of the dialog is processed by the handler of the current state,
+// that may move the dialog to one of the declared states or end it.
+// Dialogs are keyed by the chat and the user and persisted in the Storage.
+type Conversation struct {
+	// Name of the conversation, used as a prefix of the Storage keys
+	Name string
+	// Storage of the dialogs
+	Storage Storage
+	// Timeout resets the dialog, if there were no updates for the given duration; no timeout if empty
+	Timeout time.Duration
+	// CancelCommand ends the dialog in any state, e.g. "cancel"; no cancel command if empty
+	CancelCommand string
+	// OnCancel is called after the dialog is cancelled with the CancelCommand
+	OnCancel ConversationHandler
+	// OnTimeout is called with the expired dialog on the next update of the user
+	OnTimeout ConversationHandler
+	// Next handles updates outside of the dialogs
+	Next Handler
+
+	states  map[string]*conversationState
+	entries map[string]string
+}
+
+type conversationState struct {
+	handler     ConversationHandler
+	transitions map[string]bool
+}
+
+// Dialog is a state of the conversation with the user in the chat
+type Dialog struct {
+	ChatId  int             `json:"chat_id"`
+	UserId  int             `json:"user_id"`
+	State   string          `json:"state"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Updated int             `json:"updated"`
+
+	conversation *Conversation
+	next         string
+	ended        bool
+}
+
+// NewConversation creates the conversation with the given name and storage
+func NewConversation(name string, storage Storage) *Conversation {
+	return &Conversation{
+		Name:    name,
+		Storage: storage,
+		states:  make(map[string]*conversationState),
+		entries: make(map[string]string),
+	}
+}
+
+// State declares the state with its handler and states, that dialog may move to from it
+func (c *Conversation) State(name string, handler ConversationHandler, transitions ...string) *Conversation {
+	state := &conversationState{
+		handler:     handler,
+		transitions: make(map[string]bool, len(transitions)),
+	}
+	for _, transition := range transitions {
+		state.transitions[transition] = true
+	}
+	c.states[name] = state
+	return c
+}
+
+// Entry declares the command without leading slash, that starts the dialog in the given state.
+// Handler of the state is called with the command update.
+func (c *Conversation) Entry(command, state string) *Conversation {
+	c.entries[command] = state
+	return c
+}
+
+// Start starts the dialog in the given state, e.g. from the other handler
+func (c *Conversation) Start(chatId, userId int, state string) (*Dialog, error) {
+	if _, ok := c.states[state]; !ok {
+		return nil, fmt.Errorf("conversation %s: unknown state %s", c.Name, state)
+	}
+	dialog := c.dialog(chatId, userId)
+	dialog.State = state
+	return dialog, c.save(dialog)
+}
+
+// Dialog returns the active dialog of the user in the chat, or nil
+func (c *Conversation) Dialog(chatId, userId int) (*Dialog, error) {
+	data, err := c.Storage.Get(c.key(chatId, userId))
+	if err == KeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dialog := c.dialog(chatId, userId)
+	if err = json.Unmarshal(data, dialog); err != nil {
+		return nil, err
+	}
+	return dialog, nil
+}
+
+// Handle implements the Handler
+func (c *Conversation) Handle(ctx context.Context, update *Update) error {
+	chatId, userId := update.ChatId(), update.UserId()
+	if chatId == 0 && userId == 0 {
+		return c.next(ctx, update)
+	}
+	dialog, err := c.Dialog(chatId, userId)
+	if err != nil {
+		return err
+	}
+	if dialog != nil && c.expired(dialog) {
+		if err = c.Storage.Delete(c.key(chatId, userId)); err != nil {
+			return err
+		}
+		if c.OnTimeout != nil {
+			if err = c.OnTimeout(ctx, dialog, update); err != nil {
+				return err
+			}
+		}
+		dialog = nil
+	}
+
+	command := ""
+	if update.Message != nil {
+		command = update.Message.Command()
+	}
+	if dialog == nil {
+		state, ok := c.entries[command]
+		if command == "" || !ok {
+			return c.next(ctx, update)
+		}
+		dialog = c.dialog(chatId, userId)
+		dialog.State = state
+	} else if c.CancelCommand != "" && command == c.CancelCommand {
+		if err = c.Storage.Delete(c.key(chatId, userId)); err != nil {
+			return err
+		}
+		if c.OnCancel != nil {
+			return c.OnCancel(ctx, dialog, update)
+		}
+		return nil
+	}
+
+	state, ok := c.states[dialog.State]
+	if !ok {
+		return fmt.Errorf("conversation %s: unknown state %s", c.Name, dialog.State)
+	}
+	if err = state.handler(ctx, dialog, update); err != nil {
+		return err
+	}
+	if dialog.ended {
+		return c.Storage.Delete(c.key(chatId, userId))
+	}
+	if dialog.next != "" {
+		dialog.State, dialog.next = dialog.next, ""
+	}
+	return c.save(dialog)
+}
+
+// Load decodes the dialog data into the v, v is left untouched if there is no data
+func (d *Dialog) Load(v interface{}) error {
+	if len(d.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(d.Data, v)
+}
+
+// Store encodes the v into the dialog data, it is saved after the state handler
+func (d *Dialog) Store(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	d.Data = data
+	return nil
+}
+
+// Next moves the dialog into the state after the current handler, state should be declared in the transitions
+func (d *Dialog) Next(state string) error {
+	if current, ok := d.conversation.states[d.State]; !ok || !current.transitions[state] {
+		return fmt.Errorf("conversation %s: transition from %s to %s is not allowed", d.conversation.Name, d.State, state)
+	}
+	d.next = state
+	return nil
+}
+
+// End ends the dialog after the current handler, its state and data are removed
+func (d *Dialog) End() {
+	d.ended = true
+}
+
+func (c *Conversation) dialog(chatId, userId int) *Dialog {
+	return &Dialog{
+		ChatId:       chatId,
+		UserId:       userId,
+		conversation: c,
+	}
+}
+
+func (c *Conversation) save(dialog *Dialog) error {
+	dialog.Updated = ToUnix(now())
+	data, err := json.Marshal(dialog)
+	if err != nil {
+		return err
+	}
+	return c.Storage.Set(c.key(dialog.ChatId, dialog.UserId), data)
+}
+
+func (c *Conversation) expired(dialog *Dialog) bool {
+	return c.Timeout > 0 && now().Sub(FromUnix(dialog.Updated)) > c.Timeout
+}
+
+func (c *Conversation) next(ctx context.Context, update *Update) error {
+	if c.Next != nil {
+		return c.Next.Handle(ctx, update)
+	}
+	return nil
+}
+
+func (c *Conversation) key(chatId, userId int) string {
+	return fmt.Sprintf("conversation:%s:%d:%d", c.Name, chatId, userId)
+}
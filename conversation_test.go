@@ -0,0 +1,151 @@
+package tg
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type signup struct {
+	Name string `json:"name"`
+	Age  string `json:"age"`
+}
+
+func textUpdate(chatId, userId int, text string) *Update {
+	message := &Message{Chat: &Chat{Id: chatId}, From: &User{Id: userId}, Text: text}
+	if len(text) > 0 && text[0] == '/' {
+		message.Entities = []*MessageEntity{{Type: "bot_command", Offset: 0, Length: len(text)}}
+	}
+	return &Update{Message: message}
+}
+
+func signupConversation(storage Storage, result *signup) *Conversation {
+	return NewConversation("signup", storage).
+		Entry("signup", "start").
+		State("start", func(ctx context.Context, dialog *Dialog, update *Update) error {
+			return dialog.Next("name")
+		}, "name").
+		State("name", func(ctx context.Context, dialog *Dialog, update *Update) error {
+			if err := dialog.Store(&signup{Name: update.Message.Text}); err != nil {
+				return err
+			}
+			return dialog.Next("age")
+		}, "age").
+		State("age", func(ctx context.Context, dialog *Dialog, update *Update) error {
+			if err := dialog.Load(result); err != nil {
+				return err
+			}
+			result.Age = update.Message.Text
+			dialog.End()
+			return nil
+		})
+}
+
+func TestConversation_Handle(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	result := new(signup)
+	passed := 0
+	conversation := signupConversation(storage, result)
+	conversation.Next = HandlerFunc(func(ctx context.Context, update *Update) error {
+		passed++
+		return nil
+	})
+
+	for _, text := range []string{"hello", "/signup", "John", "42", "after"} {
+		if err := conversation.Handle(ctx, textUpdate(1, 2, text)); err != nil {
+			t.Fatalf("Handle(%q) error = %v", text, err)
+		}
+	}
+	if *result != (signup{Name: "John", Age: "42"}) {
+		t.Errorf("Handle() result = %+v", result)
+	}
+	if passed != 2 {
+		t.Errorf("Handle() passed = %d, want 2", passed)
+	}
+	if dialog, err := conversation.Dialog(1, 2); dialog != nil || err != nil {
+		t.Errorf("Dialog() = %+v, %v", dialog, err)
+	}
+}
+
+func TestConversation_Keys(t *testing.T) {
+	ctx := context.Background()
+	conversation := signupConversation(NewMemoryStorage(), new(signup))
+	_ = conversation.Handle(ctx, textUpdate(1, 2, "/signup"))
+	_ = conversation.Handle(ctx, textUpdate(1, 3, "/signup"))
+	_ = conversation.Handle(ctx, textUpdate(1, 2, "John"))
+
+	if dialog, _ := conversation.Dialog(1, 2); dialog == nil || dialog.State != "age" {
+		t.Errorf("Dialog(1, 2) = %+v", dialog)
+	}
+	if dialog, _ := conversation.Dialog(1, 3); dialog == nil || dialog.State != "name" {
+		t.Errorf("Dialog(1, 3) = %+v", dialog)
+	}
+	if dialog, _ := conversation.Dialog(4, 2); dialog != nil {
+		t.Errorf("Dialog(4, 2) = %+v", dialog)
+	}
+}
+
+func TestConversation_Cancel(t *testing.T) {
+	ctx := context.Background()
+	cancelled := false
+	conversation := signupConversation(NewMemoryStorage(), new(signup))
+	conversation.CancelCommand = "cancel"
+	conversation.OnCancel = func(ctx context.Context, dialog *Dialog, update *Update) error {
+		cancelled = dialog.State == "name"
+		return nil
+	}
+	_ = conversation.Handle(ctx, textUpdate(1, 2, "/signup"))
+	if err := conversation.Handle(ctx, textUpdate(1, 2, "/cancel")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if !cancelled {
+		t.Errorf("Handle() OnCancel was not called")
+	}
+	if dialog, _ := conversation.Dialog(1, 2); dialog != nil {
+		t.Errorf("Dialog() = %+v", dialog)
+	}
+}
+
+func TestConversation_Timeout(t *testing.T) {
+	fixed := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	defer func() { now = time.Now }()
+
+	ctx := context.Background()
+	expired := false
+	conversation := signupConversation(NewMemoryStorage(), new(signup))
+	conversation.Timeout = time.Minute
+	conversation.OnTimeout = func(ctx context.Context, dialog *Dialog, update *Update) error {
+		expired = true
+		return nil
+	}
+	_ = conversation.Handle(ctx, textUpdate(1, 2, "/signup"))
+	fixed = fixed.Add(2 * time.Minute)
+	if err := conversation.Handle(ctx, textUpdate(1, 2, "John")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if !expired {
+		t.Errorf("Handle() OnTimeout was not called")
+	}
+	if dialog, _ := conversation.Dialog(1, 2); dialog != nil {
+		t.Errorf("Dialog() = %+v", dialog)
+	}
+}
+
+func TestDialog_Next(t *testing.T) {
+	conversation := signupConversation(NewMemoryStorage(), new(signup))
+	dialog, err := conversation.Start(1, 2, "name")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err = dialog.Next("age"); err != nil {
+		t.Errorf("Next(age) error = %v", err)
+	}
+	if err = dialog.Next("start"); err == nil {
+		t.Errorf("Next(start) error = nil")
+	}
+	if _, err = conversation.Start(1, 2, "unknown"); err == nil {
+		t.Errorf("Start(unknown) error = nil")
+	}
+}
@@ -0,0 +1,174 @@
+package tg
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	InvalidAmount   = errors.New("invalid amount")
+	UnknownCurrency = errors.New("unknown currency")
+)
+
+// Currency describes the ISO-4217 currency
+type Currency struct {
+	// Code is a three-letter ISO-4217 code
+	Code string
+	// Exponent is a number of digits after the decimal separator, e.g. 2 for USD and 0 for JPY
+	Exponent int
+	// Symbol is used for the display, code is used if empty
+	Symbol string
+	// MinAmount and MaxAmount are limits of the Telegram payments in the minor units, unknown if both are empty
+	MinAmount int
+	MaxAmount int
+}
+
+var currencies = struct {
+	sync.RWMutex
+	table map[string]*Currency
+}{
+	table: make(map[string]*Currency),
+}
+
+// isoExponents is the ISO-4217 table of the currencies minor units, currencies absent in the table have exponent 2
+var isoExponents = map[int][]string{
+	0: {"BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG", "RWF", "UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF"},
+	2: {"AED", "AFN", "ALL", "AMD", "ANG", "AOA", "ARS", "AUD", "AWG", "AZN", "BAM", "BBD", "BDT", "BGN", "BMD", "BND", "BOB",
+		"BOV", "BRL", "BSD", "BTN", "BWP", "BYN", "BZD", "CAD", "CDF", "CHE", "CHF", "CHW", "CNY", "COP", "COU", "CRC", "CUC",
+		"CUP", "CVE", "CZK", "DKK", "DOP", "DZD", "EGP", "ERN", "ETB", "EUR", "FJD", "FKP", "GBP", "GEL", "GHS", "GIP", "GMD",
+		"GTQ", "GYD", "HKD", "HNL", "HRK", "HTG", "HUF", "IDR", "ILS", "INR", "IRR", "JMD", "KES", "KGS", "KHR", "KPW", "KYD",
+		"KZT", "LAK", "LBP", "LKR", "LRD", "LSL", "MAD", "MDL", "MGA", "MKD", "MMK", "MNT", "MOP", "MRU", "MUR", "MVR", "MWK",
+		"MXN", "MXV", "MYR", "MZN", "NAD", "NGN", "NIO", "NOK", "NPR", "NZD", "PAB", "PEN", "PGK", "PHP", "PKR", "PLN", "QAR",
+		"RON", "RSD", "RUB", "SAR", "SBD", "SCR", "SDG", "SEK", "SGD", "SHP", "SLL", "SOS", "SRD", "SSP", "STN", "SVC", "SYP",
+		"SZL", "THB", "TJS", "TMT", "TOP", "TRY", "TTD", "TWD", "TZS", "UAH", "USD", "USN", "UYU", "UZS", "VES", "WST", "XCD",
+		"YER", "ZAR", "ZMW", "ZWL"},
+	3: {"BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND"},
+	4: {"CLF", "UYW"},
+}
+
+var currencySymbols = map[string]string{
+	"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "CNY": "¥", "RUB": "₽", "UAH": "₴", "INR": "₹", "KRW": "₩",
+	"ILS": "₪", "TRY": "₺", "VND": "₫", "NGN": "₦", "PHP": "₱", "KZT": "₸", "GEL": "₾", "THB": "฿", "BRL": "R$",
+}
+
+func init() {
+	for exponent, codes := range isoExponents {
+		for _, code := range codes {
+			currencies.table[code] = &Currency{Code: code, Exponent: exponent, Symbol: currencySymbols[code]}
+		}
+	}
+	// Telegram accepts payments between the equivalents of 1 and 10000 USD,
+	// limits of other currencies depend on the exchange rates and are loaded by LoadCurrencies
+	currencies.table["USD"].MinAmount = 100
+	currencies.table["USD"].MaxAmount = 1000000
+}
+
+// LookupCurrency returns the currency by the ISO-4217 code
+func LookupCurrency(code string) (Currency, bool) {
+	currencies.RLock()
+	defer currencies.RUnlock()
+	currency, ok := currencies.table[strings.ToUpper(code)]
+	if !ok {
+		return Currency{}, false
+	}
+	return *currency, true
+}
+
+// SetCurrencyLimits sets the Telegram limits of the currency in the minor units
+func SetCurrencyLimits(code string, min, max int) error {
+	currencies.Lock()
+	defer currencies.Unlock()
+	currency, ok := currencies.table[strings.ToUpper(code)]
+	if !ok {
+		return UnknownCurrency
+	}
+	currency.MinAmount, currency.MaxAmount = min, max
+	return nil
+}
+
+// LoadCurrencies loads exponents and limits from the Telegram currencies list:
+// https://core.telegram.org/bots/payments/currencies.json
+func LoadCurrencies(data []byte) error {
+	var list map[string]struct {
+		Code      string `json:"code"`
+		Symbol    string `json:"symbol"`
+		Exp       int    `json:"exp"`
+		MinAmount string `json:"min_amount"`
+		MaxAmount string `json:"max_amount"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	currencies.Lock()
+	defer currencies.Unlock()
+	for code, item := range list {
+		min, err := strconv.Atoi(item.MinAmount)
+		if err != nil {
+			return InvalidAmount
+		}
+		max, err := strconv.Atoi(item.MaxAmount)
+		if err != nil {
+			return InvalidAmount
+		}
+		code = strings.ToUpper(code)
+		currencies.table[code] = &Currency{Code: code, Exponent: item.Exp, Symbol: item.Symbol, MinAmount: min, MaxAmount: max}
+	}
+	return nil
+}
+
+// CurrencyExponent returns the number of digits after the decimal separator in the currency, e.g. 2 for USD and 0 for JPY
+func CurrencyExponent(currency string) int {
+	if info, ok := LookupCurrency(currency); ok {
+		return info.Exponent
+	}
+	return 2
+}
+
+// MinorUnits converts the decimal amount, e.g. "10.50", into the minor units of the currency, e.g. 1050 for USD
+func MinorUnits(currency, amount string) (int, error) {
+	exponent := CurrencyExponent(currency)
+	amount = strings.TrimSpace(amount)
+	negative := strings.HasPrefix(amount, "-")
+	amount = strings.TrimPrefix(amount, "-")
+	parts := strings.SplitN(amount, ".", 2)
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+		if fraction == "" || len(fraction) > exponent {
+			return 0, InvalidAmount
+		}
+	}
+	if parts[0] == "" || strings.ContainsAny(parts[0]+fraction, "+-") {
+		return 0, InvalidAmount
+	}
+	value, err := strconv.Atoi(parts[0] + fraction + strings.Repeat("0", exponent-len(fraction)))
+	if err != nil {
+		return 0, InvalidAmount
+	}
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// AddPrice adds the price with the decimal amount in the currency of the invoice
+func (r *SendInvoiceRequest) AddPrice(label, amount string) error {
+	value, err := MinorUnits(r.Currency, amount)
+	if err != nil {
+		return err
+	}
+	r.Prices = append(r.Prices, &LabeledPrice{Label: label, Amount: value})
+	return nil
+}
+
+// Total returns the total amount of the invoice prices in the minor units
+func (r *SendInvoiceRequest) Total() int {
+	total := 0
+	for _, price := range r.Prices {
+		total += price.Amount
+	}
+	return total
+}
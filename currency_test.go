@@ -0,0 +1,73 @@
+package tg
+
+import "testing"
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		currency string
+		amount   string
+		want     int
+		wantErr  bool
+	}{
+		{currency: "USD", amount: "10.50", want: 1050},
+		{currency: "USD", amount: "10.5", want: 1050},
+		{currency: "usd", amount: "10", want: 1000},
+		{currency: "USD", amount: "-1.25", want: -125},
+		{currency: "JPY", amount: "500", want: 500},
+		{currency: "JPY", amount: "500.5", wantErr: true},
+		{currency: "KWD", amount: "1.234", want: 1234},
+		{currency: "USD", amount: "1.234", wantErr: true},
+		{currency: "USD", amount: "", wantErr: true},
+		{currency: "USD", amount: "1.", wantErr: true},
+		{currency: "USD", amount: ".5", wantErr: true},
+		{currency: "USD", amount: "1.-5", wantErr: true},
+		{currency: "USD", amount: "ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.amount, func(t *testing.T) {
+			got, err := MinorUnits(tt.currency, tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MinorUnits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("MinorUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendInvoiceRequest_AddPrice(t *testing.T) {
+	request := &SendInvoiceRequest{Currency: "EUR"}
+	if err := request.AddPrice("Book", "12.99"); err != nil {
+		t.Fatalf("AddPrice() error = %v", err)
+	}
+	if err := request.AddPrice("Delivery", "3"); err != nil {
+		t.Fatalf("AddPrice() error = %v", err)
+	}
+	if err := request.AddPrice("Wrong", "1.001"); err == nil {
+		t.Errorf("AddPrice() error = nil")
+	}
+	if request.Total() != 1599 || len(request.Prices) != 2 {
+		t.Errorf("Total() = %v, prices = %d", request.Total(), len(request.Prices))
+	}
+}
+
+func TestLoadCurrencies(t *testing.T) {
+	defer func(usd Currency) {
+		_ = SetCurrencyLimits("USD", usd.MinAmount, usd.MaxAmount)
+	}(func() Currency { c, _ := LookupCurrency("USD"); return c }())
+
+	data := []byte(`{"USD":{"code":"USD","symbol":"$","exp":2,"min_amount":"150","max_amount":"900000"}}`)
+	if err := LoadCurrencies(data); err != nil {
+		t.Fatalf("LoadCurrencies() error = %v", err)
+	}
+	if got, _ := LookupCurrency("usd"); got.MinAmount != 150 || got.MaxAmount != 900000 || got.Exponent != 2 {
+		t.Errorf("LookupCurrency() = %+v", got)
+	}
+	if err := LoadCurrencies([]byte(`{"USD":{"exp":2,"min_amount":"one"}}`)); err != InvalidAmount {
+		t.Errorf("LoadCurrencies() error = %v", err)
+	}
+	if err := SetCurrencyLimits("XYZ", 1, 2); err != UnknownCurrency {
+		t.Errorf("SetCurrencyLimits() error = %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package tg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+)
+
+const (
+	// MaxStartParameterLength is a maximal length of the start parameter in deep links
+	MaxStartParameterLength = 64
+	// startSignatureLength is a length of the truncated HMAC signature in signed start payloads
+	startSignatureLength = 8
+)
+
+var (
+	InvalidStartParameter = errors.New("invalid start parameter")
+	InvalidStartSignature = errors.New("invalid start parameter signature")
+	EmptyUsername         = errors.New("username is empty")
+)
+
+// IsValidStartParameter checks the start parameter (or the switch_pm_parameter of inline query answer):
+// 1-64 characters, only A-Z, a-z, 0-9, _ and - are allowed
+func IsValidStartParameter(parameter string) bool {
+	if len(parameter) == 0 || len(parameter) > MaxStartParameterLength {
+		return false
+	}
+	for _, c := range parameter {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// StartLink returns the deep link, that opens a private chat with the bot: https://t.me/<bot>?start=<parameter>
+func (u *User) StartLink(parameter string) (string, error) {
+	return u.deepLink("start", parameter)
+}
+
+// StartGroupLink returns the deep link, that adds the bot to a group: https://t.me/<bot>?startgroup=<parameter>
+func (u *User) StartGroupLink(parameter string) (string, error) {
+	return u.deepLink("startgroup", parameter)
+}
+
+func (u *User) deepLink(key, parameter string) (string, error) {
+	if u == nil || u.Username == "" {
+		return "", EmptyUsername
+	}
+	if !IsValidStartParameter(parameter) {
+		return "", InvalidStartParameter
+	}
+	return "https://t.me/" + url.PathEscape(u.Username) + "?" + key + "=" + parameter, nil
+}
+
+// EncodeStartPayload encodes arbitrary data into the start parameter using base64url without padding.
+// Up to 48 bytes of data fit into the parameter.
+func EncodeStartPayload(data []byte) (string, error) {
+	parameter := base64.RawURLEncoding.EncodeToString(data)
+	if !IsValidStartParameter(parameter) {
+		return "", InvalidStartParameter
+	}
+	return parameter, nil
+}
+
+// DecodeStartPayload decodes the start parameter, encoded by EncodeStartPayload
+func DecodeStartPayload(parameter string) ([]byte, error) {
+	if !IsValidStartParameter(parameter) {
+		return nil, InvalidStartParameter
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parameter)
+	if err != nil {
+		return nil, InvalidStartParameter
+	}
+	return data, nil
+}
+
+// SignStartPayload encodes data with the truncated HMAC-SHA-256 signature into the start parameter.
+// Up to 40 bytes of data fit into the parameter.
+func SignStartPayload(secret, data []byte) (string, error) {
+	return EncodeStartPayload(append(append([]byte{}, data...), startSignature(secret, data)...))
+}
+
+// VerifyStartPayload decodes the start parameter, encoded by SignStartPayload, and checks its signature
+func VerifyStartPayload(secret []byte, parameter string) ([]byte, error) {
+	raw, err := DecodeStartPayload(parameter)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < startSignatureLength {
+		return nil, InvalidStartSignature
+	}
+	data, signature := raw[:len(raw)-startSignatureLength], raw[len(raw)-startSignatureLength:]
+	if !hmac.Equal(signature, startSignature(secret, data)) {
+		return nil, InvalidStartSignature
+	}
+	return data, nil
+}
+
+func startSignature(secret, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(data)
+	return mac.Sum(nil)[:startSignatureLength]
+}
+
+// StartParameter returns the parameter of the "/start <parameter>" command, sent by the deep link.
+// Returns false if message isn't a start command or parameter is invalid.
+func (m *Message) StartParameter() (string, bool) {
+	if m.Command() != "start" {
+		return "", false
+	}
+	parameter := m.CommandArgs()
+	if !IsValidStartParameter(parameter) {
+		return "", false
+	}
+	return parameter, true
+}
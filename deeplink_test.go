@@ -0,0 +1,91 @@
+package tg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIsValidStartParameter(t *testing.T) {
+	tests := map[string]bool{
+		"":                      false,
+		"ref_123-abc":           true,
+		"with space":            false,
+		"ünicode":               false,
+		"a=b":                   false,
+		strings.Repeat("a", 64): true,
+		strings.Repeat("a", 65): false,
+	}
+	for parameter, expected := range tests {
+		if IsValidStartParameter(parameter) != expected {
+			t.Errorf("IsValidStartParameter(%q) = %v", parameter, !expected)
+		}
+	}
+}
+
+func TestUser_StartLink(t *testing.T) {
+	bot := &User{Username: "my_bot"}
+	link, err := bot.StartLink("ref_42")
+	if err != nil || link != "https://t.me/my_bot?start=ref_42" {
+		t.Errorf("StartLink() = %q, %v", link, err)
+	}
+	link, err = bot.StartGroupLink("group")
+	if err != nil || link != "https://t.me/my_bot?startgroup=group" {
+		t.Errorf("StartGroupLink() = %q, %v", link, err)
+	}
+	if _, err = bot.StartLink("a b"); err != InvalidStartParameter {
+		t.Errorf("StartLink() error = %v", err)
+	}
+	if _, err = new(User).StartLink("ref"); err != EmptyUsername {
+		t.Errorf("StartLink() error = %v", err)
+	}
+}
+
+func TestStartPayload(t *testing.T) {
+	data := []byte("user:42/campaign:summer")
+	parameter, err := EncodeStartPayload(data)
+	if err != nil {
+		t.Fatalf("EncodeStartPayload() error = %v", err)
+	}
+	decoded, err := DecodeStartPayload(parameter)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("DecodeStartPayload() = %q, %v", decoded, err)
+	}
+	if _, err = EncodeStartPayload(make([]byte, 49)); err != InvalidStartParameter {
+		t.Errorf("EncodeStartPayload() error = %v", err)
+	}
+}
+
+func TestSignStartPayload(t *testing.T) {
+	secret := []byte("secret")
+	parameter, err := SignStartPayload(secret, []byte("42"))
+	if err != nil {
+		t.Fatalf("SignStartPayload() error = %v", err)
+	}
+	data, err := VerifyStartPayload(secret, parameter)
+	if err != nil || string(data) != "42" {
+		t.Errorf("VerifyStartPayload() = %q, %v", data, err)
+	}
+	if _, err = VerifyStartPayload([]byte("other"), parameter); err != InvalidStartSignature {
+		t.Errorf("VerifyStartPayload() error = %v", err)
+	}
+	forged, _ := EncodeStartPayload([]byte("43"))
+	if _, err = VerifyStartPayload(secret, forged); err != InvalidStartSignature {
+		t.Errorf("VerifyStartPayload() error = %v", err)
+	}
+}
+
+func TestMessage_StartParameter(t *testing.T) {
+	message := &Message{Text: "/start ref_42", Entities: []*MessageEntity{{Type: "bot_command", Length: 6}}}
+	if parameter, ok := message.StartParameter(); !ok || parameter != "ref_42" {
+		t.Errorf("StartParameter() = %q, %v", parameter, ok)
+	}
+	message = &Message{Text: "/start", Entities: []*MessageEntity{{Type: "bot_command", Length: 6}}}
+	if _, ok := message.StartParameter(); ok {
+		t.Errorf("StartParameter() should be empty")
+	}
+	message = &Message{Text: "/help ref_42", Entities: []*MessageEntity{{Type: "bot_command", Length: 5}}}
+	if _, ok := message.StartParameter(); ok {
+		t.Errorf("StartParameter() should be empty for other commands")
+	}
+}
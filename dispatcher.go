@@ -0,0 +1,316 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultWorkers is a default size of the Dispatcher workers pool
+	DefaultWorkers = 16
+	// DefaultQueueSize is a default size of the queue of each Dispatcher worker
+	DefaultQueueSize = 64
+)
+
+var DispatcherClosed = errors.New("dispatcher is closed")
+
+// Handler processes the incoming update
+type Handler interface {
+	Handle(ctx context.Context, update *Update) error
+}
+
+// HandlerFunc is an adapter to use ordinary functions as the Handler
+type HandlerFunc func(ctx context.Context, update *Update) error
+
+// Handle calls f(ctx, update)
+func (f HandlerFunc) Handle(ctx context.Context, update *Update) error {
+	return f(ctx, update)
+}
+
+// Interceptor takes the update before it is queued, intercepted update is not passed to the Handler
+type Interceptor interface {
+	Intercept(update *Update) bool
+}
+
+// Middleware wraps the Handler with the additional logic
+type Middleware func(next Handler) Handler
+
+// Chain wraps the handler with middlewares, the first middleware is the outermost one
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Dispatcher processes updates with the bounded pool of workers.
+// Updates are keyed by the chat (or by the user for inline and callback queries without the chat),
+// so updates of one chat are processed sequentially, while different chats are processed in parallel.
+type Dispatcher struct {
+	// Handler processes updates
+	Handler Handler
+	// Workers is a number of parallel workers, DefaultWorkers is used if empty
+	Workers int
+	// QueueSize is a size of the queue of each worker, when the queue is full Dispatch blocks.
+	// DefaultQueueSize is used if empty.
+	QueueSize int
+	// Timeout of the single Handler call, no timeout if empty
+	Timeout time.Duration
+	// Key returns the ordering key of the update, UpdateKey is used if empty
+	Key func(update *Update) int
+	// OnError is called when the Handler returns an error for the update dispatched without callback,
+	// or for the released handler, see Release
+	OnError func(update *Update, err error)
+	// Interceptors take updates before they are queued, e.g. replies for the Asker
+	Interceptors []Interceptor
+
+	once   sync.Once
+	stop   sync.Once
+	mu     sync.RWMutex
+	closed bool
+	quit   chan struct{}
+	queues []chan *job
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type job struct {
+	update *Update
+	// before is called by the worker, the update is finished with its error without the Handler call
+	before func() error
+	done   func(err error)
+	// received is the time the update was received, see ReceivedAt
+	received time.Time
+}
+
+// handlerState is the state of the running Handler call, it is released or finished only once
+type handlerState struct {
+	state    int32
+	released chan struct{}
+}
+
+type handlerContextKey struct{}
+
+const (
+	handlerRunning int32 = iota
+	handlerReleased
+	handlerFinished
+)
+
+// NewDispatcher creates the dispatcher with default settings, workers are started on the first dispatched update
+func NewDispatcher(handler Handler) *Dispatcher {
+	return &Dispatcher{
+		Handler:   handler,
+		Workers:   DefaultWorkers,
+		QueueSize: DefaultQueueSize,
+	}
+}
+
+// UpdateKey returns the ordering key of the update: chat identifier, user identifier or update identifier,
+// if update has neither chat nor user.
+func UpdateKey(update *Update) int {
+	if id := update.ChatId(); id != 0 {
+		return id
+	}
+	if id := update.UserId(); id != 0 {
+		return id
+	}
+	return update.UpdateId
+}
+
+// Dispatch puts the update into the queue of its worker, errors are passed into the OnError.
+// If the queue is full, call blocks until there is a place or the ctx is done.
+func (d *Dispatcher) Dispatch(ctx context.Context, update *Update) error {
+	return d.DispatchFunc(ctx, update, nil)
+}
+
+// DispatchFunc puts the update into the queue of its worker, done is called with the Handler result.
+// If the queue is full, call blocks until there is a place or the ctx is done.
+func (d *Dispatcher) DispatchFunc(ctx context.Context, update *Update, done func(err error)) error {
+	return d.dispatch(ctx, update, nil, done)
+}
+
+// Release frees the Dispatcher worker of the handler ctx, e.g. before the long wait for the next updates:
+// the update is reported as processed and next updates of the worker are handled, while the handler continues.
+// Error of the released handler is passed into the OnError.
+// Release returns false if the ctx is not a Dispatcher handler context, or the handler is already released.
+func Release(ctx context.Context) bool {
+	state, ok := ctx.Value(handlerContextKey{}).(*handlerState)
+	if !ok || !atomic.CompareAndSwapInt32(&state.state, handlerRunning, handlerReleased) {
+		return false
+	}
+	close(state.released)
+	return true
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, update *Update, before func() error, done func(err error)) error {
+	d.once.Do(d.start)
+	for _, interceptor := range d.Interceptors {
+		if interceptor.Intercept(update) {
+			if done != nil {
+				done(nil)
+			}
+			return nil
+		}
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return DispatcherClosed
+	}
+	received := ReceivedAt(ctx)
+	if received.IsZero() {
+		received = time.Now()
+	}
+	queue := d.queues[d.index(update)]
+	select {
+	case queue <- &job{update: update, before: before, done: done, received: received}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.quit:
+		return DispatcherClosed
+	}
+}
+
+// Handle dispatches the update and waits for the result, so Dispatcher can be used as a Handler
+func (d *Dispatcher) Handle(ctx context.Context, update *Update) error {
+	result := make(chan error, 1)
+	err := d.DispatchFunc(ctx, update, func(err error) {
+		result <- err
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case err = <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop stops accepting new updates and waits until all queued updates are processed and released handlers return.
+// If ctx is done before, contexts of the running handlers are cancelled and ctx error is returned.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.once.Do(d.start)
+	// quit is closed before the lock, to release Dispatch calls, blocked on the full queues
+	d.stop.Do(func() {
+		close(d.quit)
+	})
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	d.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) start() {
+	workers := d.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	size := d.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.quit = make(chan struct{})
+	d.queues = make([]chan *job, workers)
+	d.wg.Add(workers)
+	for i := range d.queues {
+		d.queues[i] = make(chan *job, size)
+		go d.work(d.queues[i])
+	}
+}
+
+func (d *Dispatcher) work(queue chan *job) {
+	defer d.wg.Done()
+	for item := range queue {
+		if item.before != nil {
+			if err := item.before(); err != nil {
+				d.finish(item, err)
+				continue
+			}
+		}
+		d.run(item)
+	}
+}
+
+// run calls the Handler and waits until it returns or releases the worker
+func (d *Dispatcher) run(item *job) {
+	state := &handlerState{released: make(chan struct{})}
+	result := make(chan error, 1)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ctx := WithReceivedAt(context.WithValue(d.ctx, handlerContextKey{}, state), item.received)
+		err := d.process(ctx, item.update)
+		if atomic.CompareAndSwapInt32(&state.state, handlerRunning, handlerFinished) {
+			result <- err
+		} else if err != nil && d.OnError != nil {
+			d.OnError(item.update, err)
+		}
+	}()
+	select {
+	case err := <-result:
+		d.finish(item, err)
+	case <-state.released:
+		d.finish(item, nil)
+	}
+}
+
+func (d *Dispatcher) finish(item *job, err error) {
+	if item.done != nil {
+		item.done(err)
+	} else if err != nil && d.OnError != nil {
+		d.OnError(item.update, err)
+	}
+}
+
+func (d *Dispatcher) process(ctx context.Context, update *Update) (err error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return d.Handler.Handle(ctx, update)
+}
+
+func (d *Dispatcher) index(update *Update) int {
+	return int(uint(d.key(update)) % uint(len(d.queues)))
+}
+
+func (d *Dispatcher) key(update *Update) int {
+	if d.Key != nil {
+		return d.Key(update)
+	}
+	return UpdateKey(update)
+}
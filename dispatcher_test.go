@@ -0,0 +1,228 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func chatUpdate(id, chatId int) *Update {
+	return &Update{UpdateId: id, Message: &Message{MessageId: id, Chat: &Chat{Id: chatId}}}
+}
+
+func TestDispatcher_Order(t *testing.T) {
+	var mu sync.Mutex
+	processed := make(map[int][]int)
+	dispatcher := NewDispatcher(HandlerFunc(func(ctx context.Context, update *Update) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		processed[update.ChatId()] = append(processed[update.ChatId()], update.UpdateId)
+		return nil
+	}))
+	dispatcher.Workers = 4
+	ctx := context.Background()
+	for i := 1; i <= 40; i++ {
+		if err := dispatcher.Dispatch(ctx, chatUpdate(i, -(i%3)-1)); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+	if err := dispatcher.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	total := 0
+	for chat, ids := range processed {
+		total += len(ids)
+		for i := 1; i < len(ids); i++ {
+			if ids[i-1] > ids[i] {
+				t.Errorf("wrong order in chat %d: %v", chat, ids)
+			}
+		}
+	}
+	if total != 40 {
+		t.Errorf("all updates should be processed before stop, got %d", total)
+	}
+	if err := dispatcher.Dispatch(ctx, chatUpdate(41, 1)); err != DispatcherClosed {
+		t.Errorf("Dispatch() after stop error = %v", err)
+	}
+}
+
+func TestDispatcher_Parallel(t *testing.T) {
+	var running, max int32
+	release := make(chan struct{})
+	dispatcher := NewDispatcher(HandlerFunc(func(ctx context.Context, update *Update) error {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			value := atomic.LoadInt32(&max)
+			if current <= value || atomic.CompareAndSwapInt32(&max, value, current) {
+				break
+			}
+		}
+		<-release
+		return nil
+	}))
+	dispatcher.Workers = 2
+	ctx := context.Background()
+	_ = dispatcher.Dispatch(ctx, chatUpdate(1, 2))
+	_ = dispatcher.Dispatch(ctx, chatUpdate(2, 3))
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	_ = dispatcher.Stop(ctx)
+	if max != 2 {
+		t.Errorf("different chats should be processed in parallel, max = %d", max)
+	}
+}
+
+func TestDispatcher_Backpressure(t *testing.T) {
+	release := make(chan struct{})
+	dispatcher := NewDispatcher(HandlerFunc(func(ctx context.Context, update *Update) error {
+		<-release
+		return nil
+	}))
+	dispatcher.Workers = 1
+	dispatcher.QueueSize = 1
+	ctx := context.Background()
+	_ = dispatcher.Dispatch(ctx, chatUpdate(1, 1)) // processing
+	time.Sleep(10 * time.Millisecond)
+	_ = dispatcher.Dispatch(ctx, chatUpdate(2, 1)) // queued
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := dispatcher.Dispatch(timeout, chatUpdate(3, 1)); err != context.DeadlineExceeded {
+		t.Errorf("Dispatch() into the full queue error = %v", err)
+	}
+	close(release)
+	_ = dispatcher.Stop(ctx)
+}
+
+func TestDispatcher_Handle(t *testing.T) {
+	failure := errors.New("failure")
+	dispatcher := NewDispatcher(HandlerFunc(func(ctx context.Context, update *Update) error {
+		if update.UpdateId == 2 {
+			panic("boom")
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		<-ctx.Done()
+		return failure
+	}))
+	dispatcher.Timeout = 10 * time.Millisecond
+	ctx := context.Background()
+	if err := dispatcher.Handle(ctx, chatUpdate(1, 1)); err != failure {
+		t.Errorf("Handle() error = %v", err)
+	}
+	if err := dispatcher.Handle(ctx, chatUpdate(2, 1)); err == nil || err.Error() != "handler panic: boom" {
+		t.Errorf("Handle() error = %v", err)
+	}
+
+	var reported int32
+	dispatcher.OnError = func(update *Update, err error) {
+		atomic.AddInt32(&reported, 1)
+	}
+	_ = dispatcher.Dispatch(ctx, chatUpdate(3, 1))
+	_ = dispatcher.Stop(ctx)
+	if reported != 1 {
+		t.Errorf("error should be reported")
+	}
+}
+
+func TestDispatcher_Release(t *testing.T) {
+	failure := errors.New("failure")
+	wait := make(chan struct{})
+	dispatcher := NewDispatcher(HandlerFunc(func(ctx context.Context, update *Update) error {
+		if update.UpdateId != 1 {
+			return nil
+		}
+		if !Release(ctx) || Release(ctx) {
+			return errors.New("not released once")
+		}
+		<-wait
+		return failure
+	}))
+	dispatcher.Workers = 1
+	reported := make(chan error, 1)
+	dispatcher.OnError = func(update *Update, err error) {
+		reported <- err
+	}
+	ctx := context.Background()
+	if err := dispatcher.Handle(ctx, chatUpdate(1, 1)); err != nil {
+		t.Errorf("Handle() of released update error = %v", err)
+	}
+	// the worker is free, while the released handler is waiting
+	if err := dispatcher.Handle(ctx, chatUpdate(2, 1)); err != nil {
+		t.Errorf("Handle() error = %v", err)
+	}
+	close(wait)
+	if err := dispatcher.Stop(ctx); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+	select {
+	case err := <-reported:
+		if err != failure {
+			t.Errorf("reported error = %v", err)
+		}
+	default:
+		t.Errorf("error of the released handler should be reported")
+	}
+	if Release(ctx) {
+		t.Errorf("Release() of the foreign context should fail")
+	}
+}
+
+func TestDispatcher_ReceivedAt(t *testing.T) {
+	received := time.Now().Add(-time.Second)
+	dispatcher := NewDispatcher(HandlerFunc(func(ctx context.Context, update *Update) error {
+		if update.UpdateId == 1 && !ReceivedAt(ctx).Equal(received) || ReceivedAt(ctx).IsZero() {
+			return errors.New("wrong receipt time")
+		}
+		return nil
+	}))
+	defer dispatcher.Stop(context.Background())
+	if err := dispatcher.Handle(WithReceivedAt(context.Background(), received), chatUpdate(1, 1)); err != nil {
+		t.Errorf("Handle() error = %v", err)
+	}
+	if err := dispatcher.Handle(context.Background(), chatUpdate(2, 1)); err != nil {
+		t.Errorf("Handle() error = %v", err)
+	}
+}
+
+func TestDispatcher_StopTimeout(t *testing.T) {
+	dispatcher := NewDispatcher(HandlerFunc(func(ctx context.Context, update *Update) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	_ = dispatcher.Dispatch(context.Background(), chatUpdate(1, 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := dispatcher.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Stop() error = %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	middleware := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, update *Update) error {
+				order = append(order, name)
+				return next.Handle(ctx, update)
+			})
+		}
+	}
+	handler := Chain(HandlerFunc(func(ctx context.Context, update *Update) error {
+		order = append(order, "handler")
+		return nil
+	}), middleware("first"), middleware("second"))
+	if err := handler.Handle(context.Background(), &Update{}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if got := strings.Join(order, ","); got != "first,second,handler" {
+		t.Errorf("Chain() order = %v", got)
+	}
+}
@@ -0,0 +1,269 @@
+package tg
+
+// ChatType is a type of the Chat
+type ChatType string
+
+const (
+	ChatTypePrivate    ChatType = "private"
+	ChatTypeGroup      ChatType = "group"
+	ChatTypeSupergroup ChatType = "supergroup"
+	ChatTypeChannel    ChatType = "channel"
+)
+
+// ChatMemberStatus is a status of the ChatMember
+type ChatMemberStatus string
+
+const (
+	ChatMemberStatusCreator       ChatMemberStatus = "creator"
+	ChatMemberStatusAdministrator ChatMemberStatus = "administrator"
+	ChatMemberStatusMember        ChatMemberStatus = "member"
+	ChatMemberStatusRestricted    ChatMemberStatus = "restricted"
+	ChatMemberStatusLeft          ChatMemberStatus = "left"
+	ChatMemberStatusKicked        ChatMemberStatus = "kicked"
+)
+
+// ChatAction is an action for the SendChatActionRequest
+type ChatAction string
+
+const (
+	ChatActionTyping          ChatAction = "typing"
+	ChatActionUploadPhoto     ChatAction = "upload_photo"
+	ChatActionRecordVideo     ChatAction = "record_video"
+	ChatActionUploadVideo     ChatAction = "upload_video"
+	ChatActionRecordAudio     ChatAction = "record_audio"
+	ChatActionUploadAudio     ChatAction = "upload_audio"
+	ChatActionUploadDocument  ChatAction = "upload_document"
+	ChatActionFindLocation    ChatAction = "find_location"
+	ChatActionRecordVideoNote ChatAction = "record_video_note"
+	ChatActionUploadVideoNote ChatAction = "upload_video_note"
+)
+
+// MessageEntityType is a type of the MessageEntity
+type MessageEntityType string
+
+const (
+	MessageEntityMention     MessageEntityType = "mention"
+	MessageEntityHashtag     MessageEntityType = "hashtag"
+	MessageEntityCashtag     MessageEntityType = "cashtag"
+	MessageEntityBotCommand  MessageEntityType = "bot_command"
+	MessageEntityUrl         MessageEntityType = "url"
+	MessageEntityEmail       MessageEntityType = "email"
+	MessageEntityPhoneNumber MessageEntityType = "phone_number"
+	MessageEntityBold        MessageEntityType = "bold"
+	MessageEntityItalic      MessageEntityType = "italic"
+	MessageEntityCode        MessageEntityType = "code"
+	MessageEntityPre         MessageEntityType = "pre"
+	MessageEntityTextLink    MessageEntityType = "text_link"
+	MessageEntityTextMention MessageEntityType = "text_mention"
+)
+
+// PassportElementType is a type of the EncryptedPassportElement
+type PassportElementType string
+
+const (
+	PassportElementPersonalDetails       PassportElementType = "personal_details"
+	PassportElementPassport              PassportElementType = "passport"
+	PassportElementDriverLicense         PassportElementType = "driver_license"
+	PassportElementIdentityCard          PassportElementType = "identity_card"
+	PassportElementInternalPassport      PassportElementType = "internal_passport"
+	PassportElementAddress               PassportElementType = "address"
+	PassportElementUtilityBill           PassportElementType = "utility_bill"
+	PassportElementBankStatement         PassportElementType = "bank_statement"
+	PassportElementRentalAgreement       PassportElementType = "rental_agreement"
+	PassportElementPassportRegistration  PassportElementType = "passport_registration"
+	PassportElementTemporaryRegistration PassportElementType = "temporary_registration"
+	PassportElementPhoneNumber           PassportElementType = "phone_number"
+	PassportElementEmail                 PassportElementType = "email"
+)
+
+// UpdateType is a name of the Update field, used in the AllowedUpdates lists
+type UpdateType string
+
+const (
+	UpdateTypeMessage            UpdateType = "message"
+	UpdateTypeEditedMessage      UpdateType = "edited_message"
+	UpdateTypeChannelPost        UpdateType = "channel_post"
+	UpdateTypeEditedChannelPost  UpdateType = "edited_channel_post"
+	UpdateTypeInlineQuery        UpdateType = "inline_query"
+	UpdateTypeChosenInlineResult UpdateType = "chosen_inline_result"
+	UpdateTypeCallbackQuery      UpdateType = "callback_query"
+	UpdateTypeShippingQuery      UpdateType = "shipping_query"
+	UpdateTypePreCheckoutQuery   UpdateType = "pre_checkout_query"
+	UpdateTypePoll               UpdateType = "poll"
+)
+
+// Permission is an administrator right of the ChatMember
+type Permission string
+
+const (
+	PermissionChangeInfo      Permission = "can_change_info"
+	PermissionPostMessages    Permission = "can_post_messages"
+	PermissionEditMessages    Permission = "can_edit_messages"
+	PermissionDeleteMessages  Permission = "can_delete_messages"
+	PermissionInviteUsers     Permission = "can_invite_users"
+	PermissionRestrictMembers Permission = "can_restrict_members"
+	PermissionPinMessages     Permission = "can_pin_messages"
+	PermissionPromoteMembers  Permission = "can_promote_members"
+)
+
+// AllowedUpdates converts list of UpdateType into the AllowedUpdates field value
+func AllowedUpdates(types ...UpdateType) []string {
+	result := make([]string, 0, len(types))
+	for _, t := range types {
+		result = append(result, t.String())
+	}
+	return result
+}
+
+func (t ChatType) String() string {
+	return string(t)
+}
+
+func (t ChatType) IsValid() bool {
+	switch t {
+	case ChatTypePrivate, ChatTypeGroup, ChatTypeSupergroup, ChatTypeChannel:
+		return true
+	}
+	return false
+}
+
+func (s ChatMemberStatus) String() string {
+	return string(s)
+}
+
+func (s ChatMemberStatus) IsValid() bool {
+	switch s {
+	case ChatMemberStatusCreator, ChatMemberStatusAdministrator, ChatMemberStatusMember,
+		ChatMemberStatusRestricted, ChatMemberStatusLeft, ChatMemberStatusKicked:
+		return true
+	}
+	return false
+}
+
+func (a ChatAction) String() string {
+	return string(a)
+}
+
+func (a ChatAction) IsValid() bool {
+	switch a {
+	case ChatActionTyping, ChatActionUploadPhoto, ChatActionRecordVideo, ChatActionUploadVideo,
+		ChatActionRecordAudio, ChatActionUploadAudio, ChatActionUploadDocument, ChatActionFindLocation,
+		ChatActionRecordVideoNote, ChatActionUploadVideoNote:
+		return true
+	}
+	return false
+}
+
+func (t MessageEntityType) String() string {
+	return string(t)
+}
+
+func (t MessageEntityType) IsValid() bool {
+	switch t {
+	case MessageEntityMention, MessageEntityHashtag, MessageEntityCashtag, MessageEntityBotCommand,
+		MessageEntityUrl, MessageEntityEmail, MessageEntityPhoneNumber, MessageEntityBold,
+		MessageEntityItalic, MessageEntityCode, MessageEntityPre, MessageEntityTextLink,
+		MessageEntityTextMention:
+		return true
+	}
+	return false
+}
+
+func (t PassportElementType) String() string {
+	return string(t)
+}
+
+func (t PassportElementType) IsValid() bool {
+	switch t {
+	case PassportElementPersonalDetails, PassportElementPassport, PassportElementDriverLicense,
+		PassportElementIdentityCard, PassportElementInternalPassport, PassportElementAddress,
+		PassportElementUtilityBill, PassportElementBankStatement, PassportElementRentalAgreement,
+		PassportElementPassportRegistration, PassportElementTemporaryRegistration,
+		PassportElementPhoneNumber, PassportElementEmail:
+		return true
+	}
+	return false
+}
+
+func (t UpdateType) String() string {
+	return string(t)
+}
+
+func (t UpdateType) IsValid() bool {
+	switch t {
+	case UpdateTypeMessage, UpdateTypeEditedMessage, UpdateTypeChannelPost, UpdateTypeEditedChannelPost,
+		UpdateTypeInlineQuery, UpdateTypeChosenInlineResult, UpdateTypeCallbackQuery,
+		UpdateTypeShippingQuery, UpdateTypePreCheckoutQuery, UpdateTypePoll:
+		return true
+	}
+	return false
+}
+
+func (p Permission) String() string {
+	return string(p)
+}
+
+func (p Permission) IsValid() bool {
+	switch p {
+	case PermissionChangeInfo, PermissionPostMessages, PermissionEditMessages, PermissionDeleteMessages,
+		PermissionInviteUsers, PermissionRestrictMembers, PermissionPinMessages, PermissionPromoteMembers:
+		return true
+	}
+	return false
+}
+
+// IsPrivate returns true for the private chat with a user
+func (c *Chat) IsPrivate() bool {
+	return c != nil && ChatType(c.Type) == ChatTypePrivate
+}
+
+// IsGroup returns true for the basic group chat
+func (c *Chat) IsGroup() bool {
+	return c != nil && ChatType(c.Type) == ChatTypeGroup
+}
+
+// IsSupergroup returns true for the supergroup chat
+func (c *Chat) IsSupergroup() bool {
+	return c != nil && ChatType(c.Type) == ChatTypeSupergroup
+}
+
+// IsChannel returns true for the channel
+func (c *Chat) IsChannel() bool {
+	return c != nil && ChatType(c.Type) == ChatTypeChannel
+}
+
+// IsCreator returns true if member is an owner of the chat
+func (m *ChatMember) IsCreator() bool {
+	return m != nil && ChatMemberStatus(m.Status) == ChatMemberStatusCreator
+}
+
+// IsAdmin returns true if member is an administrator or the creator of the chat
+func (m *ChatMember) IsAdmin() bool {
+	return m != nil && (ChatMemberStatus(m.Status) == ChatMemberStatusCreator ||
+		ChatMemberStatus(m.Status) == ChatMemberStatusAdministrator)
+}
+
+// IsRestricted returns true if member is restricted in the chat
+func (m *ChatMember) IsRestricted() bool {
+	return m != nil && ChatMemberStatus(m.Status) == ChatMemberStatusRestricted
+}
+
+// IsKicked returns true if member was kicked from the chat
+func (m *ChatMember) IsKicked() bool {
+	return m != nil && ChatMemberStatus(m.Status) == ChatMemberStatusKicked
+}
+
+// IsChatMember returns true if user is present in the chat at the moment, restricted members are included.
+// Method can't be named as IsMember, because of the field with the same name.
+func (m *ChatMember) IsChatMember() bool {
+	if m == nil {
+		return false
+	}
+	switch ChatMemberStatus(m.Status) {
+	case ChatMemberStatusCreator, ChatMemberStatusAdministrator, ChatMemberStatusMember:
+		return true
+	case ChatMemberStatusRestricted:
+		return m.IsMember
+	}
+	return false
+}
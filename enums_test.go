@@ -0,0 +1,75 @@
+package tg
+
+import "testing"
+
+func TestEnums_IsValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+		value interface{ IsValid() bool }
+	}{
+		{name: "chat type", valid: true, value: ChatTypeSupergroup},
+		{name: "unknown chat type", valid: false, value: ChatType("secret")},
+		{name: "member status", valid: true, value: ChatMemberStatusKicked},
+		{name: "unknown member status", valid: false, value: ChatMemberStatus("banned")},
+		{name: "chat action", valid: true, value: ChatActionRecordVideoNote},
+		{name: "unknown chat action", valid: false, value: ChatAction("dancing")},
+		{name: "entity type", valid: true, value: MessageEntityTextMention},
+		{name: "unknown entity type", valid: false, value: MessageEntityType("")},
+		{name: "passport element", valid: true, value: PassportElementUtilityBill},
+		{name: "unknown passport element", valid: false, value: PassportElementType("visa")},
+		{name: "update type", valid: true, value: UpdateTypePreCheckoutQuery},
+		{name: "unknown update type", valid: false, value: UpdateType("update_id")},
+		{name: "permission", valid: true, value: PermissionPinMessages},
+		{name: "unknown permission", valid: false, value: Permission("can_fly")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.value.IsValid() != test.valid {
+				t.Errorf("IsValid() = %v, expected %v", !test.valid, test.valid)
+			}
+		})
+	}
+}
+
+func TestChat_Types(t *testing.T) {
+	chat := &Chat{Type: "channel"}
+	if !chat.IsChannel() || chat.IsPrivate() || chat.IsGroup() || chat.IsSupergroup() {
+		t.Errorf("wrong chat type detection: %#v", chat)
+	}
+	if (*Chat)(nil).IsPrivate() {
+		t.Errorf("nil chat can't be private")
+	}
+}
+
+func TestChatMember_Status(t *testing.T) {
+	tests := []struct {
+		member *ChatMember
+		admin  bool
+		in     bool
+	}{
+		{member: &ChatMember{Status: "creator"}, admin: true, in: true},
+		{member: &ChatMember{Status: "administrator"}, admin: true, in: true},
+		{member: &ChatMember{Status: "member"}, admin: false, in: true},
+		{member: &ChatMember{Status: "restricted", IsMember: true}, admin: false, in: true},
+		{member: &ChatMember{Status: "restricted"}, admin: false, in: false},
+		{member: &ChatMember{Status: "left"}, admin: false, in: false},
+		{member: &ChatMember{Status: "kicked"}, admin: false, in: false},
+		{member: nil, admin: false, in: false},
+	}
+	for _, test := range tests {
+		if test.member.IsAdmin() != test.admin {
+			t.Errorf("IsAdmin(%#v) = %v", test.member, !test.admin)
+		}
+		if test.member.IsChatMember() != test.in {
+			t.Errorf("IsChatMember(%#v) = %v", test.member, !test.in)
+		}
+	}
+}
+
+func TestAllowedUpdates(t *testing.T) {
+	result := AllowedUpdates(UpdateTypeMessage, UpdateTypeCallbackQuery)
+	if len(result) != 2 || result[0] != "message" || result[1] != "callback_query" {
+		t.Errorf("wrong result: %v", result)
+	}
+}
@@ -26,27 +26,34 @@ func main() {
 			updates, err := bot.GetUpdates(ctx, &GetUpdatesRequest{
 				Offset:         last + 1,
 				Limit:          10,
-				AllowedUpdates: []string{"message"},
+				AllowedUpdates: AllowedUpdates(UpdateTypeMessage),
 			})
 			check(err)
 
 			for i, update := range updates {
 				fmt.Printf("update [%03d]: %#v\n", i, update.Message)
 				last = update.UpdateId
-				if update.Message != nil {
-					if update.Message.Sticker != nil {
-						_, err = bot.SendMessage(ctx, &SendMessageRequest{
-							ChatId:    update.Message.Chat.Id,
-							Text:      "You send me a sticker: _" + update.Message.Sticker.FileId + "_ from *" + update.Message.Sticker.SetName + "*",
-							ParseMode: "Markdown",
-						})
-					} else {
-						_, err = bot.SendMessage(ctx, &SendMessageRequest{
-							ChatId:    update.Message.Chat.Id,
-							Text:      "You wrote me: _" + update.Message.Text + "_",
-							ParseMode: "Markdown",
-						})
-					}
+				switch update.Message.Kind() {
+				case MessageKindUnknown:
+				case MessageKindSticker:
+					_, err = bot.SendMessage(ctx, &SendMessageRequest{
+						ChatId:    update.Message.ChatId(),
+						Text:      "You send me a sticker: _" + update.Message.FileId() + "_ from *" + update.Message.Sticker.SetName + "*",
+						ParseMode: "Markdown",
+					})
+					check(err)
+				case MessageKindText:
+					_, err = bot.SendMessage(ctx, &SendMessageRequest{
+						ChatId:    update.Message.ChatId(),
+						Text:      "You wrote me: _" + update.Message.Text + "_",
+						ParseMode: "Markdown",
+					})
+					check(err)
+				default:
+					_, err = bot.SendMessage(ctx, &SendMessageRequest{
+						ChatId: update.Message.ChatId(),
+						Text:   "You send me a " + update.Message.Kind().String(),
+					})
 					check(err)
 				}
 			}
@@ -0,0 +1,282 @@
+package tg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultGameTokenTTL is a default lifetime of the player token
+	DefaultGameTokenTTL = 24 * time.Hour
+	// DefaultGameTokenParameter is a default name of the query parameter with the player token in the game URL
+	DefaultGameTokenParameter = "token"
+	// gameSignatureLength is a length of the truncated HMAC signature of the player token
+	gameSignatureLength = 16
+)
+
+var (
+	UnknownGame      = errors.New("unknown game")
+	InvalidGameToken = errors.New("invalid game token")
+	GameTokenExpired = errors.New("game token is expired")
+	InvalidGameScore = errors.New("invalid game score")
+	EmptyGameSecret  = errors.New("empty game secret")
+)
+
+// GameSettings is the game, registered with the BotFather
+type GameSettings struct {
+	// Url of the game page, the player token is added as the query parameter
+	Url string
+	// Force allows to decrease the high score, e.g. for fixing mistakes
+	Force bool
+	// DisableEditMessage doesn't edit the game message with the scoreboard
+	DisableEditMessage bool
+}
+
+// GamePlayer is the player context of the game session: the user and the game message
+type GamePlayer struct {
+	Game            string `json:"g"`
+	UserId          int    `json:"u"`
+	ChatId          int    `json:"c,omitempty"`
+	MessageId       int    `json:"m,omitempty"`
+	InlineMessageId string `json:"i,omitempty"`
+	Expires         int64  `json:"e"`
+}
+
+// Games answers the callback_game queries with URLs of the games, that carry the signed player token,
+// and sets scores, submitted by the game pages. Games is the http.Handler of the score endpoint:
+// game page sends the POST request with the "token" and "score" form values or the JSON body with the same fields.
+type Games struct {
+	Bot *Bot
+	// Secret signs player tokens, it is required: Sign, Verify and Play return EmptyGameSecret if it is empty
+	Secret []byte
+	// Games by the short name
+	Games map[string]*GameSettings
+	// TokenTTL is a lifetime of the player token, DefaultGameTokenTTL is used if empty
+	TokenTTL time.Duration
+	// Parameter is a name of the query parameter with the token, DefaultGameTokenParameter is used if empty
+	Parameter string
+	// OnScore is called after the new high score is set
+	OnScore func(ctx context.Context, player *GamePlayer, score int) error
+}
+
+// NewGames creates the games module
+func NewGames(bot *Bot, secret []byte) *Games {
+	return &Games{
+		Bot:    bot,
+		Secret: secret,
+		Games:  make(map[string]*GameSettings),
+	}
+}
+
+// Add registers the game with the URL
+func (g *Games) Add(shortName, url string) *GameSettings {
+	if g.Games == nil {
+		g.Games = make(map[string]*GameSettings)
+	}
+	game := &GameSettings{Url: url}
+	g.Games[shortName] = game
+	return game
+}
+
+// Middleware returns the Middleware, that answers callback_game queries, other updates are passed to the next handler
+func (g *Games) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			if query := update.CallbackQuery; query != nil && query.GameShortName != "" {
+				return g.Play(ctx, query)
+			}
+			return next.Handle(ctx, update)
+		})
+	}
+}
+
+// Play answers the callback query with the URL of its game, unknown games are answered with the alert
+func (g *Games) Play(ctx context.Context, query *CallbackQuery) error {
+	if _, ok := g.Games[query.GameShortName]; !ok {
+		if err := g.Bot.Alert(ctx, query, "Unknown game"); err != nil {
+			return err
+		}
+		return UnknownGame
+	}
+	player := &GamePlayer{Game: query.GameShortName}
+	if query.From != nil {
+		player.UserId = query.From.Id
+	}
+	player.ChatId, player.MessageId, player.InlineMessageId = query.target()
+	link, err := g.Url(player)
+	if err != nil {
+		return err
+	}
+	return g.Bot.Answer(ctx, &AnswerCallbackQueryRequest{CallbackQueryId: query.Id, Url: link})
+}
+
+// Url returns the URL of the player game with the signed token
+func (g *Games) Url(player *GamePlayer) (string, error) {
+	game, ok := g.Games[player.Game]
+	if !ok {
+		return "", UnknownGame
+	}
+	link, err := url.Parse(game.Url)
+	if err != nil {
+		return "", err
+	}
+	token, err := g.Sign(player)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set(g.parameter(), token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// Sign returns the token of the player, that expires after the TokenTTL
+func (g *Games) Sign(player *GamePlayer) (string, error) {
+	if len(g.Secret) == 0 {
+		return "", EmptyGameSecret
+	}
+	ttl := g.TokenTTL
+	if ttl <= 0 {
+		ttl = DefaultGameTokenTTL
+	}
+	signed := *player
+	signed.Expires = now().Add(ttl).Unix()
+	data, err := json.Marshal(&signed)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + g.sign(payload), nil
+}
+
+// Verify checks the signature and the expiration of the token and returns its player
+func (g *Games) Verify(token string) (*GamePlayer, error) {
+	if len(g.Secret) == 0 {
+		return nil, EmptyGameSecret
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(g.sign(parts[0]))) {
+		return nil, InvalidGameToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, InvalidGameToken
+	}
+	player := new(GamePlayer)
+	if err = json.Unmarshal(data, player); err != nil {
+		return nil, InvalidGameToken
+	}
+	if now().Unix() > player.Expires {
+		return nil, GameTokenExpired
+	}
+	return player, nil
+}
+
+// SetScore sets the score of the player with the Force and DisableEditMessage policies of the game.
+// Score, that is not greater than the high score, is ignored unless Force is set.
+func (g *Games) SetScore(ctx context.Context, player *GamePlayer, score int) error {
+	game, ok := g.Games[player.Game]
+	if !ok {
+		return UnknownGame
+	}
+	if score < 0 {
+		return InvalidGameScore
+	}
+	// result is true for inline messages and the message otherwise
+	var result json.RawMessage
+	err := g.Bot.postResult(ctx, "setGameScore", &SetGameScoreRequest{
+		UserId:             player.UserId,
+		Score:              score,
+		Force:              game.Force,
+		DisableEditMessage: game.DisableEditMessage,
+		ChatId:             player.ChatId,
+		MessageId:          player.MessageId,
+		InlineMessageId:    player.InlineMessageId,
+	}, &result)
+	if response := ErrorResponse(err); response != nil && strings.Contains(response.Description, "BOT_SCORE_NOT_MODIFIED") {
+		return nil
+	}
+	if err != nil || g.OnScore == nil {
+		return err
+	}
+	return g.OnScore(ctx, player, score)
+}
+
+// HighScores returns the high scores of the player game
+func (g *Games) HighScores(ctx context.Context, player *GamePlayer) ([]*GameHighScore, error) {
+	var result []*GameHighScore
+	err := g.Bot.postResult(ctx, "getGameHighScores", &GetGameHighScoresRequest{
+		UserId:          player.UserId,
+		ChatId:          player.ChatId,
+		MessageId:       player.MessageId,
+		InlineMessageId: player.InlineMessageId,
+	}, &result)
+	return result, err
+}
+
+// ServeHTTP sets the submitted score: 204 No Content on success, 403 Forbidden for the invalid token,
+// 500 Internal Server Error if the Secret is empty
+func (g *Games) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Token string `json:"token"`
+		Score int    `json:"score"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, InvalidGameScore.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		body.Token = r.FormValue("token")
+		score, err := strconv.Atoi(r.FormValue("score"))
+		if err != nil {
+			http.Error(w, InvalidGameScore.Error(), http.StatusBadRequest)
+			return
+		}
+		body.Score = score
+	}
+	player, err := g.Verify(body.Token)
+	if err == EmptyGameSecret {
+		g.Bot.debug("game score failed: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	switch err = g.SetScore(r.Context(), player, body.Score); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case InvalidGameScore, UnknownGame:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		g.Bot.debug("game score failed: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	}
+}
+
+func (g *Games) sign(payload string) string {
+	mac := hmac.New(sha256.New, g.Secret)
+	_, _ = mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:gameSignatureLength])
+}
+
+func (g *Games) parameter() string {
+	if g.Parameter != "" {
+		return g.Parameter
+	}
+	return DefaultGameTokenParameter
+}
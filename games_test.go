@@ -0,0 +1,123 @@
+package tg_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestGames(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+	games := tg.NewGames(bot, []byte("secret"))
+	games.Add("tetris", "https://example.com/tetris?lang=en")
+	scores := make([]int, 0)
+	games.OnScore = func(ctx context.Context, player *tg.GamePlayer, score int) error {
+		scores = append(scores, score)
+		return nil
+	}
+	endpoint := httptest.NewServer(games)
+	defer endpoint.Close()
+
+	message, err := bot.SendGame(ctx, &tg.SendGameRequest{ChatId: 1, GameShortName: "tetris"})
+	if err != nil {
+		t.Fatalf("SendGame() error = %v", err)
+	}
+	handler := tg.Chain(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error { return nil }), games.Middleware())
+	err = handler.Handle(ctx, &tg.Update{CallbackQuery: &tg.CallbackQuery{
+		Id: "1", From: &tg.User{Id: 7}, Message: message, GameShortName: "tetris",
+	}})
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	answer := new(tg.AnswerCallbackQueryRequest)
+	if call := server.LastCall("answerCallbackQuery"); call == nil || call.Decode(answer) != nil {
+		t.Fatalf("answerCallbackQuery was not called")
+	}
+	link, err := url.Parse(answer.Url)
+	if err != nil || link.Host != "example.com" || link.Query().Get("lang") != "en" {
+		t.Fatalf("game url = %v, %v", answer.Url, err)
+	}
+	token := link.Query().Get(tg.DefaultGameTokenParameter)
+	player, err := games.Verify(token)
+	if err != nil || player.UserId != 7 || player.ChatId != 1 || player.MessageId != message.MessageId {
+		t.Fatalf("Verify() = %+v, %v", player, err)
+	}
+
+	submit := func(token, score string) int {
+		response, err := http.PostForm(endpoint.URL, url.Values{"token": {token}, "score": {score}})
+		if err != nil {
+			t.Fatalf("PostForm() error = %v", err)
+		}
+		_ = response.Body.Close()
+		return response.StatusCode
+	}
+	tests := []struct {
+		name   string
+		token  string
+		score  string
+		status int
+	}{
+		{name: "score", token: token, score: "100", status: http.StatusNoContent},
+		{name: "lower score", token: token, score: "50", status: http.StatusNoContent},
+		{name: "negative score", token: token, score: "-1", status: http.StatusBadRequest},
+		{name: "not a number", token: token, score: "many", status: http.StatusBadRequest},
+		{name: "forged token", token: token[:len(token)-2] + "AA", score: "1000", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if status := submit(tt.token, tt.score); status != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.status)
+		}
+	}
+	if len(scores) != 1 || scores[0] != 100 {
+		t.Errorf("OnScore calls = %v", scores)
+	}
+	high, err := games.HighScores(ctx, player)
+	if err != nil || len(high) != 1 || high[0].Score != 100 {
+		t.Errorf("HighScores() = %v, %v", high, err)
+	}
+
+	// inline game with the JSON body
+	inline, err := games.Sign(&tg.GamePlayer{Game: "tetris", UserId: 7, InlineMessageId: "inline-1"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	response, err := http.Post(endpoint.URL, "application/json", strings.NewReader(`{"token":"`+inline+`","score":10}`))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	_ = response.Body.Close()
+	request := new(tg.SetGameScoreRequest)
+	if response.StatusCode != http.StatusNoContent || server.LastCall("setGameScore").Decode(request) != nil ||
+		request.InlineMessageId != "inline-1" || request.Score != 10 {
+		t.Errorf("inline score = %d, %+v", response.StatusCode, request)
+	}
+
+	// unknown game is answered with the alert
+	err = handler.Handle(ctx, &tg.Update{CallbackQuery: &tg.CallbackQuery{Id: "2", From: &tg.User{Id: 7}, GameShortName: "chess"}})
+	if err != tg.UnknownGame {
+		t.Errorf("Handle() unknown game error = %v", err)
+	}
+}
+
+func TestGames_EmptySecret(t *testing.T) {
+	games := tg.NewGames(nil, nil)
+	if _, err := games.Sign(&tg.GamePlayer{Game: "tetris", UserId: 7}); err != tg.EmptyGameSecret {
+		t.Errorf("Sign() error = %v", err)
+	}
+	token, err := tg.NewGames(nil, []byte("secret")).Sign(&tg.GamePlayer{Game: "tetris", UserId: 7})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err = games.Verify(token); err != tg.EmptyGameSecret {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
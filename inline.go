@@ -0,0 +1,396 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxInlineResults is a maximal number of results in the answer of the inline query
+	MaxInlineResults = 50
+	// MaxInlineOffsetLength is a maximal length of the next offset of the inline query answer
+	MaxInlineOffsetLength = 64
+	// DefaultServedLimit is a default number of served results, remembered for the ChosenInlineResult correlation
+	DefaultServedLimit = 10000
+	// DefaultServedTTL is a default time, served results are remembered for the ChosenInlineResult correlation
+	DefaultServedTTL = time.Hour
+)
+
+var (
+	InvalidInlineOffset = errors.New("invalid inline query offset")
+	InvalidInlineResult = errors.New("inline query result has no id")
+)
+
+// InlineResult is the result of the inline query, e.g. *InlineQueryResultArticle.
+// Generated InlineQueryResult has no fields, so typed results implement InlineResult instead.
+type InlineResult interface {
+	// InlineResultId returns the identifier of the result
+	InlineResultId() string
+}
+
+// InlineSource returns the page of results for the query, starting from the offset, and the offset of the next page.
+// Zero next offset means there are no more results.
+type InlineSource func(ctx context.Context, query string, offset, limit int) (results []InlineResult, next int, err error)
+
+// InlinePager answers inline queries with pages of the InlineSource results:
+// it encodes the next offset, limits the page size, removes duplicated result identifiers and caches pages.
+// Served results are remembered, so ChosenInlineResult updates are correlated with them.
+type InlinePager struct {
+	Bot    *Bot
+	Source InlineSource
+	// PageSize is a number of results in the page, MaxInlineResults is used if empty
+	PageSize int
+	// CacheTime of the results on the Telegram server, API default is used if empty
+	CacheTime time.Duration
+	// IsPersonal caches results on the Telegram server for the user, that sent the query, only
+	IsPersonal bool
+	// Cache stores pages of the Source locally, no local cache if empty
+	Cache SessionStore
+	// CacheTTL is a lifetime of the locally cached page, no expiration if empty
+	CacheTTL time.Duration
+	// OnChosen is called for the ChosenInlineResult update with the served result, or nil if it is not remembered
+	OnChosen func(ctx context.Context, chosen *ChosenInlineResult, served *ServedInlineResult) error
+
+	once   sync.Once
+	served *MemoryStorage
+}
+
+// ServedInlineResult is the result, sent to the user
+type ServedInlineResult struct {
+	Id     string          `json:"id"`
+	UserId int             `json:"user_id"`
+	Query  string          `json:"query"`
+	Offset int             `json:"offset"`
+	Result json.RawMessage `json:"result"`
+}
+
+type inlinePage struct {
+	Results []json.RawMessage `json:"results"`
+	Next    int               `json:"next,omitempty"`
+}
+
+// NewInlinePager creates the pager of the source results
+func NewInlinePager(bot *Bot, source InlineSource) *InlinePager {
+	return &InlinePager{
+		Bot:    bot,
+		Source: source,
+	}
+}
+
+// Middleware returns the Middleware, that answers inline queries and correlates chosen results,
+// other updates are passed to the next handler
+func (p *InlinePager) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			switch {
+			case update.InlineQuery != nil:
+				return p.Answer(ctx, update.InlineQuery)
+			case update.ChosenInlineResult != nil:
+				if p.OnChosen == nil {
+					return next.Handle(ctx, update)
+				}
+				return p.OnChosen(ctx, update.ChosenInlineResult, p.Chosen(update.ChosenInlineResult))
+			}
+			return next.Handle(ctx, update)
+		})
+	}
+}
+
+// Answer answers the inline query with the page of results from the query offset
+func (p *InlinePager) Answer(ctx context.Context, query *InlineQuery) error {
+	offset, err := DecodeInlineOffset(query.Offset)
+	if err != nil {
+		return err
+	}
+	page, err := p.page(ctx, query, offset)
+	if err != nil {
+		return err
+	}
+	results := make([]json.RawMessage, 0, len(page.Results))
+	seen := make(map[string]bool, len(page.Results))
+	for _, result := range page.Results {
+		id, err := inlineResultId(result)
+		if err != nil {
+			return err
+		}
+		if seen[id] || p.servedBefore(query, offset, id) {
+			continue
+		}
+		seen[id] = true
+		results = append(results, result)
+		p.serve(query, offset, id, result)
+	}
+
+	body := &struct {
+		InlineQueryId string            `json:"inline_query_id"`
+		Results       []json.RawMessage `json:"results"`
+		CacheTime     int               `json:"cache_time,omitempty"`
+		IsPersonal    bool              `json:"is_personal,omitempty"`
+		NextOffset    string            `json:"next_offset,omitempty"`
+	}{
+		InlineQueryId: query.Id,
+		Results:       results,
+		CacheTime:     int(p.CacheTime / time.Second),
+		IsPersonal:    p.IsPersonal,
+	}
+	if page.Next > 0 {
+		if body.NextOffset, err = EncodeInlineOffset(page.Next); err != nil {
+			return err
+		}
+	}
+	var ok bool
+	return p.Bot.postResult(ctx, "answerInlineQuery", body, &ok)
+}
+
+// Chosen returns the served result of the chosen inline result, or nil
+func (p *InlinePager) Chosen(chosen *ChosenInlineResult) *ServedInlineResult {
+	if chosen.From == nil {
+		return nil
+	}
+	data, err := p.store().Get(servedKey(chosen.From.Id, chosen.ResultId))
+	if err != nil {
+		return nil
+	}
+	served := new(ServedInlineResult)
+	if json.Unmarshal(data, served) != nil {
+		return nil
+	}
+	return served
+}
+
+// EncodeInlineOffset encodes the offset of the next page
+func EncodeInlineOffset(offset int) (string, error) {
+	encoded := strconv.FormatInt(int64(offset), 36)
+	if offset < 0 || len(encoded) > MaxInlineOffsetLength {
+		return "", InvalidInlineOffset
+	}
+	return encoded, nil
+}
+
+// DecodeInlineOffset decodes the offset of the inline query, empty offset is the first page
+func DecodeInlineOffset(offset string) (int, error) {
+	if offset == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(offset, 36, 0)
+	if err != nil || value < 0 {
+		return 0, InvalidInlineOffset
+	}
+	return int(value), nil
+}
+
+func (p *InlinePager) page(ctx context.Context, query *InlineQuery, offset int) (*inlinePage, error) {
+	key := p.cacheKey(query, offset)
+	if p.Cache != nil {
+		if data, err := p.Cache.Get(key); err == nil {
+			page := new(inlinePage)
+			if err = json.Unmarshal(data, page); err == nil {
+				return page, nil
+			}
+		}
+	}
+
+	limit := p.PageSize
+	if limit <= 0 || limit > MaxInlineResults {
+		limit = MaxInlineResults
+	}
+	results, next, err := p.Source(ctx, query.Query, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > limit {
+		// the rest of the results is requested with the next page
+		results, next = results[:limit], offset+limit
+	}
+	page := &inlinePage{
+		Results: make([]json.RawMessage, 0, len(results)),
+		Next:    next,
+	}
+	for _, result := range results {
+		if result == nil || result.InlineResultId() == "" {
+			return nil, InvalidInlineResult
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		page.Results = append(page.Results, data)
+	}
+	if p.Cache != nil {
+		data, err := json.Marshal(page)
+		if err != nil {
+			return nil, err
+		}
+		if err = p.Cache.SetWithTTL(key, data, p.CacheTTL); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// servedBefore checks if the result was served on the other page of the same query
+func (p *InlinePager) servedBefore(query *InlineQuery, offset int, id string) bool {
+	if offset == 0 || query.From == nil {
+		return false
+	}
+	data, err := p.store().Get(servedKey(query.From.Id, id))
+	if err != nil {
+		return false
+	}
+	served := new(ServedInlineResult)
+	return json.Unmarshal(data, served) == nil && served.Query == query.Query && served.Offset != offset
+}
+
+func (p *InlinePager) serve(query *InlineQuery, offset int, id string, result json.RawMessage) {
+	if query.From == nil {
+		return
+	}
+	data, err := json.Marshal(&ServedInlineResult{
+		Id:     id,
+		UserId: query.From.Id,
+		Query:  query.Query,
+		Offset: offset,
+		Result: result,
+	})
+	if err == nil {
+		_ = p.store().SetWithTTL(servedKey(query.From.Id, id), data, DefaultServedTTL)
+	}
+}
+
+func (p *InlinePager) store() *MemoryStorage {
+	p.once.Do(func() {
+		p.served = NewMemoryStorage()
+		p.served.Limit = DefaultServedLimit
+	})
+	return p.served
+}
+
+func (p *InlinePager) cacheKey(query *InlineQuery, offset int) string {
+	if p.IsPersonal && query.From != nil {
+		return fmt.Sprintf("inline:%d:%d:%s", query.From.Id, offset, query.Query)
+	}
+	return fmt.Sprintf("inline:%d:%s", offset, query.Query)
+}
+
+func servedKey(userId int, resultId string) string {
+	return fmt.Sprintf("%d:%s", userId, resultId)
+}
+
+// inlineResultId returns the identifier of the encoded inline query result
+func inlineResultId(result json.RawMessage) (string, error) {
+	var value struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(result, &value); err != nil {
+		return "", err
+	}
+	if value.Id == "" {
+		return "", InvalidInlineResult
+	}
+	return value.Id, nil
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultArticle) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultAudio) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedAudio) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedDocument) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedGif) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedMpeg4Gif) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedPhoto) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedSticker) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedVideo) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultCachedVoice) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultContact) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultDocument) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultGame) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultGif) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultLocation) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultMpeg4Gif) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultPhoto) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultVenue) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultVideo) InlineResultId() string {
+	return r.Id
+}
+
+// InlineResultId implements the InlineResult
+func (r *InlineQueryResultVoice) InlineResultId() string {
+	return r.Id
+}
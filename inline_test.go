@@ -0,0 +1,150 @@
+package tg_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+type inlineAnswer struct {
+	InlineQueryId string                         `json:"inline_query_id"`
+	Results       []*tg.InlineQueryResultArticle `json:"results"`
+	CacheTime     int                            `json:"cache_time"`
+	IsPersonal    bool                           `json:"is_personal"`
+	NextOffset    string                         `json:"next_offset"`
+}
+
+func article(id int) *tg.InlineQueryResultArticle {
+	return &tg.InlineQueryResultArticle{Type: "article", Id: strconv.Itoa(id), Title: "Article " + strconv.Itoa(id)}
+}
+
+func TestInlinePager(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	calls := 0
+	pager := tg.NewInlinePager(server.Bot(), func(ctx context.Context, query string, offset, limit int) ([]tg.InlineResult, int, error) {
+		calls++
+		results := make([]tg.InlineResult, 0, limit)
+		for i := offset; i < offset+limit && i < 25; i++ {
+			results = append(results, article(i))
+		}
+		// duplicate of the previous page and of the current one
+		results = append(results, article(offset), article(offset))
+		if offset+limit >= 25 {
+			return results, 0, nil
+		}
+		return results, offset + limit, nil
+	})
+	pager.PageSize = 10
+	pager.IsPersonal = true
+	pager.Cache = tg.NewMemoryStorage()
+	var chosen *tg.ServedInlineResult
+	pager.OnChosen = func(ctx context.Context, result *tg.ChosenInlineResult, served *tg.ServedInlineResult) error {
+		chosen = served
+		return nil
+	}
+	handler := pager.Middleware()(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		t.Errorf("inline updates should not be passed")
+		return nil
+	}))
+
+	user := &tg.User{Id: 1}
+	offset := ""
+	var ids []string
+	for page := 0; page < 3; page++ {
+		query := &tg.InlineQuery{Id: "q" + strconv.Itoa(page), From: user, Query: "cats", Offset: offset}
+		if err := handler.Handle(ctx, &tg.Update{InlineQuery: query}); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+		answer := new(inlineAnswer)
+		if err := server.LastCall("answerInlineQuery").Decode(answer); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if answer.InlineQueryId != query.Id || !answer.IsPersonal {
+			t.Errorf("answer = %+v", answer)
+		}
+		for _, result := range answer.Results {
+			ids = append(ids, result.Id)
+		}
+		offset = answer.NextOffset
+	}
+	if offset != "" {
+		t.Errorf("NextOffset of the last page = %q", offset)
+	}
+	if len(ids) != 25 {
+		t.Errorf("results = %v, want 25 unique results", ids)
+	}
+
+	query := &tg.InlineQuery{Id: "again", From: user, Query: "cats"}
+	if err := pager.Answer(ctx, query); err != nil {
+		t.Fatalf("Answer() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Source calls = %d, want 3", calls)
+	}
+
+	err := handler.Handle(ctx, &tg.Update{ChosenInlineResult: &tg.ChosenInlineResult{ResultId: "12", From: user, Query: "cats"}})
+	if err != nil || chosen == nil || chosen.Query != "cats" || chosen.Offset != 10 {
+		t.Errorf("OnChosen() = %+v, %v", chosen, err)
+	}
+	served := new(tg.InlineQueryResultArticle)
+	if err = json.Unmarshal(chosen.Result, served); err != nil || served.Title != "Article 12" {
+		t.Errorf("served result = %+v, %v", served, err)
+	}
+}
+
+func TestInlinePager_Truncated(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	// source ignores the limit and returns all results at once
+	pager := tg.NewInlinePager(server.Bot(), func(ctx context.Context, query string, offset, limit int) ([]tg.InlineResult, int, error) {
+		results := make([]tg.InlineResult, 0, 25)
+		for i := offset; i < 25; i++ {
+			results = append(results, article(i))
+		}
+		return results, 0, nil
+	})
+	pager.PageSize = 10
+
+	offset := ""
+	var ids []string
+	for page := 0; page < 3; page++ {
+		if err := pager.Answer(context.Background(), &tg.InlineQuery{Id: "q", Query: "cats", Offset: offset}); err != nil {
+			t.Fatalf("Answer() error = %v", err)
+		}
+		answer := new(inlineAnswer)
+		if err := server.LastCall("answerInlineQuery").Decode(answer); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		for _, result := range answer.Results {
+			ids = append(ids, result.Id)
+		}
+		offset = answer.NextOffset
+	}
+	if offset != "" || len(ids) != 25 || ids[10] != "10" {
+		t.Errorf("results = %v, NextOffset = %q", ids, offset)
+	}
+}
+
+func TestInlineOffset(t *testing.T) {
+	for _, offset := range []int{0, 1, 50, 1 << 30} {
+		encoded, err := tg.EncodeInlineOffset(offset)
+		if err != nil {
+			t.Fatalf("EncodeInlineOffset(%d) error = %v", offset, err)
+		}
+		if decoded, err := tg.DecodeInlineOffset(encoded); err != nil || decoded != offset {
+			t.Errorf("DecodeInlineOffset(%q) = %d, %v", encoded, decoded, err)
+		}
+	}
+	for _, offset := range []string{"-1", "!", "10.5"} {
+		if _, err := tg.DecodeInlineOffset(offset); err != tg.InvalidInlineOffset {
+			t.Errorf("DecodeInlineOffset(%q) error = %v", offset, err)
+		}
+	}
+}
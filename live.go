@@ -0,0 +1,265 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MinLivePeriod is a minimal period of the live location
+	MinLivePeriod = 60 * time.Second
+	// MaxLivePeriod is a maximal period of the live location
+	MaxLivePeriod = 24 * time.Hour
+	// DefaultLiveInterval is a default minimal interval between edits of the live location
+	DefaultLiveInterval = 3 * time.Second
+	// DefaultLiveTimeout is a default timeout of the delayed edit of the live location
+	DefaultLiveTimeout = 10 * time.Second
+)
+
+var (
+	LiveLocationStopped = errors.New("live location is stopped")
+	InvalidLivePeriod   = errors.New("invalid live period")
+)
+
+// NotModified checks if err is caused by the edit, that doesn't change the message
+func NotModified(err error) bool {
+	response := ErrorResponse(err)
+	return response != nil && strings.Contains(response.Description, "message is not modified")
+}
+
+// LiveLocation is the shared live location of the chat message or the inline message.
+// Updates are throttled: if the previous edit was less than Interval ago, the location is sent later,
+// and only the latest location is sent. Location stops being updated when its live period expires.
+// LiveLocation can be created as a struct literal with the message and the Expires.
+type LiveLocation struct {
+	Bot             *Bot
+	ChatId          int
+	MessageId       int
+	InlineMessageId string
+	// Expires is a time, when the live period ends
+	Expires time.Time
+	// Interval is a minimal interval between edits, DefaultLiveInterval is used if empty
+	Interval time.Duration
+	// Timeout of the delayed edit, DefaultLiveTimeout is used if empty
+	Timeout time.Duration
+	// OnError is called when the delayed edit fails
+	OnError func(err error)
+
+	mu sync.Mutex
+	// send serializes API calls, so edits reach Telegram in order
+	send sync.Mutex
+	// seq is the number of the latest edit request, sent is the number of the latest sent one
+	seq       int
+	sent      int
+	latitude  float64
+	longitude float64
+	edited    time.Time
+	pending   *time.Timer
+	expiry    *time.Timer
+	stopped   bool
+	done      chan struct{}
+}
+
+// StartLiveLocation sends the live location, request LivePeriod is required
+func (b *Bot) StartLiveLocation(ctx context.Context, request *SendLocationRequest) (*LiveLocation, error) {
+	period := time.Duration(request.LivePeriod) * time.Second
+	if period < MinLivePeriod || period > MaxLivePeriod {
+		return nil, InvalidLivePeriod
+	}
+	message, err := b.SendLocation(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	live := &LiveLocation{
+		Bot:       b,
+		ChatId:    message.Chat.Id,
+		MessageId: message.MessageId,
+		Expires:   now().Add(period),
+		latitude:  request.Latitude,
+		longitude: request.Longitude,
+		edited:    now(),
+	}
+	live.setup()
+	return live, nil
+}
+
+// InlineLiveLocation returns the live location of the inline message, e.g. sent as the InlineQueryResultLocation
+// with the live period. Identifier of the message is received in the ChosenInlineResult.
+func (b *Bot) InlineLiveLocation(inlineMessageId string, period time.Duration) (*LiveLocation, error) {
+	if period < MinLivePeriod || period > MaxLivePeriod {
+		return nil, InvalidLivePeriod
+	}
+	live := &LiveLocation{
+		Bot:             b,
+		InlineMessageId: inlineMessageId,
+		Expires:         now().Add(period),
+	}
+	live.setup()
+	return live, nil
+}
+
+// Update changes the location, LiveLocationStopped is returned if the location is stopped or expired.
+// Error of the delayed edit is passed to the OnError.
+func (l *LiveLocation) Update(ctx context.Context, latitude, longitude float64) error {
+	l.mu.Lock()
+	if l.expired() {
+		l.mu.Unlock()
+		return LiveLocationStopped
+	}
+	l.latitude, l.longitude = latitude, longitude
+	if l.pending != nil {
+		l.mu.Unlock()
+		return nil
+	}
+	if wait := l.interval() - now().Sub(l.edited); wait > 0 {
+		l.pending = time.AfterFunc(wait, l.flush)
+		l.mu.Unlock()
+		return nil
+	}
+	request, seq := l.request()
+	l.mu.Unlock()
+	return l.edit(ctx, request, seq)
+}
+
+// Location returns the latest location
+func (l *LiveLocation) Location() (latitude, longitude float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.latitude, l.longitude
+}
+
+// Stop stops the live location, the pending location is not sent.
+// Stop waits for the edit in progress, so the location is stopped after it.
+func (l *LiveLocation) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	if l.expired() {
+		l.mu.Unlock()
+		return nil
+	}
+	l.stop()
+	l.mu.Unlock()
+	l.send.Lock()
+	defer l.send.Unlock()
+	var result json.RawMessage
+	err := l.Bot.postResult(ctx, "stopMessageLiveLocation", &StopMessageLiveLocationRequest{
+		ChatId:          l.ChatId,
+		MessageId:       l.MessageId,
+		InlineMessageId: l.InlineMessageId,
+	}, &result)
+	if NotModified(err) {
+		return nil
+	}
+	return err
+}
+
+// Done returns the channel, that is closed when the live location is stopped or expired
+func (l *LiveLocation) Done() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setup()
+	return l.done
+}
+
+// setup starts the expiration of the location once, so the struct literal is usable, should be called under the lock
+func (l *LiveLocation) setup() {
+	if l.done != nil {
+		return
+	}
+	l.done = make(chan struct{})
+	l.expiry = time.AfterFunc(l.Expires.Sub(now()), func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if !l.stopped {
+			l.stop()
+		}
+	})
+}
+
+func (l *LiveLocation) flush() {
+	l.mu.Lock()
+	l.pending = nil
+	if l.expired() {
+		l.mu.Unlock()
+		return
+	}
+	request, seq := l.request()
+	l.mu.Unlock()
+
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultLiveTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := l.edit(ctx, request, seq); err != nil && l.OnError != nil {
+		l.OnError(err)
+	}
+}
+
+// request returns the edit request of the latest location with its number and marks it as sent,
+// should be called under the lock
+func (l *LiveLocation) request() (*EditMessageLiveLocationRequest, int) {
+	l.edited = now()
+	l.seq++
+	return &EditMessageLiveLocationRequest{
+		ChatId:          l.ChatId,
+		MessageId:       l.MessageId,
+		InlineMessageId: l.InlineMessageId,
+		Latitude:        l.latitude,
+		Longitude:       l.longitude,
+	}, l.seq
+}
+
+// edit sends the location, the lock should not be held, so the slow request doesn't block other calls.
+// Request is skipped, if the newer one is already sent or the location is stopped.
+func (l *LiveLocation) edit(ctx context.Context, request *EditMessageLiveLocationRequest, seq int) error {
+	l.send.Lock()
+	defer l.send.Unlock()
+	l.mu.Lock()
+	skip := seq <= l.sent || l.stopped
+	if !skip {
+		l.sent = seq
+	}
+	l.mu.Unlock()
+	if skip {
+		return nil
+	}
+	var result json.RawMessage
+	err := l.Bot.postResult(ctx, "editMessageLiveLocation", request, &result)
+	if NotModified(err) {
+		return nil
+	}
+	return err
+}
+
+// expired checks if the location is stopped, the expired location is stopped, should be called under the lock
+func (l *LiveLocation) expired() bool {
+	l.setup()
+	if !l.stopped && !now().Before(l.Expires) {
+		l.stop()
+	}
+	return l.stopped
+}
+
+func (l *LiveLocation) stop() {
+	l.stopped = true
+	if l.pending != nil {
+		l.pending.Stop()
+		l.pending = nil
+	}
+	if l.expiry != nil {
+		l.expiry.Stop()
+	}
+	close(l.done)
+}
+
+func (l *LiveLocation) interval() time.Duration {
+	if l.Interval > 0 {
+		return l.Interval
+	}
+	return DefaultLiveInterval
+}
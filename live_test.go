@@ -0,0 +1,196 @@
+package tg_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestBot_StartLiveLocation(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	if _, err := bot.StartLiveLocation(ctx, &tg.SendLocationRequest{ChatId: 1, LivePeriod: 10}); err != tg.InvalidLivePeriod {
+		t.Fatalf("StartLiveLocation() error = %v", err)
+	}
+	live, err := bot.StartLiveLocation(ctx, &tg.SendLocationRequest{ChatId: 1, Latitude: 1, Longitude: 1, LivePeriod: 60})
+	if err != nil {
+		t.Fatalf("StartLiveLocation() error = %v", err)
+	}
+	live.Interval = 50 * time.Millisecond
+
+	// edits right after the start are throttled, only the latest location is sent
+	for _, point := range []float64{2, 3} {
+		if err = live.Update(ctx, point, point); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+	if calls := server.CallsTo("editMessageLiveLocation"); len(calls) != 0 {
+		t.Errorf("throttled edits = %d", len(calls))
+	}
+	time.Sleep(120 * time.Millisecond)
+	if calls := server.CallsTo("editMessageLiveLocation"); len(calls) != 1 {
+		t.Fatalf("delayed edits = %d", len(calls))
+	}
+	if location := server.Message(1, live.MessageId).Location; location.Latitude != 3 || location.Longitude != 3 {
+		t.Errorf("Location = %+v", location)
+	}
+
+	// the same location is not an error
+	if err = live.Update(ctx, 3, 3); err != nil {
+		t.Errorf("Update() not modified error = %v", err)
+	}
+	if err = live.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if server.LastCall("stopMessageLiveLocation") == nil {
+		t.Errorf("stopMessageLiveLocation was not called")
+	}
+	if err = live.Update(ctx, 4, 4); err != tg.LiveLocationStopped {
+		t.Errorf("Update() after stop error = %v", err)
+	}
+	select {
+	case <-live.Done():
+	default:
+		t.Errorf("Done() is not closed")
+	}
+}
+
+func TestBot_InlineLiveLocation(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	for _, period := range []time.Duration{10 * time.Second, 25 * time.Hour} {
+		if _, err := bot.InlineLiveLocation("inline-1", period); err != tg.InvalidLivePeriod {
+			t.Errorf("InlineLiveLocation(%v) error = %v", period, err)
+		}
+	}
+	live, err := bot.InlineLiveLocation("inline-1", tg.MinLivePeriod)
+	if err != nil {
+		t.Fatalf("InlineLiveLocation() error = %v", err)
+	}
+	if err = live.Update(ctx, 1, 2); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	request := new(tg.EditMessageLiveLocationRequest)
+	if call := server.LastCall("editMessageLiveLocation"); call == nil || call.Decode(request) != nil ||
+		request.InlineMessageId != "inline-1" || request.Latitude != 1 || request.Longitude != 2 {
+		t.Fatalf("editMessageLiveLocation = %+v", request)
+	}
+	if err = live.Stop(ctx); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+	stop := new(tg.StopMessageLiveLocationRequest)
+	if call := server.LastCall("stopMessageLiveLocation"); call == nil || call.Decode(stop) != nil || stop.InlineMessageId != "inline-1" {
+		t.Errorf("stopMessageLiveLocation = %+v", stop)
+	}
+}
+
+func TestLiveLocation_Literal(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	if err := (&tg.LiveLocation{Bot: bot, ChatId: 1, MessageId: 1}).Stop(ctx); err != nil {
+		t.Errorf("Stop() of the zero location error = %v", err)
+	}
+	message, err := bot.SendLocation(ctx, &tg.SendLocationRequest{ChatId: 1, LivePeriod: 60})
+	if err != nil {
+		t.Fatalf("SendLocation() error = %v", err)
+	}
+	live := &tg.LiveLocation{Bot: bot, ChatId: 1, MessageId: message.MessageId, Expires: time.Now().Add(100 * time.Millisecond)}
+	if err = live.Update(ctx, 1, 2); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if location := server.Message(1, message.MessageId).Location; location.Latitude != 1 || location.Longitude != 2 {
+		t.Errorf("Location = %+v", location)
+	}
+	select {
+	case <-live.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("live location is not expired")
+	}
+	if err = live.Update(ctx, 3, 4); err != tg.LiveLocationStopped {
+		t.Errorf("Update() after expiration error = %v", err)
+	}
+	if err = live.Stop(ctx); err != nil || server.LastCall("stopMessageLiveLocation") != nil {
+		t.Errorf("Stop() after expiration error = %v, expired location should not be stopped", err)
+	}
+}
+
+func TestLiveLocation_SlowEdit(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/editMessageLiveLocation") {
+			<-release
+		}
+		mu.Lock()
+		methods = append(methods, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer server.Close()
+	bot := tg.New("TOKEN")
+	bot.Host = server.URL
+	ctx := context.Background()
+
+	live, err := bot.InlineLiveLocation("inline", time.Minute)
+	if err != nil {
+		t.Fatalf("InlineLiveLocation() error = %v", err)
+	}
+	go func() {
+		_ = live.Update(ctx, 1, 1)
+	}()
+	// the hung edit doesn't hold the location
+	time.Sleep(20 * time.Millisecond)
+	updated := make(chan error, 1)
+	go func() {
+		updated <- live.Update(ctx, 2, 2)
+	}()
+	select {
+	case err := <-updated:
+		if err != nil {
+			t.Errorf("Update() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Update() is blocked by the edit")
+	}
+	if latitude, longitude := live.Location(); latitude != 2 || longitude != 2 {
+		t.Errorf("Location() = %v, %v", latitude, longitude)
+	}
+
+	// the location is stopped after the edit in progress
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- live.Stop(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Stop() has not returned")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(methods) != 2 || methods[0] != "editMessageLiveLocation" || methods[1] != "stopMessageLiveLocation" {
+		t.Errorf("API calls = %v", methods)
+	}
+}
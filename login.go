@@ -0,0 +1,93 @@
+package tg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidLoginData = errors.New("invalid login data")
+	InvalidLoginHash = errors.New("invalid login data hash")
+	LoginDataExpired = errors.New("login data is expired")
+)
+
+type loginUserKey struct{}
+
+// VerifyLoginData checks the authorization data, received from the Telegram Login Widget or the LoginUrl button.
+// Data is signed with HMAC-SHA-256, where the key is SHA-256 of the bot token.
+// If maxAge is positive, data with auth_date older than maxAge is rejected with LoginDataExpired.
+func (b *Bot) VerifyLoginData(values url.Values, maxAge time.Duration) (*User, error) {
+	hash := values.Get("hash")
+	if hash == "" {
+		return nil, InvalidLoginData
+	}
+	expected, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, InvalidLoginHash
+	}
+	if !hmac.Equal(expected, b.loginHash(values)) {
+		return nil, InvalidLoginHash
+	}
+
+	authDate, err := strconv.Atoi(values.Get("auth_date"))
+	if err != nil {
+		return nil, InvalidLoginData
+	}
+	if maxAge > 0 && now().Sub(FromUnix(authDate)) > maxAge {
+		return nil, LoginDataExpired
+	}
+	id, err := strconv.Atoi(values.Get("id"))
+	if err != nil {
+		return nil, InvalidLoginData
+	}
+	return &User{
+		Id:        id,
+		FirstName: values.Get("first_name"),
+		LastName:  values.Get("last_name"),
+		Username:  values.Get("username"),
+	}, nil
+}
+
+// LoginHandler is a middleware for the login callback endpoint: it verifies the query parameters with VerifyLoginData
+// and responds with 403 Forbidden on failure. Verified user is available in the handler with LoginUser.
+func (b *Bot) LoginHandler(maxAge time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := b.VerifyLoginData(r.URL.Query(), maxAge)
+		if err != nil {
+			b.debug("login data verification failed: %s", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loginUserKey{}, user)))
+	})
+}
+
+// LoginUser returns the user, verified by the Bot.LoginHandler, or nil
+func LoginUser(ctx context.Context) *User {
+	user, _ := ctx.Value(loginUserKey{}).(*User)
+	return user
+}
+
+func (b *Bot) loginHash(values url.Values) []byte {
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		if key != "hash" {
+			pairs = append(pairs, key+"="+values.Get(key))
+		}
+	}
+	sort.Strings(pairs)
+
+	secret := sha256.Sum256([]byte(b.token))
+	mac := hmac.New(sha256.New, secret[:])
+	_, _ = mac.Write([]byte(strings.Join(pairs, "\n")))
+	return mac.Sum(nil)
+}
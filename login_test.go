@@ -0,0 +1,81 @@
+package tg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signLoginData(token string, values url.Values) url.Values {
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte("auth_date=" + values.Get("auth_date") + "\nfirst_name=" + values.Get("first_name") +
+		"\nid=" + values.Get("id") + "\nusername=" + values.Get("username")))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return values
+}
+
+func loginData(authDate time.Time) url.Values {
+	return url.Values{
+		"id":         {"42"},
+		"first_name": {"John"},
+		"username":   {"john"},
+		"auth_date":  {strconv.FormatInt(authDate.Unix(), 10)},
+	}
+}
+
+func TestBot_VerifyLoginData(t *testing.T) {
+	bot := New("123:TOKEN")
+	valid := signLoginData("123:TOKEN", loginData(time.Now()))
+	user, err := bot.VerifyLoginData(valid, time.Hour)
+	if err != nil {
+		t.Fatalf("VerifyLoginData() error = %v", err)
+	}
+	if user.Id != 42 || user.FirstName != "John" || user.Username != "john" {
+		t.Errorf("wrong user: %#v", user)
+	}
+
+	tampered := signLoginData("123:TOKEN", loginData(time.Now()))
+	tampered.Set("id", "43")
+	if _, err = bot.VerifyLoginData(tampered, time.Hour); err != InvalidLoginHash {
+		t.Errorf("VerifyLoginData() error = %v", err)
+	}
+	if _, err = New("other").VerifyLoginData(valid, time.Hour); err != InvalidLoginHash {
+		t.Errorf("VerifyLoginData() error = %v", err)
+	}
+	expired := signLoginData("123:TOKEN", loginData(time.Now().Add(-2*time.Hour)))
+	if _, err = bot.VerifyLoginData(expired, time.Hour); err != LoginDataExpired {
+		t.Errorf("VerifyLoginData() error = %v", err)
+	}
+	if _, err = bot.VerifyLoginData(expired, 0); err != nil {
+		t.Errorf("VerifyLoginData() without max age error = %v", err)
+	}
+	if _, err = bot.VerifyLoginData(url.Values{}, time.Hour); err != InvalidLoginData {
+		t.Errorf("VerifyLoginData() error = %v", err)
+	}
+}
+
+func TestBot_LoginHandler(t *testing.T) {
+	bot := New("123:TOKEN")
+	handler := bot.LoginHandler(time.Hour, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(LoginUser(r.Context()).Username))
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login?"+signLoginData("123:TOKEN", loginData(time.Now())).Encode(), nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "john" {
+		t.Errorf("wrong response: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login?id=42&hash=00", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("wrong status: %d", recorder.Code)
+	}
+}
@@ -0,0 +1,263 @@
+package tg
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// MessageKind is a kind of the Message content
+type MessageKind string
+
+const (
+	MessageKindUnknown               MessageKind = "unknown"
+	MessageKindText                  MessageKind = "text"
+	MessageKindAnimation             MessageKind = "animation"
+	MessageKindAudio                 MessageKind = "audio"
+	MessageKindDocument              MessageKind = "document"
+	MessageKindGame                  MessageKind = "game"
+	MessageKindPhoto                 MessageKind = "photo"
+	MessageKindSticker               MessageKind = "sticker"
+	MessageKindVideo                 MessageKind = "video"
+	MessageKindVoice                 MessageKind = "voice"
+	MessageKindVideoNote             MessageKind = "video_note"
+	MessageKindContact               MessageKind = "contact"
+	MessageKindLocation              MessageKind = "location"
+	MessageKindVenue                 MessageKind = "venue"
+	MessageKindPoll                  MessageKind = "poll"
+	MessageKindNewChatMembers        MessageKind = "new_chat_members"
+	MessageKindLeftChatMember        MessageKind = "left_chat_member"
+	MessageKindNewChatTitle          MessageKind = "new_chat_title"
+	MessageKindNewChatPhoto          MessageKind = "new_chat_photo"
+	MessageKindDeleteChatPhoto       MessageKind = "delete_chat_photo"
+	MessageKindGroupChatCreated      MessageKind = "group_chat_created"
+	MessageKindSupergroupChatCreated MessageKind = "supergroup_chat_created"
+	MessageKindChannelChatCreated    MessageKind = "channel_chat_created"
+	MessageKindMigrateToChatId       MessageKind = "migrate_to_chat_id"
+	MessageKindMigrateFromChatId     MessageKind = "migrate_from_chat_id"
+	MessageKindPinnedMessage         MessageKind = "pinned_message"
+	MessageKindInvoice               MessageKind = "invoice"
+	MessageKindSuccessfulPayment     MessageKind = "successful_payment"
+	MessageKindConnectedWebsite      MessageKind = "connected_website"
+	MessageKindPassportData          MessageKind = "passport_data"
+)
+
+func (k MessageKind) String() string {
+	return string(k)
+}
+
+// IsService returns true for the service messages kinds: chat members, title and photo changes, etc.
+func (k MessageKind) IsService() bool {
+	switch k {
+	case MessageKindNewChatMembers, MessageKindLeftChatMember, MessageKindNewChatTitle, MessageKindNewChatPhoto,
+		MessageKindDeleteChatPhoto, MessageKindGroupChatCreated, MessageKindSupergroupChatCreated,
+		MessageKindChannelChatCreated, MessageKindMigrateToChatId, MessageKindMigrateFromChatId,
+		MessageKindPinnedMessage, MessageKindSuccessfulPayment, MessageKindConnectedWebsite:
+		return true
+	}
+	return false
+}
+
+// Kind returns the kind of the message content.
+// Animation is checked before the document and venue before the location, because API fills both fields for them.
+func (m *Message) Kind() MessageKind {
+	switch {
+	case m == nil:
+		return MessageKindUnknown
+	case m.Text != "":
+		return MessageKindText
+	case m.Animation != nil:
+		return MessageKindAnimation
+	case m.Audio != nil:
+		return MessageKindAudio
+	case m.Document != nil:
+		return MessageKindDocument
+	case m.Game != nil:
+		return MessageKindGame
+	case len(m.Photo) != 0:
+		return MessageKindPhoto
+	case m.Sticker != nil:
+		return MessageKindSticker
+	case m.Video != nil:
+		return MessageKindVideo
+	case m.Voice != nil:
+		return MessageKindVoice
+	case m.VideoNote != nil:
+		return MessageKindVideoNote
+	case m.Contact != nil:
+		return MessageKindContact
+	case m.Venue != nil:
+		return MessageKindVenue
+	case m.Location != nil:
+		return MessageKindLocation
+	case m.Poll != nil:
+		return MessageKindPoll
+	case len(m.NewChatMembers) != 0:
+		return MessageKindNewChatMembers
+	case m.LeftChatMember != nil:
+		return MessageKindLeftChatMember
+	case m.NewChatTitle != "":
+		return MessageKindNewChatTitle
+	case len(m.NewChatPhoto) != 0:
+		return MessageKindNewChatPhoto
+	case m.DeleteChatPhoto:
+		return MessageKindDeleteChatPhoto
+	case m.GroupChatCreated:
+		return MessageKindGroupChatCreated
+	case m.SupergroupChatCreated:
+		return MessageKindSupergroupChatCreated
+	case m.ChannelChatCreated:
+		return MessageKindChannelChatCreated
+	case m.MigrateToChatId != 0:
+		return MessageKindMigrateToChatId
+	case m.MigrateFromChatId != 0:
+		return MessageKindMigrateFromChatId
+	case m.PinnedMessage != nil:
+		return MessageKindPinnedMessage
+	case m.Invoice != nil:
+		return MessageKindInvoice
+	case m.SuccessfulPayment != nil:
+		return MessageKindSuccessfulPayment
+	case m.ConnectedWebsite != "":
+		return MessageKindConnectedWebsite
+	case m.PassportData != nil:
+		return MessageKindPassportData
+	}
+	return MessageKindUnknown
+}
+
+// Sender returns the sender of the message, nil for messages sent to channels
+func (m *Message) Sender() *User {
+	if m == nil {
+		return nil
+	}
+	return m.From
+}
+
+// ChatId returns the identifier of the chat the message belongs to, or 0
+func (m *Message) ChatId() int {
+	if m == nil || m.Chat == nil {
+		return 0
+	}
+	return m.Chat.Id
+}
+
+// IsForwarded returns true for the forwarded messages
+func (m *Message) IsForwarded() bool {
+	return m != nil && (m.ForwardDate != 0 || m.ForwardFrom != nil || m.ForwardFromChat != nil || m.ForwardSenderName != "")
+}
+
+// EntityText returns the part of the message text, described by the entity.
+// Entity offsets are calculated in UTF-16 code units.
+func (m *Message) EntityText(entity *MessageEntity) string {
+	if m == nil || entity == nil {
+		return ""
+	}
+	return utf16Substring(m.Text, entity.Offset, entity.Length)
+}
+
+// IsCommand returns true if the message text starts with the bot command
+func (m *Message) IsCommand() bool {
+	return m.commandEntity() != nil
+}
+
+// Command returns the bot command without leading slash and the bot username, e.g. "start" for "/start@my_bot"
+func (m *Message) Command() string {
+	entity := m.commandEntity()
+	if entity == nil {
+		return ""
+	}
+	command := strings.TrimPrefix(m.EntityText(entity), "/")
+	if i := strings.IndexByte(command, '@'); i != -1 {
+		command = command[:i]
+	}
+	return command
+}
+
+// CommandMention returns the bot username from the command, e.g. "my_bot" for "/start@my_bot"
+func (m *Message) CommandMention() string {
+	entity := m.commandEntity()
+	if entity == nil {
+		return ""
+	}
+	command := m.EntityText(entity)
+	if i := strings.IndexByte(command, '@'); i != -1 {
+		return command[i+1:]
+	}
+	return ""
+}
+
+// CommandArgs returns the trimmed text after the bot command
+func (m *Message) CommandArgs() string {
+	entity := m.commandEntity()
+	if entity == nil {
+		return ""
+	}
+	command := m.EntityText(entity)
+	return strings.TrimSpace(strings.TrimPrefix(m.Text, command))
+}
+
+func (m *Message) commandEntity() *MessageEntity {
+	if m == nil {
+		return nil
+	}
+	for _, entity := range m.Entities {
+		if entity != nil && entity.Offset == 0 && MessageEntityType(entity.Type) == MessageEntityBotCommand {
+			return entity
+		}
+	}
+	return nil
+}
+
+// LargestPhoto returns the biggest available size of the photo, or nil
+func (m *Message) LargestPhoto() *PhotoSize {
+	if m == nil {
+		return nil
+	}
+	var result *PhotoSize
+	for _, photo := range m.Photo {
+		if photo == nil {
+			continue
+		}
+		if result == nil || photo.Width*photo.Height > result.Width*result.Height ||
+			(photo.Width*photo.Height == result.Width*result.Height && photo.FileSize > result.FileSize) {
+			result = photo
+		}
+	}
+	return result
+}
+
+// FileId returns the file identifier for any media kind of the message, for photos the largest size is used
+func (m *Message) FileId() string {
+	switch m.Kind() {
+	case MessageKindAnimation:
+		return m.Animation.FileId
+	case MessageKindAudio:
+		return m.Audio.FileId
+	case MessageKindDocument:
+		return m.Document.FileId
+	case MessageKindPhoto:
+		if photo := m.LargestPhoto(); photo != nil {
+			return photo.FileId
+		}
+	case MessageKindSticker:
+		return m.Sticker.FileId
+	case MessageKindVideo:
+		return m.Video.FileId
+	case MessageKindVoice:
+		return m.Voice.FileId
+	case MessageKindVideoNote:
+		return m.VideoNote.FileId
+	}
+	return ""
+}
+
+func utf16Substring(text string, offset, length int) string {
+	encoded := utf16.Encode([]rune(text))
+	if offset < 0 || length < 0 || offset > len(encoded) {
+		return ""
+	}
+	if offset+length > len(encoded) {
+		length = len(encoded) - offset
+	}
+	return string(utf16.Decode(encoded[offset : offset+length]))
+}
@@ -0,0 +1,120 @@
+package tg
+
+import "testing"
+
+func TestMessage_Kind(t *testing.T) {
+	tests := []struct {
+		message  *Message
+		expected MessageKind
+	}{
+		{message: nil, expected: MessageKindUnknown},
+		{message: &Message{}, expected: MessageKindUnknown},
+		{message: &Message{Text: "hello"}, expected: MessageKindText},
+		{message: &Message{Animation: &Animation{}, Document: &Document{}}, expected: MessageKindAnimation},
+		{message: &Message{Document: &Document{}, Caption: "file"}, expected: MessageKindDocument},
+		{message: &Message{Photo: []*PhotoSize{{}}}, expected: MessageKindPhoto},
+		{message: &Message{Sticker: &Sticker{}}, expected: MessageKindSticker},
+		{message: &Message{Voice: &Voice{}}, expected: MessageKindVoice},
+		{message: &Message{Venue: &Venue{}, Location: &Location{}}, expected: MessageKindVenue},
+		{message: &Message{Location: &Location{}}, expected: MessageKindLocation},
+		{message: &Message{Poll: &Poll{}}, expected: MessageKindPoll},
+		{message: &Message{NewChatMembers: []*User{{}}}, expected: MessageKindNewChatMembers},
+		{message: &Message{PinnedMessage: &Message{}}, expected: MessageKindPinnedMessage},
+		{message: &Message{MigrateToChatId: -100}, expected: MessageKindMigrateToChatId},
+		{message: &Message{SuccessfulPayment: &SuccessfulPayment{}}, expected: MessageKindSuccessfulPayment},
+	}
+	for _, test := range tests {
+		t.Run(test.expected.String(), func(t *testing.T) {
+			if kind := test.message.Kind(); kind != test.expected {
+				t.Errorf("Kind() = %s, expected %s", kind, test.expected)
+			}
+		})
+	}
+}
+
+func TestMessage_Command(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *Message
+		command string
+		mention string
+		args    string
+	}{
+		{
+			name:    "not a command",
+			message: &Message{Text: "hello /start"},
+		},
+		{
+			name: "command in the middle",
+			message: &Message{Text: "hello /start", Entities: []*MessageEntity{
+				{Type: "bot_command", Offset: 6, Length: 6},
+			}},
+		},
+		{
+			name: "simple",
+			message: &Message{Text: "/start", Entities: []*MessageEntity{
+				{Type: "bot_command", Offset: 0, Length: 6},
+			}},
+			command: "start",
+		},
+		{
+			name: "with mention and args",
+			message: &Message{Text: "/say@my_bot  привет 👋 ", Entities: []*MessageEntity{
+				{Type: "bot_command", Offset: 0, Length: 11},
+			}},
+			command: "say",
+			mention: "my_bot",
+			args:    "привет 👋",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.message.IsCommand() != (test.command != "") {
+				t.Errorf("IsCommand() = %v", !(test.command != ""))
+			}
+			if value := test.message.Command(); value != test.command {
+				t.Errorf("Command() = %q, expected %q", value, test.command)
+			}
+			if value := test.message.CommandMention(); value != test.mention {
+				t.Errorf("CommandMention() = %q, expected %q", value, test.mention)
+			}
+			if value := test.message.CommandArgs(); value != test.args {
+				t.Errorf("CommandArgs() = %q, expected %q", value, test.args)
+			}
+		})
+	}
+}
+
+func TestMessage_EntityText(t *testing.T) {
+	message := &Message{Text: "👋 @user hi", Entities: []*MessageEntity{{Type: "mention", Offset: 3, Length: 5}}}
+	if value := message.EntityText(message.Entities[0]); value != "@user" {
+		t.Errorf("EntityText() = %q", value)
+	}
+}
+
+func TestMessage_FileId(t *testing.T) {
+	message := &Message{Photo: []*PhotoSize{
+		{FileId: "small", Width: 90, Height: 90},
+		{FileId: "big", Width: 1280, Height: 1280},
+		{FileId: "medium", Width: 320, Height: 320},
+	}}
+	if value := message.FileId(); value != "big" {
+		t.Errorf("FileId() = %q", value)
+	}
+	message = &Message{Animation: &Animation{FileId: "animation"}, Document: &Document{FileId: "document"}}
+	if value := message.FileId(); value != "animation" {
+		t.Errorf("FileId() = %q", value)
+	}
+	if value := (&Message{Text: "text"}).FileId(); value != "" {
+		t.Errorf("FileId() = %q", value)
+	}
+}
+
+func TestMessage_IsForwarded(t *testing.T) {
+	if (&Message{}).IsForwarded() {
+		t.Errorf("message is not forwarded")
+	}
+	if !(&Message{ForwardDate: 1562371200, ForwardSenderName: "Hidden"}).IsForwarded() {
+		t.Errorf("message is forwarded")
+	}
+}
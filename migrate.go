@@ -0,0 +1,66 @@
+package tg
+
+import (
+	"context"
+	"reflect"
+)
+
+// ErrorResponse returns the API response of the failed request, or nil if err is not an API error
+func ErrorResponse(err error) *Response {
+	switch e := err.(type) {
+	case *Error:
+		return e.Response
+	case Error:
+		return e.Response
+	}
+	return nil
+}
+
+// MigrateToChatId returns the identifier of the supergroup, if err is caused by the group upgrade, or 0
+func MigrateToChatId(err error) int {
+	if response := ErrorResponse(err); response != nil && response.Parameters != nil {
+		return response.Parameters.MigrateToChatId
+	}
+	return 0
+}
+
+// MigrationMiddleware returns the Middleware, that calls Bot.OnMigrate for the migration service messages.
+// Both messages, in the old group and in the new supergroup, trigger the hook, so it should be idempotent.
+func (b *Bot) MigrationMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			if message := update.Message; message != nil && message.Chat != nil {
+				if message.MigrateToChatId != 0 {
+					b.migrate(ctx, message.Chat.Id, message.MigrateToChatId)
+				} else if message.MigrateFromChatId != 0 {
+					b.migrate(ctx, message.MigrateFromChatId, message.Chat.Id)
+				}
+			}
+			return next.Handle(ctx, update)
+		})
+	}
+}
+
+func (b *Bot) migrate(ctx context.Context, from, to int) {
+	b.debug("chat %d migrated to %d", from, to)
+	if b.OnMigrate != nil {
+		b.OnMigrate(ctx, from, to)
+	}
+}
+
+// migrateRequest returns the copy of the request with the new ChatId, and the old ChatId.
+// Request should be a pointer to the structure with the ChatId field.
+func migrateRequest(request interface{}, chatId int) (interface{}, int, bool) {
+	value := reflect.ValueOf(request)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return nil, 0, false
+	}
+	field := value.Elem().FieldByName("ChatId")
+	if !field.IsValid() || field.Kind() != reflect.Int || field.Int() == 0 || int(field.Int()) == chatId {
+		return nil, 0, false
+	}
+	migrated := reflect.New(value.Elem().Type())
+	migrated.Elem().Set(value.Elem())
+	migrated.Elem().FieldByName("ChatId").SetInt(int64(chatId))
+	return migrated.Interface(), int(field.Int()), true
+}
@@ -0,0 +1,70 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMigrateToChatId(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: 0},
+		{name: "other", err: WrongResponse, want: 0},
+		{name: "no parameters", err: &Error{Basic: InvalidStatusCode, Response: &Response{ErrorCode: 400}}, want: 0},
+		{name: "pointer", err: &Error{Basic: InvalidStatusCode, Response: &Response{Parameters: &ResponseParameters{MigrateToChatId: -100}}}, want: -100},
+		{name: "value", err: Error{Basic: InvalidStatusCode, Response: &Response{Parameters: &ResponseParameters{MigrateToChatId: -100}}}, want: -100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MigrateToChatId(tt.err); got != tt.want {
+				t.Errorf("MigrateToChatId() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateRequest(t *testing.T) {
+	request := &SendMessageRequest{ChatId: -1, Text: "text"}
+	migrated, from, ok := migrateRequest(request, -100)
+	if !ok || from != -1 || migrated.(*SendMessageRequest).ChatId != -100 || migrated.(*SendMessageRequest).Text != "text" {
+		t.Errorf("migrateRequest() = %v, %v, %v", migrated, from, ok)
+	}
+	if request.ChatId != -1 {
+		t.Errorf("migrateRequest() changed the original request")
+	}
+	for _, request := range []interface{}{nil, map[string]int{"chat_id": -1}, &GetUpdatesRequest{}, &SendMessageRequest{}} {
+		if _, _, ok := migrateRequest(request, -100); ok {
+			t.Errorf("migrateRequest(%#v) = true", request)
+		}
+	}
+}
+
+func TestBot_MigrationMiddleware(t *testing.T) {
+	var calls [][2]int
+	bot := New("TOKEN")
+	bot.OnMigrate = func(ctx context.Context, from, to int) {
+		calls = append(calls, [2]int{from, to})
+	}
+	handler := bot.MigrationMiddleware()(HandlerFunc(func(ctx context.Context, update *Update) error {
+		return nil
+	}))
+	ctx := context.Background()
+	_ = handler.Handle(ctx, &Update{Message: &Message{Chat: &Chat{Id: -1}, MigrateToChatId: -100}})
+	_ = handler.Handle(ctx, &Update{Message: &Message{Chat: &Chat{Id: -100}, MigrateFromChatId: -1}})
+	_ = handler.Handle(ctx, &Update{Message: &Message{Chat: &Chat{Id: -100}, Text: "text"}})
+	if len(calls) != 2 || calls[0] != [2]int{-1, -100} || calls[1] != calls[0] {
+		t.Errorf("OnMigrate() calls = %v", calls)
+	}
+}
+
+func TestError_Unwrap(t *testing.T) {
+	for _, err := range []error{&Error{Basic: InvalidStatusCode}, Error{Basic: InvalidStatusCode}} {
+		if !errors.Is(err, InvalidStatusCode) {
+			t.Errorf("errors.Is(%#v, InvalidStatusCode) = false", err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package tg
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	CurrencyMismatch = errors.New("currency mismatch")
+	TotalMismatch    = errors.New("invoice total mismatch")
+	AmountTooSmall   = errors.New("amount is less than the minimal amount of the currency")
+	AmountTooLarge   = errors.New("amount is greater than the maximal amount of the currency")
+	UnknownLimits    = errors.New("limits of the currency are unknown")
+)
+
+// Money is an amount in the minor units of the currency, e.g. 1050 USD is $10.50
+type Money struct {
+	Amount   int
+	Currency string
+}
+
+// NewMoney creates the money of the amount in the minor units
+func NewMoney(amount int, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// ParseMoney parses the decimal amount, e.g. "10.50", of the known currency
+func ParseMoney(currency, amount string) (Money, error) {
+	if _, ok := LookupCurrency(currency); !ok {
+		return Money{}, UnknownCurrency
+	}
+	value, err := MinorUnits(currency, amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(value, currency), nil
+}
+
+// Decimal returns the decimal amount, e.g. "10.50"
+func (m Money) Decimal() string {
+	exponent := CurrencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.Itoa(amount)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// String returns the decimal amount with the currency code, e.g. "10.50 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Format returns the amount for the display, e.g. "$10.50", or "10.50 CHF" for currencies without the symbol
+func (m Money) Format() string {
+	currency, _ := LookupCurrency(m.Currency)
+	if currency.Symbol == "" {
+		return m.String()
+	}
+	if m.Amount < 0 {
+		return "-" + currency.Symbol + strings.TrimPrefix(m.Decimal(), "-")
+	}
+	return currency.Symbol + m.Decimal()
+}
+
+// Add returns the sum of amounts in the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if !strings.EqualFold(m.Currency, other.Currency) {
+		return Money{}, CurrencyMismatch
+	}
+	return NewMoney(m.Amount+other.Amount, m.Currency), nil
+}
+
+// Validate checks the currency is known and the amount is within the Telegram limits of the currency.
+// UnknownLimits is returned for the positive amount, if limits of the currency are not set,
+// see LoadCurrencies and SetCurrencyLimits.
+func (m Money) Validate() error {
+	currency, ok := LookupCurrency(m.Currency)
+	if !ok {
+		return UnknownCurrency
+	}
+	if m.Amount <= 0 || (currency.MinAmount > 0 && m.Amount < currency.MinAmount) {
+		return AmountTooSmall
+	}
+	if currency.MaxAmount > 0 && m.Amount > currency.MaxAmount {
+		return AmountTooLarge
+	}
+	if currency.MinAmount <= 0 && currency.MaxAmount <= 0 {
+		return UnknownLimits
+	}
+	return nil
+}
+
+// Price returns the labeled price of the amount
+func (m Money) Price(label string) *LabeledPrice {
+	return &LabeledPrice{Label: label, Amount: m.Amount}
+}
+
+// Money returns the total amount of the query
+func (q *PreCheckoutQuery) Money() Money {
+	return NewMoney(q.TotalAmount, q.Currency)
+}
+
+// Money returns the total amount of the payment
+func (p *SuccessfulPayment) Money() Money {
+	return NewMoney(p.TotalAmount, p.Currency)
+}
+
+// AddMoney adds the price to the invoice, currency of the invoice is set by the first price
+func (r *SendInvoiceRequest) AddMoney(label string, price Money) error {
+	if r.Currency == "" {
+		r.Currency = price.Currency
+	}
+	if !strings.EqualFold(r.Currency, price.Currency) {
+		return CurrencyMismatch
+	}
+	r.Prices = append(r.Prices, price.Price(label))
+	return nil
+}
+
+// TotalMoney returns the total amount of the invoice prices
+func (r *SendInvoiceRequest) TotalMoney() Money {
+	return NewMoney(r.Total(), r.Currency)
+}
+
+// Check validates the invoice before sending: total of prices should be equal to the expected total
+// and be within the Telegram limits of the currency
+func (r *SendInvoiceRequest) Check(total Money) error {
+	if !strings.EqualFold(r.Currency, total.Currency) {
+		return CurrencyMismatch
+	}
+	if r.Total() != total.Amount {
+		return TotalMismatch
+	}
+	return r.TotalMoney().Validate()
+}
@@ -0,0 +1,89 @@
+package tg
+
+import "testing"
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		money   Money
+		decimal string
+		format  string
+	}{
+		{money: NewMoney(1050, "USD"), decimal: "10.50", format: "$10.50"},
+		{money: NewMoney(5, "usd"), decimal: "0.05", format: "$0.05"},
+		{money: NewMoney(-125, "EUR"), decimal: "-1.25", format: "-€1.25"},
+		{money: NewMoney(500, "JPY"), decimal: "500", format: "¥500"},
+		{money: NewMoney(1234, "KWD"), decimal: "1.234", format: "1.234 KWD"},
+		{money: NewMoney(7, "CLF"), decimal: "0.0007", format: "0.0007 CLF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.money.String(), func(t *testing.T) {
+			if got := tt.money.Decimal(); got != tt.decimal {
+				t.Errorf("Decimal() = %v, want %v", got, tt.decimal)
+			}
+			if got := tt.money.Format(); got != tt.format {
+				t.Errorf("Format() = %v, want %v", got, tt.format)
+			}
+			parsed, err := ParseMoney(tt.money.Currency, tt.decimal)
+			if err != nil || parsed != tt.money {
+				t.Errorf("ParseMoney() = %v, %v", parsed, err)
+			}
+		})
+	}
+	if _, err := ParseMoney("XYZ", "1"); err != UnknownCurrency {
+		t.Errorf("ParseMoney() error = %v", err)
+	}
+}
+
+func TestMoney_Validate(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  error
+	}{
+		{money: NewMoney(100, "USD")},
+		{money: NewMoney(99, "USD"), want: AmountTooSmall},
+		{money: NewMoney(1000001, "USD"), want: AmountTooLarge},
+		{money: NewMoney(0, "EUR"), want: AmountTooSmall},
+		{money: NewMoney(1, "EUR"), want: UnknownLimits},
+		{money: NewMoney(100, "XYZ"), want: UnknownCurrency},
+	}
+	for _, tt := range tests {
+		if got := tt.money.Validate(); got != tt.want {
+			t.Errorf("Validate(%v) = %v, want %v", tt.money, got, tt.want)
+		}
+	}
+
+	defer func() {
+		_ = SetCurrencyLimits("EUR", 0, 0)
+	}()
+	if err := SetCurrencyLimits("EUR", 100, 1000000); err != nil {
+		t.Fatalf("SetCurrencyLimits() error = %v", err)
+	}
+	if err := NewMoney(100, "EUR").Validate(); err != nil {
+		t.Errorf("Validate() with limits error = %v", err)
+	}
+}
+
+func TestSendInvoiceRequest_Check(t *testing.T) {
+	request := &SendInvoiceRequest{}
+	if err := request.AddMoney("Book", NewMoney(1299, "USD")); err != nil {
+		t.Fatalf("AddMoney() error = %v", err)
+	}
+	if err := request.AddMoney("Delivery", NewMoney(300, "EUR")); err != CurrencyMismatch {
+		t.Errorf("AddMoney() error = %v", err)
+	}
+	if err := request.AddPrice("Delivery", "3.00"); err != nil {
+		t.Fatalf("AddPrice() error = %v", err)
+	}
+	if request.Currency != "USD" || request.TotalMoney() != NewMoney(1599, "USD") {
+		t.Errorf("TotalMoney() = %v", request.TotalMoney())
+	}
+	if err := request.Check(NewMoney(1599, "USD")); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := request.Check(NewMoney(1500, "USD")); err != TotalMismatch {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := request.Check(NewMoney(1599, "EUR")); err != CurrencyMismatch {
+		t.Errorf("Check() error = %v", err)
+	}
+}
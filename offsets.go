@@ -0,0 +1,261 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultOffsetsKey is a default Storage key of the Offsets state
+	DefaultOffsetsKey = "offsets"
+	// DefaultDedupWindow is a default number of processed updates, remembered for the deduplication
+	DefaultDedupWindow = 1000
+	// DefaultMaxAttempts is a default number of attempts to process the update, before it is skipped
+	DefaultMaxAttempts = 3
+)
+
+// Offsets tracks processed updates by the UpdateId: the update is committed after the handler succeeds,
+// already processed updates are skipped. State is persisted in the Storage, so the bot resumes from it after restart.
+//
+// Offset returns the identifier of the first update, that is not processed yet, so GetUpdates never confirms
+// updates that are in progress or failed. Failed updates are redelivered, until MaxAttempts is reached.
+type Offsets struct {
+	// Storage of the state, state is kept in memory only if empty
+	Storage Storage
+	// Key of the state in the Storage, DefaultOffsetsKey is used if empty
+	Key string
+	// Window is a number of processed updates, remembered for the deduplication, DefaultDedupWindow is used if empty.
+	// Updates below the window are considered processed.
+	Window int
+	// MaxAttempts is a number of attempts to process the update before it is committed anyway,
+	// DefaultMaxAttempts is used if empty
+	MaxAttempts int
+
+	mu       sync.Mutex
+	loaded   bool
+	floor    int
+	done     map[int]bool
+	running  map[int]bool
+	attempts map[int]int
+}
+
+type offsetsState struct {
+	Offset int   `json:"offset"`
+	Done   []int `json:"done,omitempty"`
+}
+
+// NewOffsets creates the offsets, persisted in the storage
+func NewOffsets(storage Storage) *Offsets {
+	return &Offsets{
+		Storage: storage,
+	}
+}
+
+// Offset returns the offset for the next GetUpdates call
+func (o *Offsets) Offset() (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return 0, err
+	}
+	return o.offset(), nil
+}
+
+// Begin marks the update as running, returns false if the update is already processed or running
+func (o *Offsets) Begin(updateId int) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return false, err
+	}
+	if o.running[updateId] {
+		return false, nil
+	}
+	if _, failed := o.attempts[updateId]; !failed && (o.done[updateId] || updateId < o.floor) {
+		return false, nil
+	}
+	o.running[updateId] = true
+	return true, nil
+}
+
+// Commit marks the running update as processed and persists the state
+func (o *Offsets) Commit(updateId int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return err
+	}
+	o.commit(updateId)
+	return o.save()
+}
+
+// Fail marks the running update as failed, so it can be processed again.
+// After MaxAttempts the update is committed.
+func (o *Offsets) Fail(updateId int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return err
+	}
+	delete(o.running, updateId)
+	o.attempts[updateId]++
+	if o.attempts[updateId] < o.maxAttempts() {
+		return nil
+	}
+	o.commit(updateId)
+	return o.save()
+}
+
+// abort marks the running update as not started, so it is processed again without the failed attempt
+func (o *Offsets) abort(updateId int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.running, updateId)
+}
+
+// failures returns the number of failed attempts of the update, that is not committed yet
+func (o *Offsets) failures(updateId int) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.attempts[updateId]
+}
+
+// Process calls the handler for the update, that was not processed yet, and commits it on success
+func (o *Offsets) Process(ctx context.Context, update *Update, handler Handler) error {
+	ok, err := o.Begin(update.UpdateId)
+	if err != nil || !ok {
+		return err
+	}
+	return o.Finish(update.UpdateId, handler.Handle(ctx, update))
+}
+
+// Finish commits the update if err is nil, or marks it as failed. The err is returned.
+func (o *Offsets) Finish(updateId int, err error) error {
+	if err != nil {
+		if ferr := o.Fail(updateId); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	return o.Commit(updateId)
+}
+
+// Middleware returns the Middleware, that skips processed updates and commits successful ones
+func (o *Offsets) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			return o.Process(ctx, update, next)
+		})
+	}
+}
+
+func (o *Offsets) commit(updateId int) {
+	delete(o.running, updateId)
+	delete(o.attempts, updateId)
+	o.done[updateId] = true
+	window := o.Window
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	if len(o.done) <= window {
+		return
+	}
+	ids := o.doneIds()
+	for _, id := range ids[:len(ids)-window] {
+		delete(o.done, id)
+		if id >= o.floor {
+			o.floor = id + 1
+		}
+	}
+}
+
+// offset is the lowest unfinished update, or the next after the highest processed one
+func (o *Offsets) offset() int {
+	offset := 0
+	for id := range o.running {
+		if offset == 0 || id < offset {
+			offset = id
+		}
+	}
+	for id := range o.attempts {
+		if offset == 0 || id < offset {
+			offset = id
+		}
+	}
+	if offset != 0 {
+		return offset
+	}
+	offset = o.floor
+	for id := range o.done {
+		if id >= offset {
+			offset = id + 1
+		}
+	}
+	return offset
+}
+
+func (o *Offsets) load() error {
+	if o.loaded {
+		return nil
+	}
+	o.done = make(map[int]bool)
+	o.running = make(map[int]bool)
+	o.attempts = make(map[int]int)
+	if o.Storage != nil {
+		data, err := o.Storage.Get(o.key())
+		if err != nil && err != KeyNotFound {
+			return err
+		}
+		if err == nil {
+			state := new(offsetsState)
+			if err = json.Unmarshal(data, state); err != nil {
+				return err
+			}
+			o.floor = state.Offset
+			for _, id := range state.Done {
+				o.done[id] = true
+			}
+		}
+	}
+	o.loaded = true
+	return nil
+}
+
+func (o *Offsets) save() error {
+	if o.Storage == nil {
+		return nil
+	}
+	data, err := json.Marshal(&offsetsState{
+		Offset: o.offset(),
+		Done:   o.doneIds(),
+	})
+	if err != nil {
+		return err
+	}
+	return o.Storage.Set(o.key(), data)
+}
+
+func (o *Offsets) doneIds() []int {
+	ids := make([]int, 0, len(o.done))
+	for id := range o.done {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (o *Offsets) key() string {
+	if o.Key != "" {
+		return o.Key
+	}
+	return DefaultOffsetsKey
+}
+
+func (o *Offsets) maxAttempts() int {
+	if o.MaxAttempts > 0 {
+		return o.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
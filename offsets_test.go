@@ -0,0 +1,116 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOffsets(t *testing.T) {
+	storage := NewMemoryStorage()
+	offsets := NewOffsets(storage)
+	begin := func(id int, want bool) {
+		if ok, err := offsets.Begin(id); ok != want || err != nil {
+			t.Errorf("Begin(%d) = %v, %v, want %v", id, ok, err, want)
+		}
+	}
+	offset := func(want int) {
+		if got, err := offsets.Offset(); got != want || err != nil {
+			t.Errorf("Offset() = %v, %v, want %v", got, err, want)
+		}
+	}
+
+	offset(0)
+	begin(10, true)
+	begin(11, true)
+	begin(10, false)
+	offset(10)
+	_ = offsets.Commit(11)
+	offset(10)
+	begin(11, false)
+	_ = offsets.Commit(10)
+	offset(12)
+	begin(10, false)
+
+	begin(12, true)
+	_ = offsets.Fail(12)
+	offset(12)
+	begin(12, true)
+
+	restored := NewOffsets(storage)
+	if got, _ := restored.Offset(); got != 12 {
+		t.Errorf("Offset() after restart = %v, want 12", got)
+	}
+	for id, want := range map[int]bool{10: false, 11: false, 12: true, 13: true} {
+		if ok, _ := restored.Begin(id); ok != want {
+			t.Errorf("Begin(%d) after restart = %v, want %v", id, ok, want)
+		}
+	}
+}
+
+func TestOffsets_MaxAttempts(t *testing.T) {
+	offsets := &Offsets{MaxAttempts: 2}
+	failed := errors.New("failed")
+	calls := 0
+	handler := offsets.Middleware()(HandlerFunc(func(ctx context.Context, update *Update) error {
+		calls++
+		return failed
+	}))
+	for i := 0; i < 3; i++ {
+		_ = handler.Handle(context.Background(), &Update{UpdateId: 1})
+	}
+	if calls != 2 {
+		t.Errorf("Handle() calls = %d, want 2", calls)
+	}
+	if got, _ := offsets.Offset(); got != 2 {
+		t.Errorf("Offset() = %v, want 2", got)
+	}
+}
+
+func TestOffsets_Window(t *testing.T) {
+	offsets := &Offsets{Window: 2}
+	for id := 1; id <= 4; id++ {
+		_, _ = offsets.Begin(id)
+		_ = offsets.Commit(id)
+	}
+	if len(offsets.done) != 2 {
+		t.Errorf("done = %v", offsets.done)
+	}
+	for id := 1; id <= 4; id++ {
+		if ok, _ := offsets.Begin(id); ok {
+			t.Errorf("Begin(%d) = true", id)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	calls := 0
+	fail := true
+	webhook := &Webhook{
+		Offsets: new(Offsets),
+		Handler: HandlerFunc(func(ctx context.Context, update *Update) error {
+			calls++
+			if fail {
+				return errors.New("failed")
+			}
+			return nil
+		}),
+	}
+	deliver := func(want int) {
+		recorder := httptest.NewRecorder()
+		webhook.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id":7}`)))
+		if recorder.Code != want {
+			t.Errorf("ServeHTTP() status = %d, want %d", recorder.Code, want)
+		}
+	}
+	deliver(http.StatusInternalServerError)
+	fail = false
+	deliver(http.StatusOK)
+	deliver(http.StatusOK)
+	if calls != 2 {
+		t.Errorf("Handle() calls = %d, want 2", calls)
+	}
+}
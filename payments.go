@@ -0,0 +1,222 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PreCheckoutDeadline is a time, the pre-checkout query should be answered in
+	PreCheckoutDeadline = 10 * time.Second
+	// DefaultPaymentTimeout is a default time for validators, it leaves time to answer before the deadline
+	DefaultPaymentTimeout = 8 * time.Second
+	// DefaultPaymentError is a default error message, shown to the user if validation fails or hangs
+	DefaultPaymentError = "Sorry, we can't process your order right now. Please try again later."
+	// DefaultPaymentClaimTimeout is a default time, after which the unfinished payment processing is considered failed
+	DefaultPaymentClaimTimeout = time.Minute
+)
+
+var PaymentValidationTimeout = errors.New("payment validation timeout")
+
+// PaymentError is an error of the validator, its message is shown to the user
+type PaymentError string
+
+func (e PaymentError) Error() string {
+	return string(e)
+}
+
+// ShippingValidator returns shipping options for the address of the query
+type ShippingValidator func(ctx context.Context, query *ShippingQuery) ([]*ShippingOption, error)
+
+// PreCheckoutValidator checks the order before the payment
+type PreCheckoutValidator func(ctx context.Context, query *PreCheckoutQuery) error
+
+// PaymentHandler handles the successful payment
+type PaymentHandler func(ctx context.Context, payment *Payment) error
+
+// Payment is a successful payment event
+type Payment struct {
+	*SuccessfulPayment
+	// Message with the payment
+	Message *Message
+}
+
+// Payments handles the payment flow: shipping and pre-checkout queries are answered with validators before the deadline,
+// successful payments are passed to the OnPayment once per TelegramPaymentChargeId.
+//
+// Validator errors of the PaymentError type are shown to the user, ErrorMessage is shown for the other errors.
+type Payments struct {
+	Bot *Bot
+	// Shipping validates shipping queries, queries are declined if empty
+	Shipping ShippingValidator
+	// PreCheckout validates pre-checkout queries, all queries are approved if empty
+	PreCheckout PreCheckoutValidator
+	// OnPayment handles successful payments
+	OnPayment PaymentHandler
+	// Timeout of validators from the receipt of the update, see ReceivedAt, DefaultPaymentTimeout is used if empty
+	Timeout time.Duration
+	// ErrorMessage is shown to the user, if validator fails or hangs, DefaultPaymentError is used if empty
+	ErrorMessage string
+	// Storage of processed payments, in-memory storage is used if empty
+	Storage SessionStore
+}
+
+// NewPayments creates the payments flow with in-memory storage of processed payments
+func NewPayments(bot *Bot) *Payments {
+	return &Payments{
+		Bot:     bot,
+		Storage: NewMemoryStorage(),
+	}
+}
+
+// Middleware returns the Middleware, that handles shipping and pre-checkout queries and successful payments,
+// other updates are passed to the next handler
+func (p *Payments) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			switch {
+			case update.ShippingQuery != nil:
+				return p.AnswerShipping(ctx, update.ShippingQuery)
+			case update.PreCheckoutQuery != nil:
+				return p.AnswerPreCheckout(ctx, update.PreCheckoutQuery)
+			case update.Message != nil && update.Message.SuccessfulPayment != nil:
+				return p.Paid(ctx, update.Message)
+			}
+			return next.Handle(ctx, update)
+		})
+	}
+}
+
+// AnswerShipping answers the shipping query with options of the Shipping validator
+func (p *Payments) AnswerShipping(ctx context.Context, query *ShippingQuery) error {
+	request := &AnswerShippingQueryRequest{ShippingQueryId: query.Id}
+	var err error
+	if p.Shipping == nil {
+		request.ErrorMessage = p.errorMessage(nil)
+	} else {
+		// options are read only after the validator has returned
+		var options []*ShippingOption
+		err = p.validate(ctx, func(ctx context.Context) (err error) {
+			options, err = p.Shipping(ctx, query)
+			return err
+		})
+		if err != nil {
+			request.ErrorMessage = p.errorMessage(err)
+		} else {
+			request.ShippingOptions = options
+		}
+	}
+	request.Ok = request.ErrorMessage == ""
+	if _, aerr := p.Bot.AnswerShippingQuery(ctx, request); aerr != nil {
+		return aerr
+	}
+	return p.result(err)
+}
+
+// AnswerPreCheckout answers the pre-checkout query with the PreCheckout validator result
+func (p *Payments) AnswerPreCheckout(ctx context.Context, query *PreCheckoutQuery) error {
+	request := &AnswerPreCheckoutQueryRequest{PreCheckoutQueryId: query.Id, Ok: true}
+	var err error
+	if p.PreCheckout != nil {
+		err = p.validate(ctx, func(ctx context.Context) error {
+			return p.PreCheckout(ctx, query)
+		})
+		if err != nil {
+			request.Ok = false
+			request.ErrorMessage = p.errorMessage(err)
+		}
+	}
+	if _, aerr := p.Bot.AnswerPreCheckoutQuery(ctx, request); aerr != nil {
+		return aerr
+	}
+	return p.result(err)
+}
+
+// Paid passes the successful payment of the message to the OnPayment, already processed payments are skipped.
+// If OnPayment fails, the payment is processed again on the redelivery of the update.
+func (p *Payments) Paid(ctx context.Context, message *Message) error {
+	payment := message.SuccessfulPayment
+	if p.OnPayment == nil || payment == nil {
+		return nil
+	}
+	if p.Storage == nil {
+		p.Storage = NewMemoryStorage()
+	}
+	key := "payment:" + payment.TelegramPaymentChargeId
+	claim, ok, err := p.claim(key)
+	if err != nil || !ok {
+		return err
+	}
+	if err = p.OnPayment(ctx, &Payment{SuccessfulPayment: payment, Message: message}); err != nil {
+		if _, derr := p.Storage.CompareAndSwap(key, claim, nil, 0); derr != nil {
+			return derr
+		}
+		return err
+	}
+	_, err = p.Storage.CompareAndSwap(key, claim, []byte("done"), 0)
+	return err
+}
+
+// claim marks the payment as processing, the stale claim of the failed process is taken over
+func (p *Payments) claim(key string) ([]byte, bool, error) {
+	claim := []byte("processing:" + strconv.FormatInt(now().Unix(), 10))
+	current, err := p.Storage.Get(key)
+	if err == KeyNotFound {
+		current = nil
+	} else if err != nil {
+		return nil, false, err
+	} else if !strings.HasPrefix(string(current), "processing:") {
+		return nil, false, nil
+	} else if started, perr := strconv.ParseInt(strings.TrimPrefix(string(current), "processing:"), 10, 64); perr == nil &&
+		now().Sub(time.Unix(started, 0)) < DefaultPaymentClaimTimeout {
+		return nil, false, nil
+	}
+	ok, err := p.Storage.CompareAndSwap(key, current, claim, 0)
+	return claim, ok, err
+}
+
+// validate runs the validator until the timeout from the receipt of the update,
+// PaymentValidationTimeout is returned if it hangs
+func (p *Payments) validate(ctx context.Context, validator func(ctx context.Context) error) error {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPaymentTimeout
+	}
+	received := ReceivedAt(ctx)
+	if received.IsZero() {
+		received = time.Now()
+	}
+	ctx, cancel := context.WithDeadline(ctx, received.Add(timeout))
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- validator(ctx)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return PaymentValidationTimeout
+	}
+}
+
+func (p *Payments) errorMessage(err error) string {
+	if message, ok := err.(PaymentError); ok && message != "" {
+		return string(message)
+	}
+	if p.ErrorMessage != "" {
+		return p.ErrorMessage
+	}
+	return DefaultPaymentError
+}
+
+// result returns validation errors, except the declines, that were shown to the user
+func (p *Payments) result(err error) error {
+	if _, ok := err.(PaymentError); ok {
+		return nil
+	}
+	return err
+}
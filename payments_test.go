@@ -0,0 +1,136 @@
+package tg_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestPayments_PreCheckout(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	payments := tg.NewPayments(server.Bot())
+	payments.Timeout = 20 * time.Millisecond
+	payments.PreCheckout = func(ctx context.Context, query *tg.PreCheckoutQuery) error {
+		switch query.InvoicePayload {
+		case "sold out":
+			return tg.PaymentError("Sold out")
+		case "hangs":
+			<-ctx.Done()
+			return ctx.Err()
+		case "fails":
+			return errors.New("database is down")
+		}
+		return nil
+	}
+	handler := payments.Middleware()(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		return nil
+	}))
+
+	tests := []struct {
+		payload string
+		ok      bool
+		message string
+		wantErr error
+	}{
+		{payload: "ok", ok: true},
+		{payload: "sold out", message: "Sold out"},
+		{payload: "hangs", message: tg.DefaultPaymentError, wantErr: tg.PaymentValidationTimeout},
+		{payload: "fails", message: tg.DefaultPaymentError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			query := &tg.PreCheckoutQuery{Id: tt.payload, Currency: "USD", TotalAmount: 100, InvoicePayload: tt.payload}
+			err := handler.Handle(ctx, &tg.Update{PreCheckoutQuery: query})
+			if tt.wantErr != nil && err != tt.wantErr || tt.ok && err != nil {
+				t.Errorf("Handle() error = %v, want %v", err, tt.wantErr)
+			}
+			answer := new(tg.AnswerPreCheckoutQueryRequest)
+			if err = server.LastCall("answerPreCheckoutQuery").Decode(answer); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if answer.PreCheckoutQueryId != tt.payload || answer.Ok != tt.ok || answer.ErrorMessage != tt.message {
+				t.Errorf("answer = %+v", answer)
+			}
+		})
+	}
+}
+
+func TestPayments_ReceivedAt(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	payments := tg.NewPayments(server.Bot())
+	payments.Timeout = time.Second
+	payments.PreCheckout = func(ctx context.Context, query *tg.PreCheckoutQuery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	// the update has waited in the queue, so the validator has less time
+	ctx := tg.WithReceivedAt(context.Background(), time.Now().Add(-950*time.Millisecond))
+	start := time.Now()
+	err := payments.AnswerPreCheckout(ctx, &tg.PreCheckoutQuery{Id: "query", Currency: "USD", TotalAmount: 100})
+	if err != tg.PaymentValidationTimeout {
+		t.Errorf("AnswerPreCheckout() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("validation took %v, want the timeout from the receipt", elapsed)
+	}
+}
+
+func TestPayments_Shipping(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	payments := tg.NewPayments(server.Bot())
+	payments.Shipping = func(ctx context.Context, query *tg.ShippingQuery) ([]*tg.ShippingOption, error) {
+		if query.ShippingAddress.CountryCode != "DE" {
+			return nil, tg.PaymentError("We ship to Germany only")
+		}
+		return []*tg.ShippingOption{{Id: "dhl", Title: "DHL", Prices: []*tg.LabeledPrice{{Label: "DHL", Amount: 500}}}}, nil
+	}
+	for country, want := range map[string]bool{"DE": true, "US": false} {
+		query := &tg.ShippingQuery{Id: country, ShippingAddress: &tg.ShippingAddress{CountryCode: country}}
+		if err := payments.AnswerShipping(context.Background(), query); err != nil {
+			t.Fatalf("AnswerShipping() error = %v", err)
+		}
+		answer := new(tg.AnswerShippingQueryRequest)
+		_ = server.LastCall("answerShippingQuery").Decode(answer)
+		if answer.Ok != want || (len(answer.ShippingOptions) == 1) != want {
+			t.Errorf("answer for %s = %+v", country, answer)
+		}
+	}
+}
+
+func TestPayments_Paid(t *testing.T) {
+	payments := tg.NewPayments(tg.New("TOKEN"))
+	calls := 0
+	fail := true
+	payments.OnPayment = func(ctx context.Context, payment *tg.Payment) error {
+		calls++
+		if fail {
+			fail = false
+			return errors.New("failed")
+		}
+		if payment.TotalAmount != 100 || payment.Message == nil {
+			t.Errorf("payment = %+v", payment)
+		}
+		return nil
+	}
+	message := &tg.Message{SuccessfulPayment: &tg.SuccessfulPayment{Currency: "USD", TotalAmount: 100, TelegramPaymentChargeId: "charge"}}
+	ctx := context.Background()
+	if err := payments.Paid(ctx, message); err == nil {
+		t.Errorf("Paid() error = nil")
+	}
+	for i := 0; i < 2; i++ {
+		if err := payments.Paid(ctx, message); err != nil {
+			t.Errorf("Paid() error = %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("OnPayment() calls = %d, want 2", calls)
+	}
+}
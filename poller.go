@@ -0,0 +1,327 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPollingTimeout is a default timeout of the long polling
+	DefaultPollingTimeout = 30 * time.Second
+	// DefaultRetryDelay is a default delay after the failed GetUpdates call
+	DefaultRetryDelay = time.Second
+	// DefaultMaxRetryDelay is a default limit of the delay before the failed update is dispatched again
+	DefaultMaxRetryDelay = 30 * time.Second
+)
+
+// deferred finishes the dispatched update, that waits for the retry of the previous update of its chat
+var deferred = errors.New("update is deferred")
+
+// Poller receives updates with the long polling and passes them to the Handler.
+// Offset of the GetUpdates is taken from the Offsets, so updates are confirmed only after they are processed.
+// If Handler is a Dispatcher, updates of the batch are processed concurrently. Failed updates are received again
+// and dispatched after the delay, that grows with attempts up to the MaxRetryDelay, until the Offsets commits them.
+// Later updates of the same chat wait for the failed one, so updates of the chat are processed in order.
+type Poller struct {
+	Bot     *Bot
+	Handler Handler
+	// Offsets tracks processed updates, in-memory Offsets is used if empty
+	Offsets *Offsets
+	// Timeout of the long polling, DefaultPollingTimeout is used if empty, negative value turns on the short polling
+	Timeout time.Duration
+	// Limit of updates in the batch, API default is used if empty
+	Limit int
+	// AllowedUpdates is a list of update types to receive, see AllowedUpdates function
+	AllowedUpdates []string
+	// RetryDelay is a delay after the failed GetUpdates call, or when only updates in progress are received,
+	// and the first delay before the failed update is dispatched again. DefaultRetryDelay is used if empty.
+	RetryDelay time.Duration
+	// MaxRetryDelay is a limit of the delay before the failed update is dispatched again,
+	// DefaultMaxRetryDelay is used if empty
+	MaxRetryDelay time.Duration
+	// OnError is called on the failed GetUpdates call with nil update, or when the Handler returns an error
+	OnError func(update *Update, err error)
+
+	once sync.Once
+	done chan struct{}
+	mu   sync.Mutex
+	// retries are failed dispatched updates by the UpdateId
+	retries map[int]*pollerRetry
+}
+
+type pollerRetry struct {
+	key int
+	at  time.Time
+}
+
+// Webhook is a http.Handler, that receives updates from the Telegram webhook and passes them to the Handler.
+// Updates, already processed by the Offsets, are acknowledged without the Handler call,
+// failed updates are responded with the error status, so Telegram retries them.
+type Webhook struct {
+	Handler Handler
+	// Offsets tracks processed updates, no deduplication if empty
+	Offsets *Offsets
+	// OnError is called when the Handler returns an error
+	OnError func(update *Update, err error)
+}
+
+type dispatcher interface {
+	dispatch(ctx context.Context, update *Update, before func() error, done func(err error)) error
+	key(update *Update) int
+}
+
+// NewPoller creates the poller, that resumes from the offsets
+func NewPoller(bot *Bot, handler Handler, offsets *Offsets) *Poller {
+	return &Poller{
+		Bot:     bot,
+		Handler: handler,
+		Offsets: offsets,
+	}
+}
+
+// Run receives and processes updates until the ctx is done, returns the ctx error.
+// If Handler is a Dispatcher, Run does not wait for the batch: the next batch is received while updates are processed,
+// so handlers may wait for the next updates, e.g. with the Asker.
+func (p *Poller) Run(ctx context.Context) error {
+	if p.Offsets == nil {
+		p.Offsets = new(Offsets)
+	}
+	for {
+		received, fresh, err := p.poll(ctx, false)
+		delay := time.Duration(0)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			p.error(nil, err)
+			delay = p.retryDelay()
+		} else if received != 0 && fresh == 0 || received == 0 && p.Timeout < 0 {
+			// only updates in progress or waiting for the retry are received, they are not confirmed until processed,
+			// or there are no updates with the short polling
+			delay = p.retryDelay()
+			if until := p.nextRetry(); until > 0 && until < delay {
+				delay = until
+			}
+		}
+		if delay == 0 {
+			continue
+		}
+		select {
+		case <-time.After(delay):
+		case <-p.finished():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Poll receives one batch of updates and waits until it is processed.
+// Handler errors are passed into the OnError, only GetUpdates errors are returned.
+func (p *Poller) Poll(ctx context.Context) error {
+	if p.Offsets == nil {
+		p.Offsets = new(Offsets)
+	}
+	_, _, err := p.poll(ctx, true)
+	return err
+}
+
+// poll receives the batch, returns the number of received updates and the number of updates passed to the Handler
+func (p *Poller) poll(ctx context.Context, wait bool) (received, fresh int, err error) {
+	offset, err := p.Offsets.Offset()
+	if err != nil {
+		return 0, 0, err
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultPollingTimeout
+	} else if timeout < 0 {
+		timeout = 0
+	}
+	updates, err := p.Bot.GetUpdates(ctx, &GetUpdatesRequest{
+		Offset:         offset,
+		Limit:          p.Limit,
+		Timeout:        int(timeout / time.Second),
+		AllowedUpdates: p.AllowedUpdates,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	ctx = WithReceivedAt(ctx, time.Now())
+
+	var wg sync.WaitGroup
+	defer func() {
+		if wait {
+			wg.Wait()
+		}
+	}()
+	d, async := p.Handler.(dispatcher)
+	for _, update := range updates {
+		key := 0
+		if async {
+			key = d.key(update)
+			if p.blocked(key, update.UpdateId) {
+				continue
+			}
+		}
+		ok, err := p.Offsets.Begin(update.UpdateId)
+		if err != nil {
+			return len(updates), fresh, err
+		}
+		if !ok {
+			continue
+		}
+		fresh++
+		if !async {
+			p.finish(update, p.Handler.Handle(ctx, update))
+			continue
+		}
+		update := update
+		before := func() error {
+			// the previous update of the chat has failed after this one was queued
+			if p.blocked(key, update.UpdateId) {
+				return deferred
+			}
+			return nil
+		}
+		wg.Add(1)
+		err = d.dispatch(ctx, update, before, func(err error) {
+			defer wg.Done()
+			p.finishDispatched(update, key, err)
+		})
+		if err != nil {
+			wg.Done()
+			p.finishDispatched(update, key, err)
+		}
+	}
+	return len(updates), fresh, nil
+}
+
+func (p *Poller) finish(update *Update, err error) {
+	if err = p.Offsets.Finish(update.UpdateId, err); err != nil {
+		p.error(update, err)
+	}
+	select {
+	case p.finished() <- struct{}{}:
+	default:
+	}
+}
+
+// finishDispatched finishes the update and schedules the retry of the failed one
+func (p *Poller) finishDispatched(update *Update, key int, err error) {
+	if err == deferred {
+		p.Offsets.abort(update.UpdateId)
+	} else if err = p.Offsets.Finish(update.UpdateId, err); err != nil {
+		p.error(update, err)
+	}
+	attempts := p.Offsets.failures(update.UpdateId)
+	p.mu.Lock()
+	if attempts > 0 {
+		if p.retries == nil {
+			p.retries = make(map[int]*pollerRetry)
+		}
+		p.retries[update.UpdateId] = &pollerRetry{key: key, at: time.Now().Add(p.backoff(attempts))}
+	} else {
+		delete(p.retries, update.UpdateId)
+	}
+	p.mu.Unlock()
+	select {
+	case p.finished() <- struct{}{}:
+	default:
+	}
+}
+
+// blocked returns true if the update waits for its retry, or for the retry of the previous update with the key
+func (p *Poller) blocked(key, updateId int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, retry := range p.retries {
+		if retry.key == key && (id < updateId || id == updateId && time.Now().Before(retry.at)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextRetry returns the delay until the nearest retry of the failed update, zero if there are no retries
+func (p *Poller) nextRetry() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next := time.Duration(0)
+	for _, retry := range p.retries {
+		if until := time.Until(retry.at); until > 0 && (next == 0 || until < next) {
+			next = until
+		}
+	}
+	return next
+}
+
+// backoff returns the delay before the next attempt, it is doubled with every failed attempt
+func (p *Poller) backoff(attempts int) time.Duration {
+	limit := p.MaxRetryDelay
+	if limit <= 0 {
+		limit = DefaultMaxRetryDelay
+	}
+	delay := p.retryDelay()
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		return limit
+	}
+	return delay
+}
+
+// finished is notified when the update is processed
+func (p *Poller) finished() chan struct{} {
+	p.once.Do(func() {
+		p.done = make(chan struct{}, 1)
+	})
+	return p.done
+}
+
+func (p *Poller) retryDelay() time.Duration {
+	if p.RetryDelay > 0 {
+		return p.RetryDelay
+	}
+	return DefaultRetryDelay
+}
+
+func (p *Poller) error(update *Update, err error) {
+	if p.OnError != nil {
+		p.OnError(update, err)
+	} else if p.Bot != nil {
+		p.Bot.Log("poller error: %s", err)
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	update := new(Update)
+	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ctx := WithReceivedAt(r.Context(), time.Now())
+	var err error
+	if w.Offsets != nil {
+		err = w.Offsets.Process(ctx, update, w.Handler)
+	} else {
+		err = w.Handler.Handle(ctx, update)
+	}
+	if err != nil {
+		if w.OnError != nil {
+			w.OnError(update, err)
+		}
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,209 @@
+package tg_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestPoller_Poll(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	for i := 0; i < 3; i++ {
+		server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: 1}, Text: "text"}})
+	}
+
+	var mu sync.Mutex
+	var processed []int
+	fail := true
+	handler := tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if update.UpdateId == 2 && fail {
+			fail = false
+			return errors.New("failed")
+		}
+		processed = append(processed, update.UpdateId)
+		return nil
+	})
+	storage := tg.NewMemoryStorage()
+	poller := tg.NewPoller(server.Bot(), handler, tg.NewOffsets(storage))
+	poller.OnError = func(update *tg.Update, err error) {}
+	ctx := context.Background()
+
+	if err := poller.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if server.PendingUpdates() != 3 {
+		t.Errorf("PendingUpdates() = %d, want 3", server.PendingUpdates())
+	}
+	if err := poller.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(processed) != 3 || processed[2] != 2 {
+		t.Errorf("processed = %v", processed)
+	}
+
+	restarted := tg.NewPoller(server.Bot(), handler, tg.NewOffsets(storage))
+	restarted.Timeout = -1
+	if err := restarted.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if server.PendingUpdates() != 0 {
+		t.Errorf("PendingUpdates() = %d, want 0", server.PendingUpdates())
+	}
+	if len(processed) != 3 {
+		t.Errorf("processed after restart = %v", processed)
+	}
+}
+
+func TestPoller_Dispatcher(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	for i := 0; i < 10; i++ {
+		server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: i % 3}, Text: "text"}})
+	}
+	var mu sync.Mutex
+	count := 0
+	dispatcher := tg.NewDispatcher(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+		return nil
+	}))
+	defer dispatcher.Stop(context.Background())
+	offsets := new(tg.Offsets)
+	poller := tg.NewPoller(server.Bot(), dispatcher, offsets)
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if count != 10 {
+		t.Errorf("processed = %d, want 10", count)
+	}
+	if offset, _ := offsets.Offset(); offset != 11 {
+		t.Errorf("Offset() = %d, want 11", offset)
+	}
+}
+
+func TestPoller_DispatcherRetry(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	for _, chatId := range []int{1, 1, 2, 1} {
+		server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: chatId}, Text: "text"}})
+	}
+	var mu sync.Mutex
+	var processed []int
+	var attempts []time.Time
+	dispatcher := tg.NewDispatcher(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if update.UpdateId == 1 && len(attempts) < 2 {
+			attempts = append(attempts, time.Now())
+			return errors.New("failed")
+		}
+		processed = append(processed, update.UpdateId)
+		return nil
+	}))
+	defer dispatcher.Stop(context.Background())
+	offsets := new(tg.Offsets)
+	poller := tg.NewPoller(server.Bot(), dispatcher, offsets)
+	poller.Timeout = -1
+	poller.RetryDelay = 20 * time.Millisecond
+	poller.MaxRetryDelay = 30 * time.Millisecond
+	poller.OnError = func(update *tg.Update, err error) {}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = poller.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for offset, _ := offsets.Offset(); offset != 5; offset, _ = offsets.Offset() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Offset() = %d, want 5", offset)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// update of the other chat is not blocked by the failed one
+	if len(processed) != 4 || processed[0] != 3 || processed[1] != 1 || processed[2] != 2 || processed[3] != 4 {
+		t.Errorf("processed = %v, want [3 1 2 4]", processed)
+	}
+	if len(attempts) != 2 || attempts[1].Sub(attempts[0]) < poller.RetryDelay {
+		t.Errorf("failed attempts = %v, want retry after the delay", attempts)
+	}
+}
+
+func TestPoller_Waiters(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	asker := tg.NewAsker(bot)
+	ctx := context.Background()
+
+	const waiters = 8
+	replies := make(chan string, waiters)
+	dispatcher := tg.NewDispatcher(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error {
+		if update.Message.Text != "/name" {
+			return nil
+		}
+		reply, err := asker.Ask(ctx, update, "What is your name?", 5*time.Second)
+		if err != nil {
+			replies <- err.Error()
+			return err
+		}
+		replies <- reply.Text
+		return nil
+	}))
+	dispatcher.Interceptors = []tg.Interceptor{asker}
+	defer dispatcher.Stop(ctx)
+
+	// long polling with the batch, smaller than the number of waiting handlers
+	offsets := new(tg.Offsets)
+	poller := tg.NewPoller(bot, dispatcher, offsets)
+	poller.Timeout = time.Second
+	poller.Limit = waiters / 2
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = poller.Run(runCtx)
+	}()
+
+	for i := 1; i <= waiters; i++ {
+		server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: i}, From: &tg.User{Id: i}, Text: "/name"}})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	// updates of the waiting handlers are released, so they are confirmed
+	for offset, _ := offsets.Offset(); asker.Waiting() != waiters || offset != waiters+1; offset, _ = offsets.Offset() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Waiting() = %d, Offset() = %d, want %d", asker.Waiting(), offset, waiters)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// the poll, started before the updates were released, returns them again
+	time.Sleep(50 * time.Millisecond)
+	polls := len(server.CallsTo("getUpdates"))
+	time.Sleep(100 * time.Millisecond)
+	if calls := len(server.CallsTo("getUpdates")); calls > polls+1 {
+		t.Errorf("getUpdates calls while handlers are waiting = %d, want long polling", calls-polls)
+	}
+	for i := 1; i <= waiters; i++ {
+		server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: i}, From: &tg.User{Id: i}, Text: "Alice"}})
+	}
+	for i := 0; i < waiters; i++ {
+		select {
+		case reply := <-replies:
+			if reply != "Alice" {
+				t.Errorf("Ask() = %v", reply)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Ask() has not returned")
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultPollsKey is a default key of the open polls index in the Storage
+const DefaultPollsKey = "polls"
+
+var PollClosed = errors.New("poll is closed")
+
+// PollHandler is called with the latest state of the poll
+type PollHandler func(ctx context.Context, poll *PollResult) error
+
+// PollResult is the recorded poll with the latest tallies
+type PollResult struct {
+	Id        string        `json:"id"`
+	ChatId    int           `json:"chat_id"`
+	MessageId int           `json:"message_id"`
+	Question  string        `json:"question"`
+	Options   []*PollOption `json:"options"`
+	IsClosed  bool          `json:"is_closed"`
+	// Deadline is a unix time of the automatic stop, no stop if empty
+	Deadline int64 `json:"deadline,omitempty"`
+}
+
+// Total returns the total number of votes
+func (r *PollResult) Total() int {
+	total := 0
+	for _, option := range r.Options {
+		total += option.VoterCount
+	}
+	return total
+}
+
+// Winners returns options with the maximal number of votes, or nil if there are no votes
+func (r *PollResult) Winners() []*PollOption {
+	var winners []*PollOption
+	max := 0
+	for _, option := range r.Options {
+		switch {
+		case option.VoterCount > max:
+			max = option.VoterCount
+			winners = []*PollOption{option}
+		case option.VoterCount == max && max > 0:
+			winners = append(winners, option)
+		}
+	}
+	return winners
+}
+
+// Polls records sent polls, keeps the latest tallies of the poll updates and stops polls after their deadlines.
+// Open polls are persisted in the Storage, so deadlines are rescheduled by Restore after the restart.
+type Polls struct {
+	Bot     *Bot
+	Storage Storage
+	// Key of the open polls index, DefaultPollsKey is used if empty
+	Key string
+	// OnUpdate is called when tallies of the recorded poll are changed or the poll is closed
+	OnUpdate PollHandler
+	// OnError is called when the automatic stop fails
+	OnError func(id string, err error)
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// NewPolls creates the polls manager
+func NewPolls(bot *Bot, storage Storage) *Polls {
+	return &Polls{
+		Bot:     bot,
+		Storage: storage,
+		Key:     DefaultPollsKey,
+	}
+}
+
+// Middleware returns the Middleware, that records poll updates, all updates are passed to the next handler
+func (p *Polls) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			if update.Poll != nil {
+				if err := p.Handle(ctx, update.Poll); err != nil {
+					return err
+				}
+			}
+			return next.Handle(ctx, update)
+		})
+	}
+}
+
+// Send sends the poll and records it, the poll is stopped after the deadline; no automatic stop if deadline is empty
+func (p *Polls) Send(ctx context.Context, request *SendPollRequest, deadline time.Duration) (*PollResult, error) {
+	message, err := p.Bot.SendPoll(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if message.Poll == nil {
+		return nil, WrongResponse
+	}
+	result := &PollResult{
+		Id:        message.Poll.Id,
+		ChatId:    message.Chat.Id,
+		MessageId: message.MessageId,
+		Question:  message.Poll.Question,
+		Options:   message.Poll.Options,
+		IsClosed:  message.Poll.IsClosed,
+	}
+	if deadline > 0 {
+		result.Deadline = now().Add(deadline).Unix()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err = p.save(result); err != nil {
+		return nil, err
+	}
+	if !result.IsClosed {
+		if err = p.open(result.Id, true); err != nil {
+			return nil, err
+		}
+		p.schedule(result)
+	}
+	return result, nil
+}
+
+// Get returns the recorded poll, or KeyNotFound error
+func (p *Polls) Get(id string) (*PollResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load(id)
+}
+
+// Handle records tallies of the poll update, unknown polls are ignored
+func (p *Polls) Handle(ctx context.Context, poll *Poll) error {
+	result, changed, err := p.update(poll)
+	if err != nil || !changed || p.OnUpdate == nil {
+		return err
+	}
+	return p.OnUpdate(ctx, result)
+}
+
+// Stop stops the recorded poll, PollClosed is returned if it is already closed
+func (p *Polls) Stop(ctx context.Context, id string) (*PollResult, error) {
+	result, err := p.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsClosed {
+		return result, PollClosed
+	}
+	poll, err := p.Bot.StopPoll(ctx, &StopPollRequest{ChatId: result.ChatId, MessageId: result.MessageId})
+	if err != nil {
+		return nil, err
+	}
+	poll.Id, poll.IsClosed = id, true
+	if err = p.Handle(ctx, poll); err != nil {
+		return nil, err
+	}
+	return p.Get(id)
+}
+
+// Restore schedules automatic stops of the open polls, e.g. after the restart.
+// Polls with passed deadlines are stopped immediately.
+func (p *Polls) Restore() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids, err := p.index()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		result, err := p.load(id)
+		if err == KeyNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		p.schedule(result)
+	}
+	return nil
+}
+
+// Close cancels scheduled stops, polls are left open
+func (p *Polls) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, timer := range p.timers {
+		timer.Stop()
+		delete(p.timers, id)
+	}
+}
+
+func (p *Polls) update(poll *Poll) (*PollResult, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result, err := p.load(poll.Id)
+	if err == KeyNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	// snapshots, received after the poll is closed, are outdated
+	if result.IsClosed || (!poll.IsClosed && sameTallies(result.Options, poll.Options)) {
+		return result, false, nil
+	}
+	result.Options = poll.Options
+	result.IsClosed = poll.IsClosed
+	if err = p.save(result); err != nil {
+		return nil, false, err
+	}
+	if result.IsClosed {
+		if timer, ok := p.timers[result.Id]; ok {
+			timer.Stop()
+			delete(p.timers, result.Id)
+		}
+		if err = p.open(result.Id, false); err != nil {
+			return nil, false, err
+		}
+	}
+	return result, true, nil
+}
+
+// schedule starts the timer of the automatic stop, should be called under the lock
+func (p *Polls) schedule(result *PollResult) {
+	if result.Deadline == 0 || result.IsClosed {
+		return
+	}
+	if p.timers == nil {
+		p.timers = make(map[string]*time.Timer)
+	}
+	if timer, ok := p.timers[result.Id]; ok {
+		timer.Stop()
+	}
+	id := result.Id
+	p.timers[id] = time.AfterFunc(time.Unix(result.Deadline, 0).Sub(now()), func() {
+		p.mu.Lock()
+		delete(p.timers, id)
+		p.mu.Unlock()
+		if _, err := p.Stop(context.Background(), id); err != nil && err != PollClosed && p.OnError != nil {
+			p.OnError(id, err)
+		}
+	})
+}
+
+// open adds the poll to the index of open polls or removes it, should be called under the lock
+func (p *Polls) open(id string, open bool) error {
+	ids, err := p.index()
+	if err != nil {
+		return err
+	}
+	result := make([]string, 0, len(ids)+1)
+	for _, item := range ids {
+		if item != id {
+			result = append(result, item)
+		}
+	}
+	if open {
+		result = append(result, id)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return p.Storage.Set(p.indexKey(), data)
+}
+
+func (p *Polls) index() ([]string, error) {
+	var ids []string
+	data, err := p.Storage.Get(p.indexKey())
+	if err == KeyNotFound {
+		return ids, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ids, json.Unmarshal(data, &ids)
+}
+
+func (p *Polls) load(id string) (*PollResult, error) {
+	data, err := p.Storage.Get(p.indexKey() + ":" + id)
+	if err != nil {
+		return nil, err
+	}
+	result := new(PollResult)
+	return result, json.Unmarshal(data, result)
+}
+
+func (p *Polls) save(result *PollResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return p.Storage.Set(p.indexKey()+":"+result.Id, data)
+}
+
+func (p *Polls) indexKey() string {
+	if p.Key != "" {
+		return p.Key
+	}
+	return DefaultPollsKey
+}
+
+func sameTallies(a, b []*PollOption) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Text != b[i].Text || a[i].VoterCount != b[i].VoterCount {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package tg_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestPolls(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	polls := tg.NewPolls(server.Bot(), tg.NewMemoryStorage())
+	defer polls.Close()
+
+	var mu sync.Mutex
+	updates := make([]tg.PollResult, 0)
+	polls.OnUpdate = func(ctx context.Context, poll *tg.PollResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, *poll)
+		return nil
+	}
+	handler := tg.Chain(tg.HandlerFunc(func(ctx context.Context, update *tg.Update) error { return nil }), polls.Middleware())
+
+	sent, err := polls.Send(ctx, &tg.SendPollRequest{ChatId: -1, Question: "Lunch?", Options: []string{"Pizza", "Sushi"}}, 0)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	snapshot := &tg.Poll{Id: sent.Id, Question: "Lunch?", Options: []*tg.PollOption{{Text: "Pizza", VoterCount: 2}, {Text: "Sushi", VoterCount: 1}}}
+	for i := 0; i < 2; i++ {
+		if err = handler.Handle(ctx, &tg.Update{Poll: snapshot}); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+	if err = handler.Handle(ctx, &tg.Update{Poll: &tg.Poll{Id: "unknown"}}); err != nil {
+		t.Fatalf("Handle() unknown error = %v", err)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("OnUpdate calls = %d", len(updates))
+	}
+	result, err := polls.Get(sent.Id)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if result.Total() != 3 || len(result.Winners()) != 1 || result.Winners()[0].Text != "Pizza" {
+		t.Errorf("Get() = %+v", result)
+	}
+
+	result, err = polls.Stop(ctx, sent.Id)
+	if err != nil || !result.IsClosed {
+		t.Fatalf("Stop() = %+v, %v", result, err)
+	}
+	if _, err = polls.Stop(ctx, sent.Id); err != tg.PollClosed {
+		t.Errorf("Stop() closed error = %v", err)
+	}
+	if _, err = polls.Get("unknown"); err != tg.KeyNotFound {
+		t.Errorf("Get() unknown error = %v", err)
+	}
+}
+
+func TestPolls_Deadline(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	storage := tg.NewMemoryStorage()
+	closed := make(chan *tg.PollResult, 2)
+	onUpdate := func(ctx context.Context, poll *tg.PollResult) error {
+		if poll.IsClosed {
+			closed <- poll
+		}
+		return nil
+	}
+
+	polls := tg.NewPolls(server.Bot(), storage)
+	polls.OnUpdate = onUpdate
+	short, err := polls.Send(ctx, &tg.SendPollRequest{ChatId: -1, Question: "Short", Options: []string{"Yes", "No"}}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	select {
+	case poll := <-closed:
+		if poll.Id != short.Id {
+			t.Errorf("closed poll = %v, want %v", poll.Id, short.Id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("poll is not stopped after the deadline")
+	}
+
+	// the restarted manager stops the poll with the passed deadline
+	long, err := polls.Send(ctx, &tg.SendPollRequest{ChatId: -1, Question: "Long", Options: []string{"Yes", "No"}}, time.Hour)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	polls.Close()
+	long.Deadline = time.Now().Add(-time.Second).Unix()
+	data, _ := json.Marshal(long)
+	if err = storage.Set(tg.DefaultPollsKey+":"+long.Id, data); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	restarted := tg.NewPolls(server.Bot(), storage)
+	restarted.OnUpdate = onUpdate
+	defer restarted.Close()
+	if err = restarted.Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	select {
+	case poll := <-closed:
+		if poll.Id != long.Id {
+			t.Errorf("closed poll = %v, want %v", poll.Id, long.Id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("restored poll is not stopped")
+	}
+	if calls := server.CallsTo("stopPoll"); len(calls) != 2 {
+		t.Errorf("stopPoll calls = %d", len(calls))
+	}
+}
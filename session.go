@@ -0,0 +1,191 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var SessionConflict = errors.New("session was changed concurrently")
+
+type sessionContextKey struct{}
+
+// Sessions loads the session of the update before the handler and saves its changes after the successful handler.
+// Changes are saved with the compare-and-swap, so concurrent changes of the same session return SessionConflict.
+type Sessions struct {
+	// Store of the sessions
+	Store SessionStore
+	// TTL of the session, prolonged on each update; no expiration if empty
+	TTL time.Duration
+	// Key returns the session key of the update, empty key skips the session.
+	// UserChatSessionKey is used if empty.
+	Key func(update *Update) string
+}
+
+// Session is a key/value data of the update, values are encoded as JSON
+type Session struct {
+	// Key of the session in the store
+	Key string
+
+	values   map[string]json.RawMessage
+	original []byte
+	dirty    bool
+}
+
+// NewSessions creates the sessions, keyed by the chat and the user
+func NewSessions(store SessionStore, ttl time.Duration) *Sessions {
+	return &Sessions{
+		Store: store,
+		TTL:   ttl,
+	}
+}
+
+// UserChatSessionKey returns the key of the user in the chat
+func UserChatSessionKey(update *Update) string {
+	chatId, userId := update.ChatId(), update.UserId()
+	if chatId == 0 && userId == 0 {
+		return ""
+	}
+	return fmt.Sprintf("session:%d:%d", chatId, userId)
+}
+
+// UserSessionKey returns the key of the user, shared between all chats
+func UserSessionKey(update *Update) string {
+	if userId := update.UserId(); userId != 0 {
+		return fmt.Sprintf("session:user:%d", userId)
+	}
+	return ""
+}
+
+// ChatSessionKey returns the key of the chat, shared between all users of the chat
+func ChatSessionKey(update *Update) string {
+	if chatId := update.ChatId(); chatId != 0 {
+		return fmt.Sprintf("session:chat:%d", chatId)
+	}
+	return ""
+}
+
+// SessionFromContext returns the session of the innermost Sessions middleware, or nil
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return session
+}
+
+// FromContext returns the session, loaded by this Sessions middleware, or nil
+func (s *Sessions) FromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(s).(*Session)
+	return session
+}
+
+// Middleware returns the Middleware, that loads and saves sessions
+func (s *Sessions) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, update *Update) error {
+			key := s.key(update)
+			if key == "" {
+				return next.Handle(ctx, update)
+			}
+			session, err := s.Load(key)
+			if err != nil {
+				return err
+			}
+			ctx = context.WithValue(ctx, sessionContextKey{}, session)
+			ctx = context.WithValue(ctx, s, session)
+			if err = next.Handle(ctx, update); err != nil {
+				return err
+			}
+			return s.Save(session)
+		})
+	}
+}
+
+// Load loads the session by the key, missing session is empty
+func (s *Sessions) Load(key string) (*Session, error) {
+	session := &Session{
+		Key:    key,
+		values: make(map[string]json.RawMessage),
+	}
+	data, err := s.Store.Get(key)
+	if err == KeyNotFound {
+		return session, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &session.values); err != nil {
+		return nil, err
+	}
+	session.original = data
+	return session, nil
+}
+
+// Save saves changes of the session, unchanged session only prolongs its TTL
+func (s *Sessions) Save(session *Session) error {
+	data := session.original
+	if session.dirty {
+		if len(session.values) == 0 {
+			data = nil
+		} else {
+			var err error
+			if data, err = json.Marshal(session.values); err != nil {
+				return err
+			}
+		}
+	} else if data == nil || s.TTL <= 0 {
+		return nil
+	}
+	ok, err := s.Store.CompareAndSwap(session.Key, session.original, data, s.TTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return SessionConflict
+	}
+	session.original, session.dirty = data, false
+	return nil
+}
+
+func (s *Sessions) key(update *Update) string {
+	if s.Key != nil {
+		return s.Key(update)
+	}
+	return UserChatSessionKey(update)
+}
+
+// Get decodes the value of the name into the v, returns false if there is no value
+func (s *Session) Get(name string, v interface{}) (bool, error) {
+	data, ok := s.values[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// Set encodes the v into the value of the name
+func (s *Session) Set(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.values[name] = data
+	s.dirty = true
+	return nil
+}
+
+// Delete removes the value of the name
+func (s *Session) Delete(name string) {
+	if _, ok := s.values[name]; ok {
+		delete(s.values, name)
+		s.dirty = true
+	}
+}
+
+// Clear removes all values, empty session is deleted from the store
+func (s *Session) Clear() {
+	if len(s.values) != 0 {
+		s.values = make(map[string]json.RawMessage)
+		s.dirty = true
+	}
+}
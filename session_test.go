@@ -0,0 +1,89 @@
+package tg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessions_Middleware(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage()
+	sessions := NewSessions(store, 0)
+	handler := sessions.Middleware()(HandlerFunc(func(ctx context.Context, update *Update) error {
+		session := SessionFromContext(ctx)
+		if session != sessions.FromContext(ctx) {
+			t.Errorf("FromContext() differs from SessionFromContext()")
+		}
+		var cart []string
+		if _, err := session.Get("cart", &cart); err != nil {
+			return err
+		}
+		if update.Message.Text == "clear" {
+			session.Clear()
+			return nil
+		}
+		return session.Set("cart", append(cart, update.Message.Text))
+	}))
+
+	for _, text := range []string{"apple", "pear"} {
+		if err := handler.Handle(ctx, textUpdate(1, 2, text)); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+	session, err := sessions.Load("session:1:2")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var cart []string
+	if ok, err := session.Get("cart", &cart); !ok || err != nil || len(cart) != 2 || cart[1] != "pear" {
+		t.Errorf("Get() = %v, %v, %v", cart, ok, err)
+	}
+	if other, _ := sessions.Load("session:1:3"); other == nil || len(other.values) != 0 {
+		t.Errorf("Load() of the other user = %+v", other)
+	}
+
+	if err = handler.Handle(ctx, textUpdate(1, 2, "clear")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if _, err = store.Get("session:1:2"); err != KeyNotFound {
+		t.Errorf("Get() error = %v, want KeyNotFound", err)
+	}
+}
+
+func TestSessions_Conflict(t *testing.T) {
+	store := NewMemoryStorage()
+	sessions := NewSessions(store, 0)
+	first, _ := sessions.Load("key")
+	second, _ := sessions.Load("key")
+	_ = first.Set("value", 1)
+	_ = second.Set("value", 2)
+	if err := sessions.Save(first); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := sessions.Save(second); err != SessionConflict {
+		t.Errorf("Save() error = %v, want SessionConflict", err)
+	}
+}
+
+func TestSessionKeys(t *testing.T) {
+	update := textUpdate(1, 2, "text")
+	tests := []struct {
+		name string
+		key  func(update *Update) string
+		want string
+	}{
+		{name: "user chat", key: UserChatSessionKey, want: "session:1:2"},
+		{name: "user", key: UserSessionKey, want: "session:user:2"},
+		{name: "chat", key: ChatSessionKey, want: "session:chat:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key(update); got != tt.want {
+				t.Errorf("key() = %v, want %v", got, tt.want)
+			}
+			if got := tt.key(&Update{}); got != "" {
+				t.Errorf("key() of empty update = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package tg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// StickerSize is a size of the longer side of the sticker image
+	StickerSize = 512
+	// MaxStickerFileSize is a maximal size of the sticker file
+	MaxStickerFileSize = 512 * 1024
+	// MaxStickerSetNameLength is a maximal length of the sticker set name
+	MaxStickerSetNameLength = 64
+	// StickerEmojisFile is a name of the metadata file in the stickers directory, it maps image names to emojis
+	StickerEmojisFile = "emojis.json"
+	// DefaultStickerEmojis are used for images without emojis in the metadata
+	DefaultStickerEmojis = "🙂"
+)
+
+var (
+	InvalidStickerSetName = errors.New("invalid sticker set name")
+	StickerTooLarge       = errors.New("sticker file is too large")
+	NoStickers            = errors.New("there are no stickers in the directory")
+	EmptyStickerStorage   = errors.New("sticker set storage is required")
+)
+
+// StickerSetName returns the name of the sticker set of the bot: name with the "_by_<bot username>" suffix.
+// Name can contain only english letters, digits and underscores, must begin with a letter
+// and can't contain consecutive underscores.
+func StickerSetName(name, botUsername string) (string, error) {
+	if botUsername == "" {
+		return "", EmptyUsername
+	}
+	suffix := "_by_" + botUsername
+	if !strings.HasSuffix(strings.ToLower(name), strings.ToLower(suffix)) {
+		name += suffix
+	}
+	if len(name) > MaxStickerSetNameLength || strings.Contains(name, "__") {
+		return "", InvalidStickerSetName
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '_'):
+		default:
+			return "", InvalidStickerSetName
+		}
+	}
+	return name, nil
+}
+
+// PrepareStickerPng returns the PNG image, that fits the sticker constraints: the longer side is StickerSize pixels
+// and the file is up to MaxStickerFileSize bytes. Valid images are returned as is, other images are resized.
+func PrepareStickerPng(data []byte) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "png" && len(data) <= MaxStickerFileSize && stickerFits(config.Width, config.Height) {
+		return data, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if bounds := img.Bounds(); !stickerFits(bounds.Dx(), bounds.Dy()) {
+		img = resizeSticker(img)
+	}
+	buffer := bytes.NewBuffer(nil)
+	if err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(buffer, img); err != nil {
+		return nil, err
+	}
+	if buffer.Len() > MaxStickerFileSize {
+		return nil, StickerTooLarge
+	}
+	return buffer.Bytes(), nil
+}
+
+func stickerFits(width, height int) bool {
+	return width <= StickerSize && height <= StickerSize && (width == StickerSize || height == StickerSize)
+}
+
+// resizeSticker scales the image, so the longer side is StickerSize pixels, each pixel is an average of its source area
+func resizeSticker(src image.Image) image.Image {
+	bounds := src.Bounds()
+	width, height := StickerSize, StickerSize
+	if bounds.Dx() > bounds.Dy() {
+		height = maxInt(1, bounds.Dy()*StickerSize/bounds.Dx())
+	} else {
+		width = maxInt(1, bounds.Dx()*StickerSize/bounds.Dy())
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := maxInt(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := maxInt(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset+0] = uint8(r / n >> 8)
+			dst.Pix[offset+1] = uint8(g / n >> 8)
+			dst.Pix[offset+2] = uint8(b / n >> 8)
+			dst.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// UploadStickerPng uploads the PNG image of the sticker, file can be used in the sticker set requests
+func (b *Bot) UploadStickerPng(ctx context.Context, userId int, data []byte) (*File, error) {
+	result := new(File)
+	return result, b.postFile(ctx, "uploadStickerFile", map[string]string{
+		"user_id": strconv.Itoa(userId),
+	}, "png_sticker", "sticker.png", data, &result)
+}
+
+// StickerSetManager manages the sticker set of the bot, e.g. synchronizes it with the directory of PNG images.
+// Identifiers of the synchronized stickers are kept in the Storage, so only changed images are uploaded.
+// Storage should be persistent, e.g. FileStorage: with the lost state, images are uploaded again.
+type StickerSetManager struct {
+	Bot *Bot
+	// UserId is an owner of the set
+	UserId int
+	// Name of the set, "_by_<bot username>" suffix is added if it is missing
+	Name string
+	// Title of the set, used for the new set
+	Title string
+	// DefaultEmojis are used for images without emojis in the metadata, DefaultStickerEmojis is used if empty
+	DefaultEmojis string
+	// KeepUnknown keeps stickers of the set, that are not added by the manager, after the synchronized ones.
+	// They are deleted if false, so the set mirrors the directory.
+	KeepUnknown bool
+	// Storage keeps the state of the synchronized directory, it is required, Sync returns EmptyStickerStorage if empty
+	Storage Storage
+
+	fullName string
+}
+
+type stickerState struct {
+	Hash   string `json:"hash"`
+	FileId string `json:"file_id"`
+}
+
+type stickerImage struct {
+	name   string
+	data   []byte
+	emojis string
+	hash   string
+}
+
+// NewStickerSetManager creates the manager of the set with the state in the storage
+func NewStickerSetManager(bot *Bot, storage Storage, userId int, name, title string) *StickerSetManager {
+	return &StickerSetManager{
+		Bot:     bot,
+		UserId:  userId,
+		Name:    name,
+		Title:   title,
+		Storage: storage,
+	}
+}
+
+// FullName returns the name of the set with the bot username suffix
+func (m *StickerSetManager) FullName(ctx context.Context) (string, error) {
+	if m.fullName != "" {
+		return m.fullName, nil
+	}
+	me, err := m.Bot.GetMe(ctx)
+	if err != nil {
+		return "", err
+	}
+	if m.fullName, err = StickerSetName(m.Name, me.Username); err != nil {
+		return "", err
+	}
+	return m.fullName, nil
+}
+
+// Get returns the sticker set
+func (m *StickerSetManager) Get(ctx context.Context) (*StickerSet, error) {
+	name, err := m.FullName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.Bot.GetStickerSet(ctx, &GetStickerSetRequest{Name: name})
+}
+
+// Sync makes the set match the directory: PNG images are stickers in the order of their names,
+// emojis are read from the StickerEmojisFile. New and changed images are added, stickers of missing images are deleted.
+// The set is created, if it doesn't exist. Stickers, that are not added by the manager, are deleted after
+// the images are added, unless KeepUnknown is set.
+func (m *StickerSetManager) Sync(ctx context.Context, dir string) (*StickerSet, error) {
+	if m.Storage == nil {
+		return nil, EmptyStickerStorage
+	}
+	images, err := m.images(dir)
+	if err != nil {
+		return nil, err
+	}
+	name, err := m.FullName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state, err := m.load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := m.Get(ctx)
+	if response := ErrorResponse(err); response != nil && strings.Contains(response.Description, "STICKERSET_INVALID") {
+		if set, err = m.create(ctx, name, images[0]); err != nil {
+			return nil, err
+		}
+		state = map[string]*stickerState{images[0].name: {Hash: images[0].hash, FileId: set.Stickers[0].FileId}}
+		if err = m.save(name, state); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = m.remove(ctx, set, images, state); err != nil {
+		return nil, err
+	}
+	if err = m.save(name, state); err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		if _, ok := state[img.name]; ok {
+			continue
+		}
+		if state[img.name], err = m.add(ctx, name, img); err != nil {
+			return nil, err
+		}
+		if err = m.save(name, state); err != nil {
+			return nil, err
+		}
+	}
+	if !m.KeepUnknown {
+		if err = m.removeUnknown(ctx, state); err != nil {
+			return nil, err
+		}
+	}
+	if err = m.reorder(ctx, images, state); err != nil {
+		return nil, err
+	}
+	return m.Get(ctx)
+}
+
+func (m *StickerSetManager) create(ctx context.Context, name string, img *stickerImage) (*StickerSet, error) {
+	file, err := m.Bot.UploadStickerPng(ctx, m.UserId, img.data)
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.Bot.CreateNewStickerSet(ctx, &CreateNewStickerSetRequest{
+		UserId:     m.UserId,
+		Name:       name,
+		Title:      m.Title,
+		PngSticker: file.FileId,
+		Emojis:     img.emojis,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.Get(ctx)
+}
+
+// add uploads the image and adds it to the end of the set
+func (m *StickerSetManager) add(ctx context.Context, name string, img *stickerImage) (*stickerState, error) {
+	file, err := m.Bot.UploadStickerPng(ctx, m.UserId, img.data)
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.Bot.AddStickerToSet(ctx, &AddStickerToSetRequest{
+		UserId:     m.UserId,
+		Name:       name,
+		PngSticker: file.FileId,
+		Emojis:     img.emojis,
+	})
+	if err != nil {
+		return nil, err
+	}
+	set, err := m.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(set.Stickers) == 0 {
+		return nil, WrongResponse
+	}
+	return &stickerState{Hash: img.hash, FileId: set.Stickers[len(set.Stickers)-1].FileId}, nil
+}
+
+// remove deletes stickers of the missing and changed images, stickers out of the state are not touched
+func (m *StickerSetManager) remove(ctx context.Context, set *StickerSet, images []*stickerImage, state map[string]*stickerState) error {
+	remote := make(map[string]bool, len(set.Stickers))
+	for _, sticker := range set.Stickers {
+		remote[sticker.FileId] = true
+	}
+	hashes := make(map[string]string, len(images))
+	for _, img := range images {
+		hashes[img.name] = img.hash
+	}
+	for name, item := range state {
+		if hash, ok := hashes[name]; ok && hash == item.Hash && remote[item.FileId] {
+			continue
+		}
+		if remote[item.FileId] {
+			if _, err := m.Bot.DeleteStickerFromSet(ctx, &DeleteStickerFromSetRequest{Sticker: item.FileId}); err != nil {
+				return err
+			}
+		}
+		delete(state, name)
+	}
+	return nil
+}
+
+// removeUnknown deletes stickers of the set, that are not in the state
+func (m *StickerSetManager) removeUnknown(ctx context.Context, state map[string]*stickerState) error {
+	set, err := m.Get(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(state))
+	for _, item := range state {
+		known[item.FileId] = true
+	}
+	for _, sticker := range set.Stickers {
+		if known[sticker.FileId] {
+			continue
+		}
+		if _, err = m.Bot.DeleteStickerFromSet(ctx, &DeleteStickerFromSetRequest{Sticker: sticker.FileId}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reorder moves stickers to the positions of their images
+func (m *StickerSetManager) reorder(ctx context.Context, images []*stickerImage, state map[string]*stickerState) error {
+	set, err := m.Get(ctx)
+	if err != nil {
+		return err
+	}
+	current := make([]string, 0, len(set.Stickers))
+	for _, sticker := range set.Stickers {
+		current = append(current, sticker.FileId)
+	}
+	for position, img := range images {
+		id := state[img.name].FileId
+		if position < len(current) && current[position] == id {
+			continue
+		}
+		if _, err = m.Bot.SetStickerPositionInSet(ctx, &SetStickerPositionInSetRequest{Sticker: id, Position: position}); err != nil {
+			return err
+		}
+		for i := range current {
+			if current[i] == id {
+				current = append(current[:i], current[i+1:]...)
+				break
+			}
+		}
+		current = append(current[:position], append([]string{id}, current[position:]...)...)
+	}
+	return nil
+}
+
+// images reads PNG images of the directory in the order of their names
+func (m *StickerSetManager) images(dir string) ([]*stickerImage, error) {
+	emojis := make(map[string]string)
+	data, err := ioutil.ReadFile(filepath.Join(dir, StickerEmojisFile))
+	if err == nil {
+		if err = json.Unmarshal(data, &emojis); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, NoStickers
+	}
+	sort.Strings(names)
+
+	images := make([]*stickerImage, 0, len(names))
+	for _, path := range names {
+		img := &stickerImage{name: filepath.Base(path), emojis: emojis[filepath.Base(path)]}
+		if img.emojis == "" {
+			img.emojis = m.defaultEmojis()
+		}
+		if img.data, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+		if img.data, err = PrepareStickerPng(img.data); err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(append(append([]byte{}, img.data...), img.emojis...))
+		img.hash = hex.EncodeToString(hash[:])
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func (m *StickerSetManager) defaultEmojis() string {
+	if m.DefaultEmojis != "" {
+		return m.DefaultEmojis
+	}
+	return DefaultStickerEmojis
+}
+
+func (m *StickerSetManager) load(name string) (map[string]*stickerState, error) {
+	state := make(map[string]*stickerState)
+	data, err := m.Storage.Get("stickers:" + name)
+	if err == KeyNotFound {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return state, json.Unmarshal(data, &state)
+}
+
+func (m *StickerSetManager) save(name string, state map[string]*stickerState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return m.Storage.Set("stickers:"+name, data)
+}
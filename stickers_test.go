@@ -0,0 +1,203 @@
+package tg_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func pngImage(t *testing.T, width, height int, fill color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	buffer := bytes.NewBuffer(nil)
+	if err := png.Encode(buffer, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestStickerSetName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "animals", want: "animals_by_test_bot"},
+		{name: "Animals_BY_Test_Bot", want: "Animals_BY_Test_Bot"},
+		{name: "cats2", want: "cats2_by_test_bot"},
+		{name: "2cats", wantErr: true},
+		{name: "big__cats", wantErr: true},
+		{name: "cats-and-dogs", wantErr: true},
+		{name: "a123456789a123456789a123456789a123456789a123456789a123", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tg.StickerSetName(tt.name, "test_bot")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("StickerSetName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("StickerSetName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareStickerPng(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantWidth     int
+		wantHeight    int
+	}{
+		{name: "valid", width: 512, height: 300, wantWidth: 512, wantHeight: 300},
+		{name: "large", width: 1024, height: 768, wantWidth: 512, wantHeight: 384},
+		{name: "small", width: 100, height: 200, wantWidth: 256, wantHeight: 512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := pngImage(t, tt.width, tt.height, color.RGBA{R: 255, A: 255})
+			got, err := tg.PrepareStickerPng(data)
+			if err != nil {
+				t.Fatalf("PrepareStickerPng() error = %v", err)
+			}
+			img, err := png.Decode(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("png.Decode() error = %v", err)
+			}
+			if bounds := img.Bounds(); bounds.Dx() != tt.wantWidth || bounds.Dy() != tt.wantHeight {
+				t.Errorf("PrepareStickerPng() size = %dx%d", bounds.Dx(), bounds.Dy())
+			}
+			if r, _, _, a := img.At(10, 10).RGBA(); r>>8 != 255 || a>>8 != 255 {
+				t.Errorf("PrepareStickerPng() color = %v", img.At(10, 10))
+			}
+		})
+	}
+	if _, err := tg.PrepareStickerPng([]byte("not an image")); err == nil {
+		t.Errorf("PrepareStickerPng() error = nil")
+	}
+}
+
+func TestStickerSetManager_Sync(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "stickers")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data []byte) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	emojis := func(set *tg.StickerSet) []string {
+		result := make([]string, 0, len(set.Stickers))
+		for _, sticker := range set.Stickers {
+			result = append(result, sticker.Emoji)
+		}
+		return result
+	}
+
+	write("1_cat.png", pngImage(t, 512, 512, color.RGBA{R: 255, A: 255}))
+	write("2_dog.png", pngImage(t, 1024, 1024, color.RGBA{G: 255, A: 255}))
+	write("3_fox.png", pngImage(t, 512, 256, color.RGBA{B: 255, A: 255}))
+	write(tg.StickerEmojisFile, []byte(`{"1_cat.png": "🐱", "2_dog.png": "🐶"}`))
+
+	if _, err = tg.NewStickerSetManager(server.Bot(), nil, 1, "animals", "Animals").Sync(ctx, dir); err != tg.EmptyStickerStorage {
+		t.Errorf("Sync() without storage error = %v", err)
+	}
+	storage := tg.NewMemoryStorage()
+	manager := tg.NewStickerSetManager(server.Bot(), storage, 1, "animals", "Animals")
+	set, err := manager.Sync(ctx, dir)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if set.Name != "animals_by_test_bot" || len(set.Stickers) != 3 {
+		t.Fatalf("Sync() = %+v", set)
+	}
+	if got := emojis(set); got[0] != "🐱" || got[1] != "🐶" || got[2] != tg.DefaultStickerEmojis {
+		t.Errorf("Sync() emojis = %v", got)
+	}
+	upload := server.LastCall("uploadStickerFile")
+	if img, err := png.Decode(bytes.NewReader(upload.Files["png_sticker"])); err != nil || img.Bounds().Dx() != 512 {
+		t.Errorf("uploaded sticker is not prepared: %v", err)
+	}
+
+	// unchanged directory is not uploaded again
+	server.Reset()
+	if _, err = manager.Sync(ctx, dir); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if calls := server.CallsTo("uploadStickerFile"); len(calls) != 0 {
+		t.Errorf("unchanged stickers uploaded = %d", len(calls))
+	}
+	// the state is restored from the storage after the restart
+	restarted := tg.NewStickerSetManager(server.Bot(), storage, 1, "animals", "Animals")
+	if _, err = restarted.Sync(ctx, dir); err != nil {
+		t.Fatalf("Sync() after restart error = %v", err)
+	}
+	if calls := len(server.CallsTo("uploadStickerFile")) + len(server.CallsTo("deleteStickerFromSet")); calls != 0 {
+		t.Errorf("unchanged stickers changed after restart = %d", calls)
+	}
+
+	// fox is moved to the start, dog is removed, cat emojis are changed
+	if err = os.Rename(filepath.Join(dir, "3_fox.png"), filepath.Join(dir, "0_fox.png")); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err = os.Remove(filepath.Join(dir, "2_dog.png")); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	write(tg.StickerEmojisFile, []byte(`{"0_fox.png": "🦊", "1_cat.png": "😺"}`))
+	server.Reset()
+	if set, err = manager.Sync(ctx, dir); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := emojis(set); len(got) != 2 || got[0] != "🦊" || got[1] != "😺" {
+		t.Errorf("Sync() emojis = %v", got)
+	}
+	if calls := server.CallsTo("deleteStickerFromSet"); len(calls) != 3 {
+		t.Errorf("deleted stickers = %d", len(calls))
+	}
+
+	// stickers of the adopted set, that are not in the state, are deleted after the images are added
+	server.Reset()
+	adopted := tg.NewStickerSetManager(server.Bot(), tg.NewMemoryStorage(), 1, "animals", "Animals")
+	if set, err = adopted.Sync(ctx, dir); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if calls := server.CallsTo("deleteStickerFromSet"); len(calls) != 2 {
+		t.Errorf("deleted unknown stickers = %d", len(calls))
+	}
+	if got := emojis(set); len(got) != 2 || got[0] != "🦊" || got[1] != "😺" {
+		t.Errorf("Sync() emojis = %v", got)
+	}
+
+	// unknown stickers are kept after the synchronized ones with KeepUnknown
+	server.Reset()
+	keeper := tg.NewStickerSetManager(server.Bot(), tg.NewMemoryStorage(), 1, "animals", "Animals")
+	keeper.KeepUnknown = true
+	if set, err = keeper.Sync(ctx, dir); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if calls := server.CallsTo("deleteStickerFromSet"); len(calls) != 0 {
+		t.Errorf("deleted unknown stickers = %d", len(calls))
+	}
+	if got := emojis(set); len(got) != 4 || got[0] != "🦊" || got[1] != "😺" {
+		t.Errorf("Sync() emojis = %v", got)
+	}
+}
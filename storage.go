@@ -0,0 +1,273 @@
+package tg
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var KeyNotFound = errors.New("key not found")
+
+// Storage is a key/value storage for the bot state
+type Storage interface {
+	// Get returns the value of the key, or KeyNotFound error
+	Get(key string) ([]byte, error)
+	// Set stores the value of the key
+	Set(key string, value []byte) error
+	// Delete removes the key, missing keys are ignored
+	Delete(key string) error
+}
+
+// SessionStore is a Storage with expiring keys and atomic updates
+type SessionStore interface {
+	Storage
+	// SetWithTTL stores the value of the key, that expires after the ttl; no expiration if ttl is empty
+	SetWithTTL(key string, value []byte, ttl time.Duration) error
+	// CompareAndSwap replaces the value of the key with the new one, only if the current value equals to the old.
+	// Nil old value means, that the key should be missing; nil new value deletes the key.
+	CompareAndSwap(key string, old, new []byte, ttl time.Duration) (bool, error)
+}
+
+// MemoryStorage is an in-memory SessionStore, state is lost on restart
+type MemoryStorage struct {
+	// Limit is a maximal number of keys, least recently used keys are evicted; no limit if empty
+	Limit int
+
+	mu    sync.Mutex
+	data  map[string]*list.Element
+	order *list.List
+}
+
+// FileStorage is a SessionStore, persisted into the JSON file. Whole file is rewritten on every change.
+type FileStorage struct {
+	mu   sync.Mutex
+	path string
+	data map[string]*storageEntry
+}
+
+type storageEntry struct {
+	Key     string `json:"-"`
+	Value   []byte `json:"value"`
+	Expires int64  `json:"expires,omitempty"`
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		data:  make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (s *MemoryStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.get(key)
+	if entry == nil {
+		return nil, KeyNotFound
+	}
+	return append([]byte{}, entry.Value...), nil
+}
+
+func (s *MemoryStorage) Set(key string, value []byte) error {
+	return s.SetWithTTL(key, value, 0)
+}
+
+func (s *MemoryStorage) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key, value, ttl)
+	return nil
+}
+
+func (s *MemoryStorage) CompareAndSwap(key string, old, new []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !matches(s.get(key), old) {
+		return false, nil
+	}
+	if new == nil {
+		s.delete(key)
+	} else {
+		s.set(key, new, ttl)
+	}
+	return true, nil
+}
+
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(key)
+	return nil
+}
+
+// Len returns the number of stored keys, including expired ones, that were not accessed yet
+func (s *MemoryStorage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.data)
+}
+
+func (s *MemoryStorage) get(key string) *storageEntry {
+	element, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*storageEntry)
+	if entry.expired() {
+		s.delete(key)
+		return nil
+	}
+	s.order.MoveToFront(element)
+	return entry
+}
+
+func (s *MemoryStorage) set(key string, value []byte, ttl time.Duration) {
+	entry := newStorageEntry(key, value, ttl)
+	if element, ok := s.data[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return
+	}
+	s.data[key] = s.order.PushFront(entry)
+	for s.Limit > 0 && s.order.Len() > s.Limit {
+		s.delete(s.order.Back().Value.(*storageEntry).Key)
+	}
+}
+
+func (s *MemoryStorage) delete(key string) {
+	if element, ok := s.data[key]; ok {
+		s.order.Remove(element)
+		delete(s.data, key)
+	}
+}
+
+// NewFileStorage opens the storage, the file is created on the first change
+func NewFileStorage(path string) (*FileStorage, error) {
+	s := &FileStorage{
+		path: path,
+		data: make(map[string]*storageEntry),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &s.data); err != nil {
+		return nil, err
+	}
+	for key, entry := range s.data {
+		entry.Key = key
+	}
+	return s, nil
+}
+
+func (s *FileStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.get(key)
+	if entry == nil {
+		return nil, KeyNotFound
+	}
+	return append([]byte{}, entry.Value...), nil
+}
+
+func (s *FileStorage) Set(key string, value []byte) error {
+	return s.SetWithTTL(key, value, 0)
+}
+
+func (s *FileStorage) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = newStorageEntry(key, value, ttl)
+	return s.save()
+}
+
+func (s *FileStorage) CompareAndSwap(key string, old, new []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !matches(s.get(key), old) {
+		return false, nil
+	}
+	if new == nil {
+		delete(s.data, key)
+	} else {
+		s.data[key] = newStorageEntry(key, new, ttl)
+	}
+	return true, s.save()
+}
+
+func (s *FileStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+	delete(s.data, key)
+	return s.save()
+}
+
+func (s *FileStorage) get(key string) *storageEntry {
+	entry, ok := s.data[key]
+	if !ok || entry.expired() {
+		return nil
+	}
+	return entry
+}
+
+// save writes data into the temporary file and renames it, so the file is never left half-written.
+// Expired keys are dropped.
+func (s *FileStorage) save() error {
+	for key, entry := range s.data {
+		if entry.expired() {
+			delete(s.data, key)
+		}
+	}
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+	if err = file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), s.path)
+}
+
+func newStorageEntry(key string, value []byte, ttl time.Duration) *storageEntry {
+	entry := &storageEntry{
+		Key:   key,
+		Value: append([]byte{}, value...),
+	}
+	if ttl > 0 {
+		entry.Expires = now().Add(ttl).UnixNano()
+	}
+	return entry
+}
+
+func (e *storageEntry) expired() bool {
+	return e.Expires != 0 && now().UnixNano() >= e.Expires
+}
+
+func matches(entry *storageEntry, value []byte) bool {
+	if entry == nil || value == nil {
+		return entry == nil && value == nil
+	}
+	return bytes.Equal(entry.Value, value)
+}
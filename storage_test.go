@@ -0,0 +1,143 @@
+package tg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStorage(t *testing.T, storage Storage) {
+	if _, err := storage.Get("key"); err != KeyNotFound {
+		t.Errorf("Get() error = %v, want KeyNotFound", err)
+	}
+	if err := storage.Set("key", []byte("value")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if value, err := storage.Get("key"); err != nil || string(value) != "value" {
+		t.Errorf("Get() = %q, %v", value, err)
+	}
+	if err := storage.Delete("key"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := storage.Get("key"); err != KeyNotFound {
+		t.Errorf("Get() error = %v, want KeyNotFound", err)
+	}
+	if err := storage.Delete("missing"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	storage, err := NewFileStorage(path)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	testStorage(t, storage)
+	if err = storage.Set("persisted", []byte{0, 1, 2}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	reopened, err := NewFileStorage(path)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	if value, err := reopened.Get("persisted"); err != nil || string(value) != "\x00\x01\x02" {
+		t.Errorf("Get() = %v, %v", value, err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("temporary files are left: %d files", len(files))
+	}
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	fixed := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	defer func() { now = time.Now }()
+
+	if err := store.SetWithTTL("ttl", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL() error = %v", err)
+	}
+	if _, err := store.Get("ttl"); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	fixed = fixed.Add(time.Minute)
+	if _, err := store.Get("ttl"); err != KeyNotFound {
+		t.Errorf("Get() error = %v, want KeyNotFound", err)
+	}
+
+	tests := []struct {
+		name     string
+		old, new []byte
+		want     bool
+		value    string
+	}{
+		{name: "create", old: nil, new: []byte("a"), want: true, value: "a"},
+		{name: "create existing", old: nil, new: []byte("b"), want: false, value: "a"},
+		{name: "swap", old: []byte("a"), new: []byte("b"), want: true, value: "b"},
+		{name: "swap changed", old: []byte("a"), new: []byte("c"), want: false, value: "b"},
+		{name: "delete", old: []byte("b"), new: nil, want: true, value: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := store.CompareAndSwap("cas", tt.old, tt.new, 0)
+			if err != nil || ok != tt.want {
+				t.Errorf("CompareAndSwap() = %v, %v, want %v", ok, err, tt.want)
+			}
+			if value, _ := store.Get("cas"); string(value) != tt.value {
+				t.Errorf("Get() = %q, want %q", value, tt.value)
+			}
+		})
+	}
+}
+
+func TestMemoryStorage_SessionStore(t *testing.T) {
+	testSessionStore(t, NewMemoryStorage())
+}
+
+func TestFileStorage_SessionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storage, err := NewFileStorage(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	testSessionStore(t, storage)
+}
+
+func TestMemoryStorage_Limit(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.Limit = 2
+	_ = storage.Set("a", []byte("1"))
+	_ = storage.Set("b", []byte("2"))
+	_, _ = storage.Get("a")
+	_ = storage.Set("c", []byte("3"))
+
+	if _, err := storage.Get("b"); err != KeyNotFound {
+		t.Errorf("Get(b) error = %v, want KeyNotFound", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := storage.Get(key); err != nil {
+			t.Errorf("Get(%s) error = %v", key, err)
+		}
+	}
+	if storage.Len() != 2 {
+		t.Errorf("Len() = %d", storage.Len())
+	}
+}
@@ -0,0 +1,264 @@
+package tgtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spyzhov/tg"
+)
+
+// Mode of the Recorder
+type Mode int
+
+const (
+	// Replay responds with the recorded interactions, unmatched requests fail
+	Replay Mode = iota
+	// Record passes requests to the real transport and records the interactions
+	Record
+)
+
+// RecordEnv is the environment variable, that turns UseCassette into the Record mode, e.g. TG_RECORD=1
+const RecordEnv = "TG_RECORD"
+
+// Interaction is a recorded pair of the API request and response
+type Interaction struct {
+	// Method name, the token is never recorded
+	Method string `json:"method"`
+	// Request is a normalized JSON body of the request, multipart forms are recorded as JSON objects of the fields,
+	// files are replaced with SHA-256 hashes of their contents
+	Request json.RawMessage `json:"request"`
+	// Status code of the response
+	Status int `json:"status"`
+	// Response body
+	Response json.RawMessage `json:"response"`
+}
+
+// Cassette is a fixture file with the recorded interactions
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Recorder is a http.RoundTripper, that records API calls into the cassette file or replays them from it.
+// It is plugged into the Bot.Client, so it covers every API method.
+type Recorder struct {
+	// Mode of the recorder
+	Mode Mode
+	// Path of the cassette file
+	Path string
+	// Transport is used in the Record mode, http.DefaultTransport is used if empty
+	Transport http.RoundTripper
+
+	mu        sync.Mutex
+	cassette  *Cassette
+	used      []bool
+	unmatched []string
+}
+
+// NewRecorder creates the recorder, in the Replay mode the cassette file is loaded
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		Mode:     mode,
+		Path:     path,
+		cassette: new(Cassette),
+	}
+	if mode == Replay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, r.cassette); err != nil {
+			return nil, fmt.Errorf("tgtest: invalid cassette %s: %s", path, err)
+		}
+		for _, interaction := range r.cassette.Interactions {
+			if interaction.Request, err = normalize("", interaction.Request); err != nil {
+				return nil, fmt.Errorf("tgtest: invalid cassette %s: %s", path, err)
+			}
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// UseCassette plugs the recorder into the bot. Record mode is turned on with the TG_RECORD environment variable.
+// Returned function should be deferred: it saves the recorded cassette and reports unmatched requests.
+func UseCassette(t testing.TB, bot *tg.Bot, path string) func() {
+	mode := Replay
+	if os.Getenv(RecordEnv) != "" {
+		mode = Record
+	}
+	recorder, err := NewRecorder(path, mode)
+	if err != nil {
+		t.Fatalf("tgtest: can't load cassette: %s", err)
+	}
+	bot.Client = recorder.Client()
+	return func() {
+		for _, request := range recorder.Unmatched() {
+			t.Errorf("tgtest: unmatched request %s", request)
+		}
+		if err := recorder.Save(); err != nil {
+			t.Errorf("tgtest: can't save cassette: %s", err)
+		}
+	}
+}
+
+// Client returns the http.Client with the recorder transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Save writes recorded interactions into the cassette file, does nothing in the Replay mode
+func (r *Recorder) Save() error {
+	if r.Mode != Record {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path, append(data, '\n'), 0644)
+}
+
+// Unmatched returns requests, that were not found in the cassette
+func (r *Recorder) Unmatched() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.unmatched...)
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	method := path.Base(request.URL.Path)
+	normalized, err := normalize(request.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, err
+	}
+	if r.Mode == Record {
+		return r.record(request, method, body, normalized)
+	}
+	return r.replay(request, method, normalized)
+}
+
+func (r *Recorder) record(request *http.Request, method string, body, normalized []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if !json.Valid(data) {
+		data, _ = json.Marshal(string(data))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Method:   method,
+		Request:  normalized,
+		Status:   response.StatusCode,
+		Response: data,
+	})
+	return response, nil
+}
+
+func (r *Recorder) replay(request *http.Request, method string, normalized []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || interaction.Method != method || !bytes.Equal(interaction.Request, normalized) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+			StatusCode:    interaction.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			Body:          ioutil.NopCloser(bytes.NewReader(interaction.Response)),
+			ContentLength: int64(len(interaction.Response)),
+			Request:       request,
+		}, nil
+	}
+	unmatched := method + " " + string(normalized)
+	r.unmatched = append(r.unmatched, unmatched)
+	return nil, fmt.Errorf("tgtest: unmatched request %s", unmatched)
+}
+
+// normalize re-encodes JSON body, so keys are sorted and whitespaces are removed.
+// Multipart form is converted into the JSON object, so the random boundary doesn't break matching.
+func normalize(contentType string, body []byte) ([]byte, error) {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return []byte("{}"), nil
+	}
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		return normalizeMultipart(contentType, body)
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("tgtest: request body is not a JSON: %s", err)
+	}
+	return json.Marshal(value)
+}
+
+// normalizeMultipart returns the JSON object of the form fields, files are replaced with the hashes of their contents
+func normalizeMultipart(contentType string, body []byte) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("tgtest: request body is not a multipart form: %s", err)
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" {
+			hash := sha256.Sum256(data)
+			fields[part.FormName()] = "sha256:" + hex.EncodeToString(hash[:])
+			continue
+		}
+		fields[part.FormName()] = string(data)
+	}
+	return json.Marshal(fields)
+}
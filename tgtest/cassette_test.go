@@ -0,0 +1,113 @@
+package tgtest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+	ctx := context.Background()
+
+	server := tgtest.NewServer()
+	recorder, err := tgtest.NewRecorder(path, tgtest.Record)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	bot := server.Bot()
+	bot.Client = recorder.Client()
+	if _, err = bot.GetMe(ctx); err != nil {
+		t.Fatalf("GetMe() error = %v", err)
+	}
+	if _, err = bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 42, Text: "hello"}); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if err = recorder.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	server.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), tgtest.Token) {
+		t.Errorf("token should be redacted: %s", data)
+	}
+
+	recorder, err = tgtest.NewRecorder(path, tgtest.Replay)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	bot = tg.New("any")
+	bot.Host = "http://127.0.0.1:1"
+	bot.Client = recorder.Client()
+	user, err := bot.GetMe(ctx)
+	if err != nil || user.Username != "test_bot" {
+		t.Errorf("GetMe() = %#v, %v", user, err)
+	}
+	message, err := bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 42, Text: "hello"})
+	if err != nil || message.Text != "hello" {
+		t.Errorf("SendMessage() = %#v, %v", message, err)
+	}
+	if _, err = bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 42, Text: "hello"}); err == nil {
+		t.Errorf("interaction can be replayed only once")
+	}
+	if _, err = bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 42, Text: "other"}); err == nil {
+		t.Errorf("unmatched request should fail")
+	}
+	if unmatched := recorder.Unmatched(); len(unmatched) != 2 || !strings.HasPrefix(unmatched[1], "sendMessage ") {
+		t.Errorf("wrong unmatched requests: %v", unmatched)
+	}
+}
+
+func TestRecorder_Multipart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+	ctx := context.Background()
+
+	server := tgtest.NewServer()
+	recorder, err := tgtest.NewRecorder(path, tgtest.Record)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	bot := server.Bot()
+	bot.Client = recorder.Client()
+	if _, err = bot.UploadStickerPng(ctx, 1, []byte("sticker")); err != nil {
+		t.Fatalf("UploadStickerPng() error = %v", err)
+	}
+	if err = recorder.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	server.Close()
+
+	recorder, err = tgtest.NewRecorder(path, tgtest.Replay)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	bot = tg.New("any")
+	bot.Host = "http://127.0.0.1:1"
+	bot.Client = recorder.Client()
+	if _, err = bot.UploadStickerPng(ctx, 1, []byte("other")); err == nil {
+		t.Errorf("file with the other contents should not match")
+	}
+	if file, err := bot.UploadStickerPng(ctx, 1, []byte("sticker")); err != nil || file.FileId == "" {
+		t.Errorf("UploadStickerPng() = %#v, %v", file, err)
+	}
+}
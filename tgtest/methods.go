@@ -0,0 +1,1195 @@
+package tgtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spyzhov/tg"
+)
+
+// method handles the API call, it is called with the locked state
+type method func(s *Server, body []byte) (interface{}, *Failure)
+
+var methods = map[string]method{
+	"getMe":                   (*Server).getMe,
+	"setWebhook":              (*Server).setWebhook,
+	"deleteWebhook":           (*Server).deleteWebhook,
+	"getWebhookInfo":          (*Server).getWebhookInfo,
+	"sendMessage":             (*Server).sendMessage,
+	"forwardMessage":          (*Server).forwardMessage,
+	"sendPhoto":               media("photo"),
+	"sendAudio":               media("audio"),
+	"sendDocument":            media("document"),
+	"sendVideo":               media("video"),
+	"sendAnimation":           media("animation"),
+	"sendVoice":               media("voice"),
+	"sendVideoNote":           media("video_note"),
+	"sendSticker":             media("sticker"),
+	"sendMediaGroup":          (*Server).sendMediaGroup,
+	"sendLocation":            (*Server).sendLocation,
+	"editMessageLiveLocation": (*Server).editMessageLiveLocation,
+	"stopMessageLiveLocation": (*Server).stopMessageLiveLocation,
+	"sendVenue":               (*Server).sendVenue,
+	"sendContact":             (*Server).sendContact,
+	"sendPoll":                (*Server).sendPoll,
+	"sendChatAction":          (*Server).sendChatAction,
+	"getUserProfilePhotos":    (*Server).getUserProfilePhotos,
+	"getFile":                 (*Server).getFile,
+	"kickChatMember":          (*Server).kickChatMember,
+	"unbanChatMember":         (*Server).unbanChatMember,
+	"restrictChatMember":      (*Server).restrictChatMember,
+	"promoteChatMember":       (*Server).promoteChatMember,
+	"exportChatInviteLink":    (*Server).exportChatInviteLink,
+	"setChatPhoto":            (*Server).setChatPhoto,
+	"deleteChatPhoto":         (*Server).deleteChatPhoto,
+	"setChatTitle":            (*Server).setChatTitle,
+	"setChatDescription":      (*Server).setChatDescription,
+	"pinChatMessage":          (*Server).pinChatMessage,
+	"unpinChatMessage":        (*Server).unpinChatMessage,
+	"leaveChat":               (*Server).leaveChat,
+	"getChat":                 (*Server).getChat,
+	"getChatAdministrators":   (*Server).getChatAdministrators,
+	"getChatMembersCount":     (*Server).getChatMembersCount,
+	"getChatMember":           (*Server).getChatMember,
+	"setChatStickerSet":       (*Server).setChatStickerSet,
+	"deleteChatStickerSet":    (*Server).deleteChatStickerSet,
+	"answerCallbackQuery":     (*Server).answer,
+	"answerInlineQuery":       (*Server).answer,
+	"answerShippingQuery":     (*Server).answer,
+	"answerPreCheckoutQuery":  (*Server).answer,
+	"setPassportDataErrors":   (*Server).answer,
+	"editMessageText":         (*Server).editMessageText,
+	"editMessageCaption":      (*Server).editMessageCaption,
+	"editMessageMedia":        (*Server).editMessageMedia,
+	"editMessageReplyMarkup":  (*Server).editMessageReplyMarkup,
+	"stopPoll":                (*Server).stopPoll,
+	"deleteMessage":           (*Server).deleteMessage,
+	"getStickerSet":           (*Server).getStickerSet,
+	"uploadStickerFile":       (*Server).uploadStickerFile,
+	"createNewStickerSet":     (*Server).createNewStickerSet,
+	"addStickerToSet":         (*Server).addStickerToSet,
+	"setStickerPositionInSet": (*Server).setStickerPositionInSet,
+	"deleteStickerFromSet":    (*Server).deleteStickerFromSet,
+	"sendInvoice":             (*Server).sendInvoice,
+	"sendGame":                (*Server).sendGame,
+	"setGameScore":            (*Server).setGameScore,
+	"getGameHighScores":       (*Server).getGameHighScores,
+}
+
+// outgoing contains common fields of the send methods
+type outgoing struct {
+	ChatId           int             `json:"chat_id"`
+	Caption          string          `json:"caption"`
+	ReplyToMessageId int             `json:"reply_to_message_id"`
+	ReplyMarkup      json.RawMessage `json:"reply_markup"`
+}
+
+// target contains common fields of the edit methods
+type target struct {
+	ChatId          int    `json:"chat_id"`
+	MessageId       int    `json:"message_id"`
+	InlineMessageId string `json:"inline_message_id"`
+}
+
+func decode(body []byte, request interface{}) *Failure {
+	if err := json.Unmarshal(body, request); err != nil {
+		return BadRequest(err.Error())
+	}
+	return nil
+}
+
+func (s *Server) getMe(_ []byte) (interface{}, *Failure) {
+	return s.me, nil
+}
+
+func (s *Server) setWebhook(body []byte) (interface{}, *Failure) {
+	request := new(tg.SetWebhookRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if request.Url != "" && !strings.HasPrefix(request.Url, "https://") {
+		return nil, BadRequest("bad webhook: HTTPS url must be provided for webhook")
+	}
+	s.webhook = tg.WebhookInfo{
+		Url:            request.Url,
+		MaxConnections: request.MaxConnections,
+		AllowedUpdates: request.AllowedUpdates,
+	}
+	return true, nil
+}
+
+func (s *Server) deleteWebhook(_ []byte) (interface{}, *Failure) {
+	s.webhook = tg.WebhookInfo{}
+	return true, nil
+}
+
+func (s *Server) getWebhookInfo(_ []byte) (interface{}, *Failure) {
+	info := s.webhook
+	info.PendingUpdateCount = len(s.updates)
+	return info, nil
+}
+
+// send stores the new outgoing message of the bot
+func (s *Server) send(request *outgoing, fill func(message *tg.Message)) (*tg.Message, *Failure) {
+	return s.sendChecked(request, func(message *tg.Message) *Failure {
+		if fill != nil {
+			fill(message)
+		}
+		return nil
+	})
+}
+
+// sendChecked stores the message, filled by the fill function, the message is not stored if fill fails
+func (s *Server) sendChecked(request *outgoing, fill func(message *tg.Message) *Failure) (*tg.Message, *Failure) {
+	if request.ChatId == 0 {
+		return nil, BadRequest("chat_id is empty")
+	}
+	state := s.chat(request.ChatId)
+	state.lastId++
+	me := *s.me
+	message := &tg.Message{
+		MessageId: state.lastId,
+		From:      &me,
+		Date:      int(time.Now().Unix()),
+		Chat:      state.chat,
+		Caption:   request.Caption,
+	}
+	if request.ReplyToMessageId != 0 {
+		reply, ok := state.messages[request.ReplyToMessageId]
+		if !ok {
+			state.lastId--
+			return nil, BadRequest("reply message not found")
+		}
+		message.ReplyToMessage = reply
+	}
+	message.ReplyMarkup = inlineKeyboard(request.ReplyMarkup)
+	if fail := fill(message); fail != nil {
+		state.lastId--
+		return nil, fail
+	}
+	state.messages[message.MessageId] = message
+	return message, nil
+}
+
+func inlineKeyboard(data json.RawMessage) *tg.InlineKeyboardMarkup {
+	if len(data) == 0 {
+		return nil
+	}
+	markup := new(tg.InlineKeyboardMarkup)
+	if err := json.Unmarshal(data, markup); err != nil || markup.InlineKeyboard == nil {
+		return nil
+	}
+	return markup
+}
+
+// fileId returns the identifier of the sent file: file_id is used as is, new identifier is generated for the uploads
+func (s *Server) fileId(value interface{}) string {
+	id, ok := value.(string)
+	if !ok || id == "" || strings.HasPrefix(id, "attach://") || strings.Contains(id, "://") {
+		s.sequence++
+		id = "file_" + strconv.Itoa(s.sequence)
+	}
+	if _, ok := s.files[id]; !ok {
+		s.files[id] = &tg.File{FileId: id}
+	}
+	return id
+}
+
+func (s *Server) setMedia(message *tg.Message, kind string, value interface{}) *Failure {
+	id := s.fileId(value)
+	switch kind {
+	case "photo":
+		message.Photo = []*tg.PhotoSize{
+			{FileId: id + "_s", Width: 90, Height: 90},
+			{FileId: id, Width: 800, Height: 800},
+		}
+	case "audio":
+		message.Audio = &tg.Audio{FileId: id}
+	case "document":
+		message.Document = &tg.Document{FileId: id}
+	case "video":
+		message.Video = &tg.Video{FileId: id}
+	case "animation":
+		message.Animation = &tg.Animation{FileId: id}
+		message.Document = &tg.Document{FileId: id}
+	case "voice":
+		message.Voice = &tg.Voice{FileId: id}
+	case "video_note":
+		message.VideoNote = &tg.VideoNote{FileId: id}
+	case "sticker":
+		message.Sticker = &tg.Sticker{FileId: id, Width: 512, Height: 512}
+	default:
+		return BadRequest("unsupported media type " + kind)
+	}
+	return nil
+}
+
+func media(kind string) method {
+	return func(s *Server, body []byte) (interface{}, *Failure) {
+		request := new(outgoing)
+		if fail := decode(body, request); fail != nil {
+			return nil, fail
+		}
+		fields := make(map[string]interface{})
+		if fail := decode(body, &fields); fail != nil {
+			return nil, fail
+		}
+		if fields[kind] == nil {
+			return nil, BadRequest("there is no " + kind + " in the request")
+		}
+		return s.sendChecked(request, func(message *tg.Message) *Failure {
+			return s.setMedia(message, kind, fields[kind])
+		})
+	}
+}
+
+func (s *Server) sendMessage(body []byte) (interface{}, *Failure) {
+	request := new(outgoing)
+	text := new(tg.SendMessageRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, text); fail != nil {
+		return nil, fail
+	}
+	if strings.TrimSpace(text.Text) == "" {
+		return nil, BadRequest("message text is empty")
+	}
+	return s.send(request, func(message *tg.Message) {
+		message.Text = text.Text
+	})
+}
+
+func (s *Server) forwardMessage(body []byte) (interface{}, *Failure) {
+	request := new(tg.ForwardMessageRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	source, ok := s.chat(request.FromChatId).messages[request.MessageId]
+	if !ok {
+		return nil, BadRequest("message to forward not found")
+	}
+	return s.send(&outgoing{ChatId: request.ChatId}, func(message *tg.Message) {
+		id, from, chat, date := message.MessageId, message.From, message.Chat, message.Date
+		*message = *source
+		message.MessageId, message.From, message.Chat, message.Date = id, from, chat, date
+		message.ReplyToMessage = nil
+		message.ForwardDate = source.Date
+		if source.Chat.IsChannel() {
+			message.ForwardFromChat = source.Chat
+			message.ForwardFromMessageId = source.MessageId
+		} else {
+			message.ForwardFrom = source.From
+		}
+	})
+}
+
+func (s *Server) sendMediaGroup(body []byte) (interface{}, *Failure) {
+	var request struct {
+		outgoing
+		Media []struct {
+			Type    string      `json:"type"`
+			Media   interface{} `json:"media"`
+			Caption string      `json:"caption"`
+		} `json:"media"`
+	}
+	if fail := decode(body, &request); fail != nil {
+		return nil, fail
+	}
+	if len(request.Media) < 2 || len(request.Media) > 10 {
+		return nil, BadRequest("wrong number of media in the group")
+	}
+	s.sequence++
+	group := strconv.Itoa(s.sequence)
+	result := make([]*tg.Message, 0, len(request.Media))
+	for _, item := range request.Media {
+		if item.Type != "photo" && item.Type != "video" {
+			return nil, BadRequest("unsupported media type " + item.Type)
+		}
+		message, fail := s.sendChecked(&outgoing{ChatId: request.ChatId, Caption: item.Caption}, func(message *tg.Message) *Failure {
+			message.MediaGroupId = group
+			return s.setMedia(message, item.Type, item.Media)
+		})
+		if fail != nil {
+			return nil, fail
+		}
+		result = append(result, message)
+	}
+	return result, nil
+}
+
+func (s *Server) sendLocation(body []byte) (interface{}, *Failure) {
+	request := new(outgoing)
+	location := new(tg.SendLocationRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, location); fail != nil {
+		return nil, fail
+	}
+	if location.LivePeriod != 0 && (location.LivePeriod < 60 || location.LivePeriod > 86400) {
+		return nil, BadRequest("wrong live period specified")
+	}
+	return s.send(request, func(message *tg.Message) {
+		message.Location = &tg.Location{Latitude: location.Latitude, Longitude: location.Longitude}
+		if location.LivePeriod != 0 {
+			s.live[s.liveKey(message.Chat.Id, message.MessageId, "")] = message.Date + location.LivePeriod
+		}
+	})
+}
+
+func (s *Server) liveKey(chatId, messageId int, inlineMessageId string) string {
+	if inlineMessageId != "" {
+		return inlineMessageId
+	}
+	return fmt.Sprintf("%d:%d", chatId, messageId)
+}
+
+// editable finds the message for the edit methods, nil message is returned for the inline messages
+func (s *Server) editable(request *target) (*tg.Message, *Failure) {
+	if request.InlineMessageId != "" {
+		return nil, nil
+	}
+	if request.ChatId == 0 || request.MessageId == 0 {
+		return nil, BadRequest("message identifier is not specified")
+	}
+	message, ok := s.chat(request.ChatId).messages[request.MessageId]
+	if !ok {
+		return nil, BadRequest("message to edit not found")
+	}
+	return message, nil
+}
+
+func (s *Server) edited(message *tg.Message) (interface{}, *Failure) {
+	if message == nil {
+		return true, nil
+	}
+	message.EditDate = int(time.Now().Unix())
+	return message, nil
+}
+
+func (s *Server) editMessageLiveLocation(body []byte) (interface{}, *Failure) {
+	request := new(target)
+	location := new(tg.EditMessageLiveLocationRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, location); fail != nil {
+		return nil, fail
+	}
+	message, fail := s.editable(request)
+	if fail != nil {
+		return nil, fail
+	}
+	key := s.liveKey(request.ChatId, request.MessageId, request.InlineMessageId)
+	if message == nil {
+		if _, ok := s.live[key]; !ok {
+			s.live[key] = int(time.Now().Unix()) + 86400
+		}
+	}
+	if until, ok := s.live[key]; !ok || until < int(time.Now().Unix()) {
+		return nil, BadRequest("message can't be edited")
+	}
+	if message != nil {
+		if message.Location.Latitude == location.Latitude && message.Location.Longitude == location.Longitude {
+			return nil, BadRequest("message is not modified")
+		}
+		message.Location = &tg.Location{Latitude: location.Latitude, Longitude: location.Longitude}
+	}
+	return s.edited(message)
+}
+
+func (s *Server) stopMessageLiveLocation(body []byte) (interface{}, *Failure) {
+	request := new(target)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	message, fail := s.editable(request)
+	if fail != nil {
+		return nil, fail
+	}
+	key := s.liveKey(request.ChatId, request.MessageId, request.InlineMessageId)
+	if until, ok := s.live[key]; message != nil && (!ok || until < int(time.Now().Unix())) {
+		return nil, BadRequest("message can't be edited")
+	}
+	s.live[key] = 0
+	return s.edited(message)
+}
+
+func (s *Server) sendVenue(body []byte) (interface{}, *Failure) {
+	request := new(outgoing)
+	venue := new(tg.SendVenueRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, venue); fail != nil {
+		return nil, fail
+	}
+	return s.send(request, func(message *tg.Message) {
+		location := &tg.Location{Latitude: venue.Latitude, Longitude: venue.Longitude}
+		message.Location = location
+		message.Venue = &tg.Venue{
+			Location:       location,
+			Title:          venue.Title,
+			Address:        venue.Address,
+			FoursquareId:   venue.FoursquareId,
+			FoursquareType: venue.FoursquareType,
+		}
+	})
+}
+
+func (s *Server) sendContact(body []byte) (interface{}, *Failure) {
+	request := new(outgoing)
+	contact := new(tg.SendContactRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, contact); fail != nil {
+		return nil, fail
+	}
+	return s.send(request, func(message *tg.Message) {
+		message.Contact = &tg.Contact{
+			PhoneNumber: contact.PhoneNumber,
+			FirstName:   contact.FirstName,
+			LastName:    contact.LastName,
+			Vcard:       contact.Vcard,
+		}
+	})
+}
+
+func (s *Server) sendPoll(body []byte) (interface{}, *Failure) {
+	request := new(outgoing)
+	poll := new(tg.SendPollRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, poll); fail != nil {
+		return nil, fail
+	}
+	if len(poll.Options) < 2 || len(poll.Options) > 10 {
+		return nil, BadRequest("poll must have 2-10 options")
+	}
+	if s.chat(request.ChatId).chat.IsPrivate() {
+		return nil, BadRequest("polls can't be sent to private chats")
+	}
+	return s.send(request, func(message *tg.Message) {
+		s.sequence++
+		message.Poll = &tg.Poll{Id: "poll_" + strconv.Itoa(s.sequence), Question: poll.Question}
+		for _, option := range poll.Options {
+			message.Poll.Options = append(message.Poll.Options, &tg.PollOption{Text: option})
+		}
+	})
+}
+
+func (s *Server) stopPoll(body []byte) (interface{}, *Failure) {
+	request := new(tg.StopPollRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	message, ok := s.chat(request.ChatId).messages[request.MessageId]
+	if !ok || message.Poll == nil {
+		return nil, BadRequest("message with poll to stop not found")
+	}
+	if message.Poll.IsClosed {
+		return nil, BadRequest("poll has already been closed")
+	}
+	message.Poll.IsClosed = true
+	if request.ReplyMarkup != nil {
+		message.ReplyMarkup = request.ReplyMarkup
+	}
+	return message.Poll, nil
+}
+
+func (s *Server) sendChatAction(body []byte) (interface{}, *Failure) {
+	request := new(tg.SendChatActionRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if !tg.ChatAction(request.Action).IsValid() {
+		return nil, BadRequest("wrong parameter action in request")
+	}
+	return true, nil
+}
+
+func (s *Server) getUserProfilePhotos(_ []byte) (interface{}, *Failure) {
+	return &tg.UserProfilePhotos{Photos: [][]*tg.PhotoSize{}}, nil
+}
+
+func (s *Server) getFile(body []byte) (interface{}, *Failure) {
+	request := new(tg.GetFileRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	file, ok := s.files[request.FileId]
+	if !ok {
+		return nil, BadRequest("invalid file id")
+	}
+	if file.FilePath == "" {
+		file.FilePath = "files/" + file.FileId
+	}
+	return file, nil
+}
+
+// member returns the member of the group chat, the left member is created for the unknown users
+func (s *Server) member(chatId, userId int) (*tg.ChatMember, *Failure) {
+	state := s.chat(chatId)
+	if state.chat.IsPrivate() {
+		return nil, BadRequest("chat member status can't be changed in private chats")
+	}
+	member, ok := state.members[userId]
+	if !ok {
+		member = &tg.ChatMember{User: &tg.User{Id: userId}, Status: tg.ChatMemberStatusLeft.String()}
+		state.members[userId] = member
+	}
+	if member.IsCreator() {
+		return nil, BadRequest("can't remove chat owner")
+	}
+	return member, nil
+}
+
+func (s *Server) kickChatMember(body []byte) (interface{}, *Failure) {
+	request := new(tg.KickChatMemberRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	member, fail := s.member(request.ChatId, request.UserId)
+	if fail != nil {
+		return nil, fail
+	}
+	*member = tg.ChatMember{User: member.User, Status: tg.ChatMemberStatusKicked.String(), UntilDate: request.UntilDate}
+	return true, nil
+}
+
+func (s *Server) unbanChatMember(body []byte) (interface{}, *Failure) {
+	request := new(tg.UnbanChatMemberRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	member, fail := s.member(request.ChatId, request.UserId)
+	if fail != nil {
+		return nil, fail
+	}
+	if member.IsKicked() {
+		*member = tg.ChatMember{User: member.User, Status: tg.ChatMemberStatusLeft.String()}
+	}
+	return true, nil
+}
+
+func (s *Server) restrictChatMember(body []byte) (interface{}, *Failure) {
+	request := new(tg.RestrictChatMemberRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if !s.chat(request.ChatId).chat.IsSupergroup() {
+		return nil, BadRequest("method is available only for supergroups")
+	}
+	member, fail := s.member(request.ChatId, request.UserId)
+	if fail != nil {
+		return nil, fail
+	}
+	if request.CanSendMessages && request.CanSendMediaMessages && request.CanSendOtherMessages && request.CanAddWebPagePreviews {
+		*member = tg.ChatMember{User: member.User, Status: tg.ChatMemberStatusMember.String()}
+		return true, nil
+	}
+	*member = tg.ChatMember{
+		User:                  member.User,
+		Status:                tg.ChatMemberStatusRestricted.String(),
+		UntilDate:             request.UntilDate,
+		IsMember:              member.IsChatMember(),
+		CanSendMessages:       request.CanSendMessages,
+		CanSendMediaMessages:  request.CanSendMediaMessages,
+		CanSendOtherMessages:  request.CanSendOtherMessages,
+		CanAddWebPagePreviews: request.CanAddWebPagePreviews,
+	}
+	return true, nil
+}
+
+func (s *Server) promoteChatMember(body []byte) (interface{}, *Failure) {
+	request := new(tg.PromoteChatMemberRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	member, fail := s.member(request.ChatId, request.UserId)
+	if fail != nil {
+		return nil, fail
+	}
+	promoted := tg.ChatMember{
+		User:               member.User,
+		Status:             tg.ChatMemberStatusAdministrator.String(),
+		CanBeEdited:        true,
+		CanChangeInfo:      request.CanChangeInfo,
+		CanPostMessages:    request.CanPostMessages,
+		CanEditMessages:    request.CanEditMessages,
+		CanDeleteMessages:  request.CanDeleteMessages,
+		CanInviteUsers:     request.CanInviteUsers,
+		CanRestrictMembers: request.CanRestrictMembers,
+		CanPinMessages:     request.CanPinMessages,
+		CanPromoteMembers:  request.CanPromoteMembers,
+	}
+	if reflect.DeepEqual(promoted, tg.ChatMember{User: member.User, Status: promoted.Status, CanBeEdited: true}) {
+		promoted = tg.ChatMember{User: member.User, Status: tg.ChatMemberStatusMember.String()}
+	}
+	*member = promoted
+	return true, nil
+}
+
+func (s *Server) exportChatInviteLink(body []byte) (interface{}, *Failure) {
+	request := new(tg.ExportChatInviteLinkRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat := s.chat(request.ChatId).chat
+	chat.InviteLink = fmt.Sprintf("https://t.me/joinchat/%d-%d", -request.ChatId, time.Now().UnixNano())
+	return chat.InviteLink, nil
+}
+
+func (s *Server) group(chatId int) (*tg.Chat, *Failure) {
+	chat := s.chat(chatId).chat
+	if chat.IsPrivate() {
+		return nil, BadRequest("chat not found")
+	}
+	return chat, nil
+}
+
+func (s *Server) setChatPhoto(body []byte) (interface{}, *Failure) {
+	request := new(tg.SetChatPhotoRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	id := s.fileId(nil)
+	chat.Photo = &tg.ChatPhoto{SmallFileId: id + "_s", BigFileId: id}
+	return true, nil
+}
+
+func (s *Server) deleteChatPhoto(body []byte) (interface{}, *Failure) {
+	request := new(tg.DeleteChatPhotoRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	chat.Photo = nil
+	return true, nil
+}
+
+func (s *Server) setChatTitle(body []byte) (interface{}, *Failure) {
+	request := new(tg.SetChatTitleRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	if request.Title == "" || len([]rune(request.Title)) > 255 {
+		return nil, BadRequest("chat title is empty or too long")
+	}
+	chat.Title = request.Title
+	return true, nil
+}
+
+func (s *Server) setChatDescription(body []byte) (interface{}, *Failure) {
+	request := new(tg.SetChatDescriptionRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	if chat.Description == request.Description {
+		return nil, BadRequest("chat description is not modified")
+	}
+	chat.Description = request.Description
+	return true, nil
+}
+
+func (s *Server) pinChatMessage(body []byte) (interface{}, *Failure) {
+	request := new(tg.PinChatMessageRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	message, ok := s.chat(request.ChatId).messages[request.MessageId]
+	if !ok {
+		return nil, BadRequest("message to pin not found")
+	}
+	chat.PinnedMessage = message
+	return true, nil
+}
+
+func (s *Server) unpinChatMessage(body []byte) (interface{}, *Failure) {
+	request := new(tg.UnpinChatMessageRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	chat.PinnedMessage = nil
+	return true, nil
+}
+
+func (s *Server) leaveChat(body []byte) (interface{}, *Failure) {
+	request := new(tg.LeaveChatRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if _, fail := s.group(request.ChatId); fail != nil {
+		return nil, fail
+	}
+	me := *s.me
+	s.chat(request.ChatId).members[me.Id] = &tg.ChatMember{User: &me, Status: tg.ChatMemberStatusLeft.String()}
+	return true, nil
+}
+
+func (s *Server) getChat(body []byte) (interface{}, *Failure) {
+	request := new(tg.GetChatRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	return s.chat(request.ChatId).chat, nil
+}
+
+func (s *Server) getChatAdministrators(body []byte) (interface{}, *Failure) {
+	request := new(tg.GetChatAdministratorsRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if _, fail := s.group(request.ChatId); fail != nil {
+		return nil, fail
+	}
+	result := make([]*tg.ChatMember, 0)
+	for _, member := range s.chat(request.ChatId).members {
+		if member.IsAdmin() {
+			result = append(result, member)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].User.Id < result[j].User.Id
+	})
+	return result, nil
+}
+
+func (s *Server) getChatMembersCount(body []byte) (interface{}, *Failure) {
+	request := new(tg.GetChatMembersCountRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	state := s.chat(request.ChatId)
+	if state.chat.IsPrivate() {
+		return 2, nil
+	}
+	count := 0
+	for _, member := range state.members {
+		if member.IsChatMember() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Server) getChatMember(body []byte) (interface{}, *Failure) {
+	request := new(tg.GetChatMemberRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	state := s.chat(request.ChatId)
+	if member, ok := state.members[request.UserId]; ok {
+		return member, nil
+	}
+	status := tg.ChatMemberStatusLeft
+	if state.chat.IsPrivate() && (request.UserId == request.ChatId || request.UserId == s.me.Id) {
+		status = tg.ChatMemberStatusMember
+	}
+	return &tg.ChatMember{User: &tg.User{Id: request.UserId}, Status: status.String()}, nil
+}
+
+func (s *Server) setChatStickerSet(body []byte) (interface{}, *Failure) {
+	request := new(tg.SetChatStickerSetRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	if _, ok := s.sets[request.StickerSetName]; !ok {
+		return nil, BadRequest("STICKERSET_INVALID")
+	}
+	chat.StickerSetName = request.StickerSetName
+	return true, nil
+}
+
+func (s *Server) deleteChatStickerSet(body []byte) (interface{}, *Failure) {
+	request := new(tg.DeleteChatStickerSetRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	chat, fail := s.group(request.ChatId)
+	if fail != nil {
+		return nil, fail
+	}
+	chat.StickerSetName = ""
+	return true, nil
+}
+
+func (s *Server) answer(_ []byte) (interface{}, *Failure) {
+	return true, nil
+}
+
+func (s *Server) editMessageText(body []byte) (interface{}, *Failure) {
+	request := new(target)
+	text := new(tg.EditMessageTextRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, text); fail != nil {
+		return nil, fail
+	}
+	message, fail := s.editable(request)
+	if fail != nil {
+		return nil, fail
+	}
+	if message != nil {
+		if message.Text == "" {
+			return nil, BadRequest("there is no text in the message to edit")
+		}
+		if message.Text == text.Text && reflect.DeepEqual(message.ReplyMarkup, text.ReplyMarkup) {
+			return nil, BadRequest("message is not modified")
+		}
+		message.Text = text.Text
+		message.ReplyMarkup = text.ReplyMarkup
+	}
+	return s.edited(message)
+}
+
+func (s *Server) editMessageCaption(body []byte) (interface{}, *Failure) {
+	request := new(target)
+	caption := new(tg.EditMessageCaptionRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, caption); fail != nil {
+		return nil, fail
+	}
+	message, fail := s.editable(request)
+	if fail != nil {
+		return nil, fail
+	}
+	if message != nil {
+		if message.Caption == caption.Caption && reflect.DeepEqual(message.ReplyMarkup, caption.ReplyMarkup) {
+			return nil, BadRequest("message is not modified")
+		}
+		message.Caption = caption.Caption
+		message.ReplyMarkup = caption.ReplyMarkup
+	}
+	return s.edited(message)
+}
+
+func (s *Server) editMessageMedia(body []byte) (interface{}, *Failure) {
+	var request struct {
+		target
+		Media struct {
+			Type    string      `json:"type"`
+			Media   interface{} `json:"media"`
+			Caption string      `json:"caption"`
+		} `json:"media"`
+		ReplyMarkup *tg.InlineKeyboardMarkup `json:"reply_markup"`
+	}
+	if fail := decode(body, &request); fail != nil {
+		return nil, fail
+	}
+	message, fail := s.editable(&request.target)
+	if fail != nil {
+		return nil, fail
+	}
+	if message != nil {
+		edited := tg.Message{
+			MessageId:    message.MessageId,
+			From:         message.From,
+			Date:         message.Date,
+			Chat:         message.Chat,
+			MediaGroupId: message.MediaGroupId,
+			Caption:      request.Media.Caption,
+			ReplyMarkup:  request.ReplyMarkup,
+		}
+		if fail = s.setMedia(&edited, request.Media.Type, request.Media.Media); fail != nil {
+			return nil, fail
+		}
+		*message = edited
+	}
+	return s.edited(message)
+}
+
+func (s *Server) editMessageReplyMarkup(body []byte) (interface{}, *Failure) {
+	request := new(target)
+	markup := new(tg.EditMessageReplyMarkupRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, markup); fail != nil {
+		return nil, fail
+	}
+	message, fail := s.editable(request)
+	if fail != nil {
+		return nil, fail
+	}
+	if message != nil {
+		if reflect.DeepEqual(message.ReplyMarkup, markup.ReplyMarkup) {
+			return nil, BadRequest("message is not modified")
+		}
+		message.ReplyMarkup = markup.ReplyMarkup
+	}
+	return s.edited(message)
+}
+
+func (s *Server) deleteMessage(body []byte) (interface{}, *Failure) {
+	request := new(tg.DeleteMessageRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	state := s.chat(request.ChatId)
+	if _, ok := state.messages[request.MessageId]; !ok {
+		return nil, BadRequest("message to delete not found")
+	}
+	delete(state.messages, request.MessageId)
+	return true, nil
+}
+
+func (s *Server) stickerSet(name string) (*tg.StickerSet, *Failure) {
+	set, ok := s.sets[name]
+	if !ok {
+		return nil, BadRequest("STICKERSET_INVALID")
+	}
+	return set, nil
+}
+
+func (s *Server) getStickerSet(body []byte) (interface{}, *Failure) {
+	request := new(tg.GetStickerSetRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	return s.stickerSet(request.Name)
+}
+
+func (s *Server) uploadStickerFile(body []byte) (interface{}, *Failure) {
+	request := new(tg.UploadStickerFileRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	return s.files[s.fileId(nil)], nil
+}
+
+func (s *Server) sticker(set string, png interface{}, emojis string, mask *tg.MaskPosition) (*tg.Sticker, *Failure) {
+	if emojis == "" {
+		return nil, BadRequest("invalid sticker emojis")
+	}
+	if png == nil {
+		return nil, BadRequest("there is no sticker file in the request")
+	}
+	return &tg.Sticker{
+		FileId:       s.fileId(png),
+		Width:        512,
+		Height:       512,
+		Emoji:        emojis,
+		SetName:      set,
+		MaskPosition: mask,
+	}, nil
+}
+
+func (s *Server) createNewStickerSet(body []byte) (interface{}, *Failure) {
+	request := new(tg.CreateNewStickerSetRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if !strings.HasSuffix(request.Name, "_by_"+s.me.Username) {
+		return nil, BadRequest("invalid sticker set name is specified")
+	}
+	if _, ok := s.sets[request.Name]; ok {
+		return nil, BadRequest("sticker set name is already occupied")
+	}
+	sticker, fail := s.sticker(request.Name, request.PngSticker, request.Emojis, request.MaskPosition)
+	if fail != nil {
+		return nil, fail
+	}
+	s.sets[request.Name] = &tg.StickerSet{
+		Name:          request.Name,
+		Title:         request.Title,
+		ContainsMasks: request.ContainsMasks,
+		Stickers:      []*tg.Sticker{sticker},
+	}
+	return true, nil
+}
+
+func (s *Server) addStickerToSet(body []byte) (interface{}, *Failure) {
+	request := new(tg.AddStickerToSetRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	set, fail := s.stickerSet(request.Name)
+	if fail != nil {
+		return nil, fail
+	}
+	if len(set.Stickers) >= 120 {
+		return nil, BadRequest("STICKERS_TOO_MUCH")
+	}
+	sticker, fail := s.sticker(request.Name, request.PngSticker, request.Emojis, request.MaskPosition)
+	if fail != nil {
+		return nil, fail
+	}
+	set.Stickers = append(set.Stickers, sticker)
+	return true, nil
+}
+
+// findSticker returns the set and the position of the sticker
+func (s *Server) findSticker(fileId string) (*tg.StickerSet, int, *Failure) {
+	for _, set := range s.sets {
+		for i, sticker := range set.Stickers {
+			if sticker.FileId == fileId {
+				return set, i, nil
+			}
+		}
+	}
+	return nil, 0, BadRequest("STICKER_INVALID")
+}
+
+func (s *Server) setStickerPositionInSet(body []byte) (interface{}, *Failure) {
+	request := new(tg.SetStickerPositionInSetRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	set, i, fail := s.findSticker(request.Sticker)
+	if fail != nil {
+		return nil, fail
+	}
+	if request.Position < 0 || request.Position >= len(set.Stickers) {
+		return nil, BadRequest("STICKER_POSITION_INVALID")
+	}
+	sticker := set.Stickers[i]
+	stickers := append(append([]*tg.Sticker{}, set.Stickers[:i]...), set.Stickers[i+1:]...)
+	stickers = append(stickers[:request.Position], append([]*tg.Sticker{sticker}, stickers[request.Position:]...)...)
+	set.Stickers = stickers
+	return true, nil
+}
+
+func (s *Server) deleteStickerFromSet(body []byte) (interface{}, *Failure) {
+	request := new(tg.DeleteStickerFromSetRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	set, i, fail := s.findSticker(request.Sticker)
+	if fail != nil {
+		return nil, fail
+	}
+	set.Stickers = append(set.Stickers[:i], set.Stickers[i+1:]...)
+	return true, nil
+}
+
+func (s *Server) sendInvoice(body []byte) (interface{}, *Failure) {
+	request := new(outgoing)
+	invoice := new(tg.SendInvoiceRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, invoice); fail != nil {
+		return nil, fail
+	}
+	if len(invoice.Prices) == 0 {
+		return nil, BadRequest("prices must be non-empty")
+	}
+	total := 0
+	for _, price := range invoice.Prices {
+		total += price.Amount
+	}
+	if total <= 0 {
+		return nil, BadRequest("CURRENCY_TOTAL_AMOUNT_INVALID")
+	}
+	return s.send(request, func(message *tg.Message) {
+		message.Invoice = &tg.Invoice{
+			Title:          invoice.Title,
+			Description:    invoice.Description,
+			StartParameter: invoice.StartParameter,
+			Currency:       invoice.Currency,
+			TotalAmount:    total,
+		}
+	})
+}
+
+func (s *Server) sendGame(body []byte) (interface{}, *Failure) {
+	request := new(outgoing)
+	game := new(tg.SendGameRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	if fail := decode(body, game); fail != nil {
+		return nil, fail
+	}
+	if game.GameShortName == "" {
+		return nil, BadRequest("wrong game short name specified")
+	}
+	return s.send(request, func(message *tg.Message) {
+		message.Game = &tg.Game{Title: game.GameShortName}
+	})
+}
+
+func (s *Server) setGameScore(body []byte) (interface{}, *Failure) {
+	request := new(tg.SetGameScoreRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	message, fail := s.editable(&target{ChatId: request.ChatId, MessageId: request.MessageId, InlineMessageId: request.InlineMessageId})
+	if fail != nil {
+		return nil, fail
+	}
+	key := s.liveKey(request.ChatId, request.MessageId, request.InlineMessageId)
+	scores := s.scores[key]
+	var current *tg.GameHighScore
+	for _, score := range scores {
+		if score.User.Id == request.UserId {
+			current = score
+		}
+	}
+	if current == nil {
+		current = &tg.GameHighScore{User: &tg.User{Id: request.UserId}}
+		scores = append(scores, current)
+	} else if current.Score >= request.Score && !request.Force {
+		return nil, BadRequest("BOT_SCORE_NOT_MODIFIED")
+	}
+	current.Score = request.Score
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	for i, score := range scores {
+		score.Position = i + 1
+	}
+	s.scores[key] = scores
+	if message == nil || request.DisableEditMessage {
+		return true, nil
+	}
+	return s.edited(message)
+}
+
+func (s *Server) getGameHighScores(body []byte) (interface{}, *Failure) {
+	request := new(tg.GetGameHighScoresRequest)
+	if fail := decode(body, request); fail != nil {
+		return nil, fail
+	}
+	key := s.liveKey(request.ChatId, request.MessageId, request.InlineMessageId)
+	return append([]*tg.GameHighScore{}, s.scores[key]...), nil
+}
@@ -0,0 +1,610 @@
+// Package tgtest implements helpers for testing bots without the network:
+// in-process fake of the Telegram Bot API server.
+package tgtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spyzhov/tg"
+)
+
+// Token is a default token of the fake server
+const Token = "123456:TEST-TOKEN"
+
+// Server is an in-process fake of the Telegram Bot API server.
+// It implements API methods over in-memory state of chats, messages, members, files and webhook info.
+type Server struct {
+	// URL of the server, use it as the Bot.Host
+	URL string
+	// Token of the bot, requests with other tokens are rejected with 401 Unauthorized
+	Token string
+
+	server   *httptest.Server
+	mu       sync.Mutex
+	notify   chan struct{}
+	me       *tg.User
+	chats    map[int]*chatState
+	files    map[string]*tg.File
+	sets     map[string]*tg.StickerSet
+	scores   map[string][]*tg.GameHighScore
+	live     map[string]int
+	webhook  tg.WebhookInfo
+	updates  []*tg.Update
+	updateId int
+	sequence int
+	calls    []*Call
+	failures []*failure
+}
+
+// Call is a recorded API call
+type Call struct {
+	// Method name, e.g. "sendMessage"
+	Method string
+	// Body of the request
+	Body []byte
+	// Time of the call
+	Time time.Time
+	// Files of the multipart request by the field name
+	Files map[string][]byte
+}
+
+// Failure is an API error response
+type Failure struct {
+	Code        int
+	Description string
+	Parameters  *tg.ResponseParameters
+}
+
+type failure struct {
+	method string
+	*Failure
+}
+
+type chatState struct {
+	chat       *tg.Chat
+	members    map[int]*tg.ChatMember
+	messages   map[int]*tg.Message
+	lastId     int
+	blocked    bool
+	migratedTo int
+}
+
+// TooManyRequests returns the flood control error with the retry_after parameter
+func TooManyRequests(retryAfter int) *Failure {
+	return &Failure{
+		Code:        http.StatusTooManyRequests,
+		Description: fmt.Sprintf("Too Many Requests: retry after %d", retryAfter),
+		Parameters:  &tg.ResponseParameters{RetryAfter: retryAfter},
+	}
+}
+
+// Blocked returns the error for the chat, where the bot was blocked by the user
+func Blocked() *Failure {
+	return &Failure{
+		Code:        http.StatusForbidden,
+		Description: "Forbidden: bot was blocked by the user",
+	}
+}
+
+// Migrated returns the error for the group, that was upgraded to the supergroup
+func Migrated(chatId int) *Failure {
+	return &Failure{
+		Code:        http.StatusBadRequest,
+		Description: "Bad Request: group chat was upgraded to a supergroup chat",
+		Parameters:  &tg.ResponseParameters{MigrateToChatId: chatId},
+	}
+}
+
+// BadRequest returns the error with the 400 status code
+func BadRequest(description string) *Failure {
+	return &Failure{
+		Code:        http.StatusBadRequest,
+		Description: "Bad Request: " + description,
+	}
+}
+
+// NewServer starts the fake server with the default Token. Server should be closed after use.
+func NewServer() *Server {
+	s := &Server{
+		Token:  Token,
+		notify: make(chan struct{}),
+		me: &tg.User{
+			Id:        123456,
+			IsBot:     true,
+			FirstName: "Test Bot",
+			Username:  "test_bot",
+		},
+		chats:  make(map[int]*chatState),
+		files:  make(map[string]*tg.File),
+		sets:   make(map[string]*tg.StickerSet),
+		scores: make(map[string][]*tg.GameHighScore),
+		live:   make(map[string]int),
+	}
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Bot returns the new Bot, connected to the server
+func (s *Server) Bot() *tg.Bot {
+	bot := tg.New(s.Token)
+	bot.Host = s.URL
+	return bot
+}
+
+// Me returns the bot user, returned by getMe
+func (s *Server) Me() *tg.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := *s.me
+	return &user
+}
+
+// SetMe replaces the bot user, returned by getMe
+func (s *Server) SetMe(user *tg.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.me = user
+}
+
+// AddChat registers the chat. Unknown chats are created automatically on the first use:
+// positive identifiers as private chats and negative as supergroups.
+func (s *Server) AddChat(chat *tg.Chat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chat(chat.Id).chat = chat
+}
+
+// Chat returns the state of the chat, or nil
+func (s *Server) Chat(chatId int) *tg.Chat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.chats[chatId]; ok {
+		return state.chat
+	}
+	return nil
+}
+
+// AddMember registers the member of the chat
+func (s *Server) AddMember(chatId int, member *tg.ChatMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chat(chatId).members[member.User.Id] = member
+}
+
+// Member returns the member of the chat, or nil
+func (s *Server) Member(chatId, userId int) *tg.ChatMember {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.chats[chatId]; ok {
+		return state.members[userId]
+	}
+	return nil
+}
+
+// AddMessage stores the message in its chat, MessageId is assigned if empty
+func (s *Server) AddMessage(message *tg.Message) *tg.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(message)
+	return message
+}
+
+// store saves the incoming message in its chat
+func (s *Server) store(message *tg.Message) {
+	if _, ok := s.chats[message.Chat.Id]; !ok {
+		s.chat(message.Chat.Id).chat = message.Chat
+	}
+	state := s.chat(message.Chat.Id)
+	if message.MessageId == 0 {
+		state.lastId++
+		message.MessageId = state.lastId
+	} else if message.MessageId > state.lastId {
+		state.lastId = message.MessageId
+	}
+	if message.Date == 0 {
+		message.Date = int(time.Now().Unix())
+	}
+	message.Chat = state.chat
+	state.messages[message.MessageId] = message
+}
+
+// Message returns the stored message, or nil
+func (s *Server) Message(chatId, messageId int) *tg.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.chats[chatId]; ok {
+		return state.messages[messageId]
+	}
+	return nil
+}
+
+// Messages returns all stored messages of the chat, ordered by MessageId
+func (s *Server) Messages(chatId int) []*tg.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.chats[chatId]
+	if !ok {
+		return nil
+	}
+	result := make([]*tg.Message, 0, len(state.messages))
+	for id := 1; id <= state.lastId; id++ {
+		if message, ok := state.messages[id]; ok {
+			result = append(result, message)
+		}
+	}
+	return result
+}
+
+// AddFile registers the file for getFile
+func (s *Server) AddFile(file *tg.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[file.FileId] = file
+}
+
+// Webhook returns the current webhook info
+func (s *Server) Webhook() tg.WebhookInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.webhook
+}
+
+// StickerSet returns the sticker set, or nil
+func (s *Server) StickerSet(name string) *tg.StickerSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sets[name]
+}
+
+// PushUpdate adds the incoming update to the getUpdates queue. UpdateId is assigned if empty.
+// Messages of the update are stored in their chats.
+func (s *Server) PushUpdate(update *tg.Update) *tg.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if update.UpdateId == 0 {
+		s.updateId++
+		update.UpdateId = s.updateId
+	} else if update.UpdateId > s.updateId {
+		s.updateId = update.UpdateId
+	}
+	for _, message := range []*tg.Message{update.Message, update.ChannelPost} {
+		if message != nil && message.Chat != nil {
+			s.store(message)
+		}
+	}
+	s.updates = append(s.updates, update)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return update
+}
+
+// PendingUpdates returns the number of not confirmed updates
+func (s *Server) PendingUpdates() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.updates)
+}
+
+// Fail makes the next call of the method fail with the given error. Empty method matches any call.
+func (s *Server) Fail(method string, err *Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, Failure: err})
+}
+
+// Block simulates the user, who has blocked the bot: all send methods to the chat fail with 403 error
+func (s *Server) Block(chatId int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chat(chatId).blocked = true
+}
+
+// Migrate upgrades the group to the supergroup: all calls for the old chat fail with the migrate_to_chat_id parameter,
+// service messages are pushed into both chats.
+func (s *Server) Migrate(from, to int) {
+	s.mu.Lock()
+	state := s.chat(from)
+	state.migratedTo = to
+	old := state.chat
+	supergroup := s.chat(to)
+	supergroup.chat.Type = tg.ChatTypeSupergroup.String()
+	if supergroup.chat.Title == "" {
+		supergroup.chat.Title = old.Title
+	}
+	for id, member := range state.members {
+		supergroup.members[id] = member
+	}
+	me := *s.me
+	s.mu.Unlock()
+
+	s.PushUpdate(&tg.Update{Message: &tg.Message{From: &me, Chat: old, MigrateToChatId: to}})
+	s.PushUpdate(&tg.Update{Message: &tg.Message{From: &me, Chat: supergroup.chat, MigrateFromChatId: from}})
+}
+
+// Calls returns all recorded calls
+func (s *Server) Calls() []*Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Call{}, s.calls...)
+}
+
+// CallsTo returns recorded calls of the method
+func (s *Server) CallsTo(method string) []*Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]*Call, 0)
+	for _, call := range s.calls {
+		if call.Method == method {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+// LastCall returns the last recorded call of the method, or nil
+func (s *Server) LastCall(method string) *Call {
+	calls := s.CallsTo(method)
+	if len(calls) == 0 {
+		return nil
+	}
+	return calls[len(calls)-1]
+}
+
+// Reset removes all recorded calls
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// Decode unmarshal the request body into the request structure
+func (c *Call) Decode(request interface{}) error {
+	return json.Unmarshal(c.Body, request)
+}
+
+// ServeHTTP handles the Bot API requests: /bot<token>/<method>
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		s.write(w, nil, &Failure{Code: http.StatusNotFound, Description: "Not Found"})
+		return
+	}
+	if strings.TrimPrefix(parts[0], "bot") != s.Token {
+		s.write(w, nil, &Failure{Code: http.StatusUnauthorized, Description: "Unauthorized"})
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.write(w, nil, BadRequest(err.Error()))
+		return
+	}
+	var files map[string][]byte
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if body, files, err = multipartBody(r.Header.Get("Content-Type"), body); err != nil {
+			s.write(w, nil, BadRequest(err.Error()))
+			return
+		}
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+	method := parts[1]
+
+	s.mu.Lock()
+	s.calls = append(s.calls, &Call{Method: method, Body: body, Time: time.Now(), Files: files})
+	if fail := s.failure(method, body); fail != nil {
+		s.mu.Unlock()
+		s.write(w, nil, fail)
+		return
+	}
+	if method == "getUpdates" {
+		s.mu.Unlock()
+		result, fail := s.getUpdates(r, body)
+		// updates share messages with the chats, so they are encoded under the lock
+		s.mu.Lock()
+		data, code := encode(result, fail)
+		s.mu.Unlock()
+		writeResponse(w, data, code)
+		return
+	}
+	handler, ok := methods[method]
+	if !ok {
+		s.mu.Unlock()
+		s.write(w, nil, &Failure{Code: http.StatusNotFound, Description: "Not Found: method not found"})
+		return
+	}
+	result, fail := handler(s, body)
+	// result may refer to the server state, so it is encoded under the lock
+	data, code := encode(result, fail)
+	s.mu.Unlock()
+	writeResponse(w, data, code)
+}
+
+// multipartBody converts the multipart form into the JSON body: values are decoded as JSON if possible,
+// files are replaced with empty objects
+func multipartBody(contentType string, body []byte) ([]byte, map[string][]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	files := make(map[string][]byte)
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case part.FileName() != "":
+			files[part.FormName()] = data
+			fields[part.FormName()] = json.RawMessage("{}")
+		case json.Valid(data):
+			fields[part.FormName()] = data
+		default:
+			fields[part.FormName()], _ = json.Marshal(string(data))
+		}
+	}
+	body, err = json.Marshal(fields)
+	return body, files, err
+}
+
+func (s *Server) failure(method string, body []byte) *Failure {
+	for i, fail := range s.failures {
+		if fail.method == "" || fail.method == method {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			return fail.Failure
+		}
+	}
+	var request struct {
+		ChatId int `json:"chat_id"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil || request.ChatId == 0 {
+		return nil
+	}
+	state, ok := s.chats[request.ChatId]
+	if !ok {
+		return nil
+	}
+	if state.migratedTo != 0 {
+		return Migrated(state.migratedTo)
+	}
+	if state.blocked && (strings.HasPrefix(method, "send") || method == "forwardMessage") {
+		return Blocked()
+	}
+	return nil
+}
+
+func (s *Server) write(w http.ResponseWriter, result interface{}, fail *Failure) {
+	data, code := encode(result, fail)
+	writeResponse(w, data, code)
+}
+
+// encode returns the JSON response and its status code
+func encode(result interface{}, fail *Failure) ([]byte, int) {
+	var response struct {
+		OK          bool                   `json:"ok"`
+		Result      interface{}            `json:"result,omitempty"`
+		ErrorCode   int                    `json:"error_code,omitempty"`
+		Description string                 `json:"description,omitempty"`
+		Parameters  *tg.ResponseParameters `json:"parameters,omitempty"`
+	}
+	code := http.StatusOK
+	if fail != nil {
+		response.ErrorCode = fail.Code
+		response.Description = fail.Description
+		response.Parameters = fail.Parameters
+		code = fail.Code
+	} else {
+		response.OK = true
+		response.Result = result
+	}
+	data, _ := json.Marshal(response)
+	return data, code
+}
+
+func writeResponse(w http.ResponseWriter, data []byte, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
+
+func (s *Server) chat(chatId int) *chatState {
+	state, ok := s.chats[chatId]
+	if !ok {
+		chat := &tg.Chat{Id: chatId, Type: tg.ChatTypePrivate.String()}
+		if chatId < 0 {
+			chat.Type = tg.ChatTypeSupergroup.String()
+		}
+		state = &chatState{
+			chat:     chat,
+			members:  make(map[int]*tg.ChatMember),
+			messages: make(map[int]*tg.Message),
+		}
+		s.chats[chatId] = state
+	}
+	return state
+}
+
+func (s *Server) getUpdates(r *http.Request, body []byte) ([]*tg.Update, *Failure) {
+	request := new(tg.GetUpdatesRequest)
+	if err := json.Unmarshal(body, request); err != nil {
+		return nil, BadRequest(err.Error())
+	}
+	deadline := time.After(time.Duration(request.Timeout) * time.Second)
+	for {
+		s.mu.Lock()
+		if s.webhook.Url != "" {
+			s.mu.Unlock()
+			return nil, &Failure{Code: http.StatusConflict, Description: "Conflict: can't use getUpdates method while webhook is active"}
+		}
+		if request.Offset > 0 {
+			i := 0
+			for i < len(s.updates) && s.updates[i].UpdateId < request.Offset {
+				i++
+			}
+			s.updates = s.updates[i:]
+		}
+		limit := request.Limit
+		if limit <= 0 || limit > 100 {
+			limit = 100
+		}
+		result := make([]*tg.Update, 0, limit)
+		for _, update := range s.updates {
+			if len(result) == limit {
+				break
+			}
+			if allowed(request.AllowedUpdates, update) {
+				result = append(result, update)
+			}
+		}
+		notify := s.notify
+		s.mu.Unlock()
+
+		if len(result) != 0 || request.Timeout <= 0 {
+			return result, nil
+		}
+		select {
+		case <-notify:
+		case <-deadline:
+			return result, nil
+		case <-r.Context().Done():
+			return result, nil
+		}
+	}
+}
+
+func allowed(types []string, update *tg.Update) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, name := range types {
+		if name == update.Type().String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package tgtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spyzhov/tg"
+	"github.com/spyzhov/tg/tgtest"
+)
+
+func TestServer_SendMessage(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	user, err := bot.GetMe(ctx)
+	if err != nil || user.Username != "test_bot" {
+		t.Fatalf("GetMe() = %#v, %v", user, err)
+	}
+	message, err := bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 42, Text: "hello"})
+	if err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if message.MessageId != 1 || message.Text != "hello" || !message.Chat.IsPrivate() {
+		t.Errorf("wrong message: %#v", message)
+	}
+	if messages := server.Messages(42); len(messages) != 1 || messages[0].Text != "hello" {
+		t.Errorf("wrong messages: %#v", messages)
+	}
+
+	call := server.LastCall("sendMessage")
+	request := new(tg.SendMessageRequest)
+	if call == nil || call.Decode(request) != nil || request.ChatId != 42 {
+		t.Errorf("wrong call: %#v", call)
+	}
+	if _, err = bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 42}); err == nil {
+		t.Errorf("empty text should fail")
+	}
+	if len(server.CallsTo("sendMessage")) != 2 {
+		t.Errorf("all calls should be recorded")
+	}
+}
+
+func TestServer_EditMessageText(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	message, err := bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 42, Text: "one"})
+	if err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	edited, err := bot.EditMessageText(ctx, &tg.EditMessageTextRequest{ChatId: 42, MessageId: message.MessageId, Text: "two"})
+	if err != nil || edited.Text != "two" || edited.EditDate == 0 {
+		t.Fatalf("EditMessageText() = %#v, %v", edited, err)
+	}
+	if _, err = bot.EditMessageText(ctx, &tg.EditMessageTextRequest{ChatId: 42, MessageId: message.MessageId, Text: "two"}); err == nil {
+		t.Errorf("not modified message should fail")
+	}
+	if _, err = bot.DeleteMessage(ctx, &tg.DeleteMessageRequest{ChatId: 42, MessageId: message.MessageId}); err != nil {
+		t.Errorf("DeleteMessage() error = %v", err)
+	}
+	if server.Message(42, message.MessageId) != nil {
+		t.Errorf("message should be deleted")
+	}
+}
+
+func TestServer_GetUpdates(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: 1, Type: "private"}, Text: "one"}})
+	server.PushUpdate(&tg.Update{CallbackQuery: &tg.CallbackQuery{Id: "1", From: &tg.User{Id: 1}}})
+
+	updates, err := bot.GetUpdates(ctx, &tg.GetUpdatesRequest{AllowedUpdates: tg.AllowedUpdates(tg.UpdateTypeMessage)})
+	if err != nil || len(updates) != 1 || updates[0].Message.Text != "one" {
+		t.Fatalf("GetUpdates() = %#v, %v", updates, err)
+	}
+	updates, err = bot.GetUpdates(ctx, &tg.GetUpdatesRequest{Offset: updates[0].UpdateId + 1})
+	if err != nil || len(updates) != 1 || updates[0].CallbackQuery == nil {
+		t.Fatalf("GetUpdates() = %#v, %v", updates, err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.PushUpdate(&tg.Update{Message: &tg.Message{Chat: &tg.Chat{Id: 1}, Text: "late"}})
+	}()
+	updates, err = bot.GetUpdates(ctx, &tg.GetUpdatesRequest{Offset: updates[0].UpdateId + 1, Timeout: 5})
+	if err != nil || len(updates) != 1 || updates[0].Message.Text != "late" {
+		t.Fatalf("long polling GetUpdates() = %#v, %v", updates, err)
+	}
+
+	if _, err = bot.SetWebhook(ctx, &tg.SetWebhookRequest{Url: "https://example.com/hook"}); err != nil {
+		t.Fatalf("SetWebhook() error = %v", err)
+	}
+	if info := server.Webhook(); info.Url != "https://example.com/hook" {
+		t.Errorf("wrong webhook: %#v", info)
+	}
+	if _, err = bot.GetUpdates(ctx, &tg.GetUpdatesRequest{}); err == nil {
+		t.Errorf("GetUpdates() should fail with active webhook")
+	}
+}
+
+func TestServer_Failures(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	server.Fail("sendMessage", tgtest.TooManyRequests(5))
+	_, err := bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 1, Text: "text"})
+	if response := tg.ErrorResponse(err); response == nil || response.ErrorCode != 429 || response.Parameters.RetryAfter != 5 {
+		t.Errorf("SendMessage() error = %v", err)
+	}
+	if _, err := bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 1, Text: "text"}); err != nil {
+		t.Errorf("SendMessage() should fail only once: %v", err)
+	}
+
+	server.Block(2)
+	_, err = bot.SendMessage(ctx, &tg.SendMessageRequest{ChatId: 2, Text: "text"})
+	if response := tg.ErrorResponse(err); response == nil || response.ErrorCode != 403 {
+		t.Errorf("SendMessage() should fail for blocked chat: %v", err)
+	}
+
+	server.AddChat(&tg.Chat{Id: -3, Type: "group", Title: "Group"})
+	server.Migrate(-3, -1003)
+	migrated := [2]int{}
+	bot.OnMigrate = func(ctx context.Context, from, to int) {
+		migrated = [2]int{from, to}
+	}
+	request := &tg.SendMessageRequest{ChatId: -3, Text: "text"}
+	message, err := bot.SendMessage(ctx, request)
+	if err != nil || message.Chat.Id != -1003 || request.ChatId != -3 {
+		t.Errorf("SendMessage() should be repeated for the supergroup: %v, %v", message, err)
+	}
+	if migrated != [2]int{-3, -1003} {
+		t.Errorf("OnMigrate() = %v", migrated)
+	}
+	if _, err = bot.Request(ctx, "getChat", map[string]int{"chat_id": -3}); tg.MigrateToChatId(err) != -1003 {
+		t.Errorf("Request() error = %v", err)
+	}
+	if chat := server.Chat(-1003); !chat.IsSupergroup() || chat.Title != "Group" {
+		t.Errorf("wrong supergroup: %#v", chat)
+	}
+	if server.PendingUpdates() != 2 {
+		t.Errorf("migration service messages should be pushed")
+	}
+}
+
+func TestServer_Members(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	server.AddChat(&tg.Chat{Id: -1, Type: "supergroup"})
+	server.AddMember(-1, &tg.ChatMember{User: &tg.User{Id: 1}, Status: "creator"})
+	server.AddMember(-1, &tg.ChatMember{User: &tg.User{Id: 2}, Status: "member"})
+
+	if _, err := bot.RestrictChatMember(ctx, (&tg.RestrictChatMemberRequest{ChatId: -1, UserId: 2}).SetPeriod(time.Hour)); err != nil {
+		t.Fatalf("RestrictChatMember() error = %v", err)
+	}
+	member, err := bot.GetChatMember(ctx, &tg.GetChatMemberRequest{ChatId: -1, UserId: 2})
+	if err != nil || !member.IsRestricted() || !member.IsChatMember() || member.UntilDate == 0 {
+		t.Errorf("GetChatMember() = %#v, %v", member, err)
+	}
+	if _, err = bot.KickChatMember(ctx, &tg.KickChatMemberRequest{ChatId: -1, UserId: 2}); err != nil {
+		t.Fatalf("KickChatMember() error = %v", err)
+	}
+	if member = server.Member(-1, 2); !member.IsKicked() {
+		t.Errorf("wrong member: %#v", member)
+	}
+	if _, err = bot.KickChatMember(ctx, &tg.KickChatMemberRequest{ChatId: -1, UserId: 1}); err == nil {
+		t.Errorf("owner can't be kicked")
+	}
+	admins, err := bot.GetChatAdministrators(ctx, &tg.GetChatAdministratorsRequest{ChatId: -1})
+	if err != nil || len(admins) != 1 || admins[0].User.Id != 1 {
+		t.Errorf("GetChatAdministrators() = %#v, %v", admins, err)
+	}
+}
+
+func TestServer_StickerSet(t *testing.T) {
+	server := tgtest.NewServer()
+	defer server.Close()
+	bot := server.Bot()
+	ctx := context.Background()
+
+	if _, err := bot.CreateNewStickerSet(ctx, &tg.CreateNewStickerSetRequest{UserId: 1, Name: "set", Title: "Set", PngSticker: "one", Emojis: "😀"}); err == nil {
+		t.Errorf("invalid name should fail")
+	}
+	if _, err := bot.CreateNewStickerSet(ctx, &tg.CreateNewStickerSetRequest{UserId: 1, Name: "set_by_test_bot", Title: "Set", PngSticker: "one", Emojis: "😀"}); err != nil {
+		t.Fatalf("CreateNewStickerSet() error = %v", err)
+	}
+	if _, err := bot.AddStickerToSet(ctx, &tg.AddStickerToSetRequest{UserId: 1, Name: "set_by_test_bot", PngSticker: "two", Emojis: "😎"}); err != nil {
+		t.Fatalf("AddStickerToSet() error = %v", err)
+	}
+	if _, err := bot.SetStickerPositionInSet(ctx, &tg.SetStickerPositionInSetRequest{Sticker: "two", Position: 0}); err != nil {
+		t.Fatalf("SetStickerPositionInSet() error = %v", err)
+	}
+	set, err := bot.GetStickerSet(ctx, &tg.GetStickerSetRequest{Name: "set_by_test_bot"})
+	if err != nil || len(set.Stickers) != 2 || set.Stickers[0].FileId != "two" {
+		t.Errorf("GetStickerSet() = %#v, %v", set, err)
+	}
+}
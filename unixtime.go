@@ -0,0 +1,98 @@
+package tg
+
+import "time"
+
+const (
+	// MinUntilPeriod is a minimal restriction period, shorter periods are considered as forever
+	MinUntilPeriod = 30 * time.Second
+	// MaxUntilPeriod is a maximal restriction period, longer periods are considered as forever
+	MaxUntilPeriod = 366 * 24 * time.Hour
+)
+
+var now = time.Now
+
+// FromUnix converts unix time field value into the time.Time, zero value is converted into the zero time.Time
+func FromUnix(sec int) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(sec), 0)
+}
+
+// ToUnix converts time.Time into the unix time field value, zero time.Time is converted into 0
+func ToUnix(t time.Time) int {
+	if t.IsZero() {
+		return 0
+	}
+	return int(t.Unix())
+}
+
+// UntilDate returns until_date field value for the restriction, that lasts till the given time.
+// If period is less than 30 seconds or more than 366 days from now, 0 (forever) is returned.
+func UntilDate(t time.Time) int {
+	if t.IsZero() {
+		return 0
+	}
+	if d := t.Sub(now()); d < MinUntilPeriod || d > MaxUntilPeriod {
+		return 0
+	}
+	return ToUnix(t)
+}
+
+// UntilPeriod returns until_date field value for the restriction, that lasts for the given period from now.
+// If period is less than 30 seconds or more than 366 days, 0 (forever) is returned.
+func UntilPeriod(d time.Duration) int {
+	if d < MinUntilPeriod || d > MaxUntilPeriod {
+		return 0
+	}
+	return ToUnix(now().Add(d))
+}
+
+// Time returns the date the message was sent
+func (m *Message) Time() time.Time {
+	return FromUnix(m.Date)
+}
+
+// EditTime returns the date the message was last edited, or zero time.Time
+func (m *Message) EditTime() time.Time {
+	return FromUnix(m.EditDate)
+}
+
+// ForwardTime returns the date the original message was sent, or zero time.Time
+func (m *Message) ForwardTime() time.Time {
+	return FromUnix(m.ForwardDate)
+}
+
+// UntilTime returns the date when restrictions will be lifted for the member, zero time.Time means forever
+func (m *ChatMember) UntilTime() time.Time {
+	return FromUnix(m.UntilDate)
+}
+
+// LastErrorTime returns the date of the most recent webhook error, or zero time.Time
+func (w *WebhookInfo) LastErrorTime() time.Time {
+	return FromUnix(w.LastErrorDate)
+}
+
+// SetUntil sets the date when the user will be unbanned, zero time.Time means forever
+func (r *KickChatMemberRequest) SetUntil(t time.Time) *KickChatMemberRequest {
+	r.UntilDate = UntilDate(t)
+	return r
+}
+
+// SetPeriod sets the ban period from now, see UntilPeriod
+func (r *KickChatMemberRequest) SetPeriod(d time.Duration) *KickChatMemberRequest {
+	r.UntilDate = UntilPeriod(d)
+	return r
+}
+
+// SetUntil sets the date when restrictions will be lifted, zero time.Time means forever
+func (r *RestrictChatMemberRequest) SetUntil(t time.Time) *RestrictChatMemberRequest {
+	r.UntilDate = UntilDate(t)
+	return r
+}
+
+// SetPeriod sets the restriction period from now, see UntilPeriod
+func (r *RestrictChatMemberRequest) SetPeriod(d time.Duration) *RestrictChatMemberRequest {
+	r.UntilDate = UntilPeriod(d)
+	return r
+}
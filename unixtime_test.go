@@ -0,0 +1,68 @@
+package tg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFromUnix(t *testing.T) {
+	if !FromUnix(0).IsZero() {
+		t.Errorf("zero value should be converted into zero time")
+	}
+	if ToUnix(time.Time{}) != 0 {
+		t.Errorf("zero time should be converted into zero value")
+	}
+	if value := ToUnix(FromUnix(1562371200)); value != 1562371200 {
+		t.Errorf("wrong value: %d", value)
+	}
+}
+
+func TestUntilPeriod(t *testing.T) {
+	fixed := time.Unix(1562371200, 0)
+	now = func() time.Time { return fixed }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name     string
+		period   time.Duration
+		expected int
+	}{
+		{name: "too short", period: 29 * time.Second, expected: 0},
+		{name: "minimal", period: 30 * time.Second, expected: 1562371230},
+		{name: "hour", period: time.Hour, expected: 1562374800},
+		{name: "maximal", period: 366 * 24 * time.Hour, expected: 1593993600},
+		{name: "too long", period: 367 * 24 * time.Hour, expected: 0},
+		{name: "negative", period: -time.Hour, expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if value := UntilPeriod(test.period); value != test.expected {
+				t.Errorf("UntilPeriod() = %d, expected %d", value, test.expected)
+			}
+			if value := UntilDate(fixed.Add(test.period)); value != test.expected {
+				t.Errorf("UntilDate() = %d, expected %d", value, test.expected)
+			}
+		})
+	}
+
+	request := new(RestrictChatMemberRequest).SetPeriod(time.Hour)
+	if request.UntilDate != 1562374800 {
+		t.Errorf("wrong until_date: %d", request.UntilDate)
+	}
+	if new(KickChatMemberRequest).SetUntil(time.Time{}).UntilDate != 0 {
+		t.Errorf("zero time should be forever")
+	}
+}
+
+func TestUntilDate_Clock(t *testing.T) {
+	// the clock moves on each call, the date is returned as is
+	tick := time.Unix(1562371200, 0)
+	now = func() time.Time {
+		tick = tick.Add(time.Second)
+		return tick
+	}
+	defer func() { now = time.Now }()
+	if value := UntilDate(time.Unix(1562374800, 0)); value != 1562374800 {
+		t.Errorf("UntilDate() = %d, expected 1562374800", value)
+	}
+}
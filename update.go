@@ -0,0 +1,113 @@
+package tg
+
+import (
+	"context"
+	"time"
+)
+
+type receivedContextKey struct{}
+
+// WithReceivedAt returns the context of the update handler with the time the update was received
+func WithReceivedAt(ctx context.Context, received time.Time) context.Context {
+	return context.WithValue(ctx, receivedContextKey{}, received)
+}
+
+// ReceivedAt returns the time the update of the handler ctx was received by the Poller, the Webhook
+// or the Dispatcher, zero time if unknown. Deadlines of the API answers should be measured from it,
+// e.g. of the pre-checkout query.
+func ReceivedAt(ctx context.Context) time.Time {
+	received, _ := ctx.Value(receivedContextKey{}).(time.Time)
+	return received
+}
+
+// Type returns the type of the update payload, empty string for the unknown updates
+func (u *Update) Type() UpdateType {
+	switch {
+	case u == nil:
+		return ""
+	case u.Message != nil:
+		return UpdateTypeMessage
+	case u.EditedMessage != nil:
+		return UpdateTypeEditedMessage
+	case u.ChannelPost != nil:
+		return UpdateTypeChannelPost
+	case u.EditedChannelPost != nil:
+		return UpdateTypeEditedChannelPost
+	case u.InlineQuery != nil:
+		return UpdateTypeInlineQuery
+	case u.ChosenInlineResult != nil:
+		return UpdateTypeChosenInlineResult
+	case u.CallbackQuery != nil:
+		return UpdateTypeCallbackQuery
+	case u.ShippingQuery != nil:
+		return UpdateTypeShippingQuery
+	case u.PreCheckoutQuery != nil:
+		return UpdateTypePreCheckoutQuery
+	case u.Poll != nil:
+		return UpdateTypePoll
+	}
+	return ""
+}
+
+// MessageLike returns the message of the update: new or edited message, channel post or the message of the callback query.
+// Returns nil for the other update types.
+func (u *Update) MessageLike() *Message {
+	switch {
+	case u == nil:
+		return nil
+	case u.Message != nil:
+		return u.Message
+	case u.EditedMessage != nil:
+		return u.EditedMessage
+	case u.ChannelPost != nil:
+		return u.ChannelPost
+	case u.EditedChannelPost != nil:
+		return u.EditedChannelPost
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.Message
+	}
+	return nil
+}
+
+// Chat returns the chat, where the update has happened, or nil
+func (u *Update) Chat() *Chat {
+	if message := u.MessageLike(); message != nil {
+		return message.Chat
+	}
+	return nil
+}
+
+// From returns the user, who has initiated the update, or nil for channel posts and polls
+func (u *Update) From() *User {
+	switch {
+	case u == nil:
+		return nil
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.From
+	case u.InlineQuery != nil:
+		return u.InlineQuery.From
+	case u.ChosenInlineResult != nil:
+		return u.ChosenInlineResult.From
+	case u.ShippingQuery != nil:
+		return u.ShippingQuery.From
+	case u.PreCheckoutQuery != nil:
+		return u.PreCheckoutQuery.From
+	}
+	return u.MessageLike().Sender()
+}
+
+// ChatId returns the identifier of the chat, where the update has happened, or 0
+func (u *Update) ChatId() int {
+	if chat := u.Chat(); chat != nil {
+		return chat.Id
+	}
+	return 0
+}
+
+// UserId returns the identifier of the user, who has initiated the update, or 0
+func (u *Update) UserId() int {
+	if user := u.From(); user != nil {
+		return user.Id
+	}
+	return 0
+}
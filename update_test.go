@@ -0,0 +1,58 @@
+package tg
+
+import "testing"
+
+func TestUpdate_Accessors(t *testing.T) {
+	user := &User{Id: 1}
+	chat := &Chat{Id: -2}
+	message := &Message{MessageId: 3, From: user, Chat: chat}
+	post := &Message{MessageId: 4, Chat: chat}
+	tests := []struct {
+		update  *Update
+		kind    UpdateType
+		message *Message
+		chat    *Chat
+		from    *User
+	}{
+		{update: &Update{Message: message}, kind: UpdateTypeMessage, message: message, chat: chat, from: user},
+		{update: &Update{EditedMessage: message}, kind: UpdateTypeEditedMessage, message: message, chat: chat, from: user},
+		{update: &Update{ChannelPost: post}, kind: UpdateTypeChannelPost, message: post, chat: chat},
+		{update: &Update{EditedChannelPost: post}, kind: UpdateTypeEditedChannelPost, message: post, chat: chat},
+		{update: &Update{CallbackQuery: &CallbackQuery{From: user, Message: message}}, kind: UpdateTypeCallbackQuery, message: message, chat: chat, from: user},
+		{update: &Update{CallbackQuery: &CallbackQuery{From: user, InlineMessageId: "id"}}, kind: UpdateTypeCallbackQuery, from: user},
+		{update: &Update{InlineQuery: &InlineQuery{From: user}}, kind: UpdateTypeInlineQuery, from: user},
+		{update: &Update{ChosenInlineResult: &ChosenInlineResult{From: user}}, kind: UpdateTypeChosenInlineResult, from: user},
+		{update: &Update{ShippingQuery: &ShippingQuery{From: user}}, kind: UpdateTypeShippingQuery, from: user},
+		{update: &Update{PreCheckoutQuery: &PreCheckoutQuery{From: user}}, kind: UpdateTypePreCheckoutQuery, from: user},
+		{update: &Update{Poll: &Poll{}}, kind: UpdateTypePoll},
+		{update: &Update{}, kind: ""},
+		{update: nil, kind: ""},
+	}
+	for _, test := range tests {
+		t.Run(string(test.kind), func(t *testing.T) {
+			if value := test.update.Type(); value != test.kind {
+				t.Errorf("Type() = %q", value)
+			}
+			if value := test.update.MessageLike(); value != test.message {
+				t.Errorf("MessageLike() = %#v", value)
+			}
+			if value := test.update.Chat(); value != test.chat {
+				t.Errorf("Chat() = %#v", value)
+			}
+			if value := test.update.From(); value != test.from {
+				t.Errorf("From() = %#v", value)
+			}
+		})
+	}
+}
+
+func TestUpdate_Ids(t *testing.T) {
+	update := &Update{CallbackQuery: &CallbackQuery{From: &User{Id: 10}, Message: &Message{Chat: &Chat{Id: 20}}}}
+	if update.ChatId() != 20 || update.UserId() != 10 {
+		t.Errorf("wrong ids: %d %d", update.ChatId(), update.UserId())
+	}
+	update = &Update{Poll: &Poll{}}
+	if update.ChatId() != 0 || update.UserId() != 0 {
+		t.Errorf("wrong ids: %d %d", update.ChatId(), update.UserId())
+	}
+}